@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	"main/agents/client"
+	"main/agents/tail"
+	m "main/models"
+	"main/relays/file_sys"
+)
+
+// runAgent is agent mode ("agent" command): files of TAIL_CONFIG are tailed and logs are sent
+// to the server of TAIL_REMOTE. Positions of files are saved in the data dir
+func runAgent(config *m.Config) {
+	trace := sl.NewTrace("Agent")
+	defer trace.AddModule("", "runAgent")()
+
+	if len(config.Tail.Tails) == 0 || config.Tail.Remote == "" {
+		trace.FATAL(nil, "TAIL_CONFIG and TAIL_REMOTE must be specified in agent mode")
+	}
+
+	dirLock := file_sys.LockDataDir(trace)
+	defer dirLock.Unlock()
+
+	cl := client.New(config.Tail.Remote, "")
+
+	// Rejected batches are dropped, other failed ones are read again
+	tailer, err := tail.NewTailer(trace, config.Tail.Tails, config.Tail.PollPeriod, func(trace *sl.Trace, logs *m.Logs) error {
+		_, err := cl.WriteLogs(context.Background(), logs)
+
+		if statusErr, ok := err.(*client.StatusErr); ok && statusErr.Status == 400 {
+			trace.WARN(nil, len(logs.Logs), " logs of storage '", logs.Storage, "' are dropped: ", err.Error())
+			return nil
+		}
+		return err
+	})
+
+	if err != nil {
+		trace.FATAL(nil, "Create tailer error: ", err.Error())
+	}
+
+	tailer.Run()
+	trace.INFO(nil, "Agent started, logs are sent to ", config.Tail.Remote)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	signal.Stop(signals)
+
+	tailer.Stop()
+	trace.INFO(nil, "Agent stopped")
+}
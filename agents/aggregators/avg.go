@@ -79,6 +79,15 @@ func (avg *Avg) GetResult() any {
 	return avg.sum / avg.count
 }
 
+func (avg *Avg) GetState() []int64 {
+	return []int64{avg.sum, avg.count}
+}
+
+func (avg *Avg) MergeState(state []int64) {
+	avg.sum += state[0]
+	avg.count += state[1]
+}
+
 func (avg *Avg) CopyDefault() m.IAggregator {
 	return &Avg{
 		sum:       0,
@@ -51,10 +51,26 @@ func (c *Count) Update(trace *sl.Trace, l *m.Log) error {
 	return nil
 }
 
+func (c *Count) IsMetaUpdatable() bool {
+	return c.condition == nil
+}
+
+func (c *Count) UpdateByMeta(meta *m.Meta) {
+	c.count += int64(meta.LogsLen)
+}
+
 func (c *Count) GetResult() any {
 	return c.count
 }
 
+func (c *Count) GetState() []int64 {
+	return []int64{c.count}
+}
+
+func (c *Count) MergeState(state []int64) {
+	c.count += state[0]
+}
+
 func (c *Count) CopyDefault() m.IAggregator {
 	return &Count{
 		count:     0,
@@ -77,10 +77,30 @@ func (max *Max) Update(trace *sl.Trace, l *m.Log) error {
 	return nil
 }
 
+func (max *Max) IsMetaUpdatable() bool {
+	return max.column == m.C_TIMESTAMP && max.condition == nil
+}
+
+func (max *Max) UpdateByMeta(meta *m.Meta) {
+	if meta.TimeRange.End > max.max {
+		max.max = meta.TimeRange.End
+	}
+}
+
 func (max *Max) GetResult() any {
 	return max.max
 }
 
+func (max *Max) GetState() []int64 {
+	return []int64{max.max}
+}
+
+func (max *Max) MergeState(state []int64) {
+	if state[0] > max.max {
+		max.max = state[0]
+	}
+}
+
 func (max *Max) CopyDefault() m.IAggregator {
 	return &Max{
 		max:       math.MinInt64,
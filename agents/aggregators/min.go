@@ -77,10 +77,30 @@ func (min *Min) Update(trace *sl.Trace, l *m.Log) error {
 	return nil
 }
 
+func (min *Min) IsMetaUpdatable() bool {
+	return min.column == m.C_TIMESTAMP && min.condition == nil
+}
+
+func (min *Min) UpdateByMeta(meta *m.Meta) {
+	if meta.TimeRange.Start < min.min {
+		min.min = meta.TimeRange.Start
+	}
+}
+
 func (min *Min) GetResult() any {
 	return min.min
 }
 
+func (min *Min) GetState() []int64 {
+	return []int64{min.min}
+}
+
+func (min *Min) MergeState(state []int64) {
+	if state[0] < min.min {
+		min.min = state[0]
+	}
+}
+
 func (min *Min) CopyDefault() m.IAggregator {
 	return &Min{
 		min:       math.MaxInt64,
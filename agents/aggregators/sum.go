@@ -77,6 +77,14 @@ func (s *Sum) GetResult() any {
 	return s.sum
 }
 
+func (s *Sum) GetState() []int64 {
+	return []int64{s.sum}
+}
+
+func (s *Sum) MergeState(state []int64) {
+	s.sum += state[0]
+}
+
 func (s *Sum) CopyDefault() m.IAggregator {
 	return &Sum{
 		sum:       0,
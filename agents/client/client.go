@@ -0,0 +1,105 @@
+// Package client sends logs to SherLogDB over HTTP
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	m "main/models"
+)
+
+const _TIMEOUT = time.Minute // of request
+
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// New creates client of server with base URL (e.g. "http://localhost:8070").
+// If socket is not empty, requests are sent over the unix socket
+func New(url, socket string) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+	}
+
+	return &Client{
+		url:  url,
+		http: &http.Client{Transport: transport, Timeout: _TIMEOUT},
+	}
+}
+
+// StatusErr is error response of server
+type StatusErr struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration // from header Retry-After
+}
+
+func (e *StatusErr) Error() string {
+	return fmt.Sprint("server responded ", e.Status, ": ", e.Message)
+}
+
+// Temporary reports whether request can succeed later (server is overloaded or has no space)
+func (e *StatusErr) Temporary() bool {
+	switch e.Status {
+	case 429, 503, 504, 507:
+		return true
+	}
+	return false
+}
+
+// WriteLogs sends batch by POST /logs. Saved and accepted batches are successful,
+// their report has logs rejected in partial mode
+func (c *Client) WriteLogs(ctx context.Context, logs *m.Logs) (*m.ValidationReport, error) {
+	body, err := json.Marshal(logs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url+"/logs", bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Report is sent only with rejected logs, otherwise all logs are accepted
+	if resp.StatusCode/100 == 2 {
+		report := &m.ValidationReport{}
+
+		if json.NewDecoder(resp.Body).Decode(report) != nil || len(report.Rejected) == 0 {
+			report = &m.ValidationReport{Accepted: len(logs.Logs), Rejected: []*m.RejectedLog{}}
+		}
+		return report, nil
+	}
+
+	statusErr := &StatusErr{Status: resp.StatusCode}
+	msg := map[string]any{}
+
+	if json.NewDecoder(resp.Body).Decode(&msg) == nil {
+		statusErr.Message = fmt.Sprint(msg["error"])
+	}
+
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		statusErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return nil, statusErr
+}
@@ -112,14 +112,20 @@ func (cp *ConditionParser) splitConditionStr(s string) (operant1, operant2 strin
 	return operant1, operant2, operator, nil
 }
 
-func (*ConditionParser) floatToIntArray(arr []any) []int64 {
+// toIntArray returns false if some item is not a number
+func (*ConditionParser) toIntArray(arr []any) ([]int64, bool) {
 	newArr := make([]int64, len(arr))
 
 	for i, val := range arr {
-		newArr[i] = int64(val.(float64))
+		num, ok := tools.ToInt(val)
+
+		if !ok {
+			return nil, false
+		}
+		newArr[i] = num
 	}
 
-	return newArr
+	return newArr, true
 }
 
 func (cp *ConditionParser) arrayToOperant(arr []any, s string) (*m.Operant, error) {
@@ -127,20 +133,24 @@ func (cp *ConditionParser) arrayToOperant(arr []any, s string) (*m.Operant, erro
 		return nil, aerr.NewAppErr(aerr.BadReq, "Array is empty: ", s)
 	}
 
-	switch arr[0].(type) {
-	case string:
+	if _, ok := arr[0].(string); ok {
 		if !tools.CheckSliceItemsType[string](arr) {
 			return nil, aerr.NewAppErr(aerr.BadReq, "Incorrect item type in array: ", s)
 		}
 		return &m.Operant{Value: tools.CastSlice[string](arr), T: m.STR_ARRAY}, nil
-	case float64:
-		if !tools.CheckSliceItemsType[float64](arr) {
-			return nil, aerr.NewAppErr(aerr.BadReq, "Incorrect item type in array: ", s)
-		}
-		return &m.Operant{Value: cp.floatToIntArray(arr), T: m.INT_ARRAY}, nil
-	default:
+	}
+
+	if _, ok := tools.ToInt(arr[0]); !ok {
 		return nil, aerr.NewAppErr(aerr.BadReq, "Invalid array item type: ", s)
 	}
+
+	// Numbers of msgpack are integers, of JSON - json.Number or floats
+	nums, ok := cp.toIntArray(arr)
+
+	if !ok {
+		return nil, aerr.NewAppErr(aerr.BadReq, "Incorrect item type in array: ", s)
+	}
+	return &m.Operant{Value: nums, T: m.INT_ARRAY}, nil
 }
 
 func (cp *ConditionParser) getOperant(s string, values []any, ad *m.AggrData, lld *m.LoadLogsData) (oper *m.Operant, err error) {
@@ -172,12 +182,13 @@ func (cp *ConditionParser) getOperant(s string, values []any, ad *m.AggrData, ll
 		switch val := val.(type) {
 		case string:
 			return &m.Operant{Value: val, T: m.STR}, nil
-		case float64:
-			return &m.Operant{Value: int64(val), T: m.INT}, nil
 		case []any:
 			oper, err = cp.arrayToOperant(val, s)
 			return oper, err
 		default:
+			if num, ok := tools.ToInt(val); ok {
+				return &m.Operant{Value: num, T: m.INT}, nil
+			}
 			err = aerr.NewAppErr(aerr.BadReq, "Invalid operant type: ", s)
 			return nil, err
 		}
@@ -135,6 +135,18 @@ func TestGetOperant(t *testing.T) {
 			values:  []any{2.0, 5.0},
 			operant: &m.Operant{Value: int64(5), T: m.INT},
 		},
+		{
+			name:    "value integer of msgpack",
+			s:       "?0",
+			values:  []any{int64(1748354137123456789)},
+			operant: &m.Operant{Value: int64(1748354137123456789), T: m.INT},
+		},
+		{
+			name:    "integer array of msgpack",
+			s:       "?0",
+			values:  []any{[]any{int8(2), uint16(500)}},
+			operant: &m.Operant{Value: []int64{2, 500}, T: m.INT_ARRAY},
+		},
 		{
 			name:    "string array",
 			s:       "?1",
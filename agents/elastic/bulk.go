@@ -0,0 +1,115 @@
+package elastic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	ACTION_INDEX  = "index"
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+	ACTION_DELETE = "delete"
+)
+
+// Action is action of bulk request with its document
+type Action struct {
+	Type  string
+	Index string
+	ID    string
+	Doc   map[string]any
+	Err   error // incorrect document
+}
+
+type actionMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// ParseBulk parses body of bulk request (NDJSON), where action line is followed by document line
+// (except delete action). Incorrect action line breaks parsing, incorrect document is error of action
+func ParseBulk(data []byte, defaultIndex string) ([]*Action, error) {
+	actions := []*Action{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+
+	next := func() ([]byte, bool) {
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				return line, true
+			}
+		}
+		return nil, false
+	}
+
+	for n := 1; ; n++ {
+		line, ok := next()
+
+		if !ok {
+			break
+		}
+
+		header := map[string]*actionMeta{}
+
+		if err := json.Unmarshal(line, &header); err != nil || len(header) != 1 {
+			return nil, fmt.Errorf("malformed action/metadata line [%d], expected an object with one action", n)
+		}
+
+		action := &Action{}
+
+		for actionType, meta := range header {
+			action.Type = actionType
+
+			if meta != nil {
+				action.Index, action.ID = meta.Index, meta.ID
+			}
+		}
+
+		if action.Index == "" {
+			action.Index = defaultIndex
+		}
+		actions = append(actions, action)
+
+		if action.Type == ACTION_DELETE {
+			continue
+		}
+
+		// Document line
+
+		line, ok = next()
+
+		if !ok {
+			return nil, errors.New("the bulk request must be terminated by a document line")
+		}
+		n++
+
+		if err := json.Unmarshal(line, &action.Doc); err != nil {
+			action.Err = fmt.Errorf("failed to parse document of line [%d]: %s", n, err.Error())
+		}
+	}
+	return actions, scanner.Err()
+}
+
+// BulkResponse is response of bulk request, which is shaped like in Elasticsearch
+type BulkResponse struct {
+	Took   int64                    `json:"took"`
+	Errors bool                     `json:"errors"`
+	Items  []map[string]*ItemResult `json:"items"`
+}
+
+type ItemResult struct {
+	Index   string `json:"_index"`
+	ID      string `json:"_id"`
+	Version int    `json:"_version,omitempty"`
+	Result  string `json:"result,omitempty"`
+	Status  int    `json:"status"`
+	Error   *Error `json:"error,omitempty"`
+}
+
+type Error struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,90 @@
+package elastic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	lm "main/agents/log_mapping"
+)
+
+func TestParseBulk(t *testing.T) {
+	body := `{"index": {"_index": "web", "_id": "1"}}
+{"message": "first"}
+
+{"create": {}}
+{"message": "second"}
+{"delete": {"_index": "web", "_id": "1"}}
+{"update": {"_id": "2"}}
+{"doc": broken}
+`
+	actions, err := ParseBulk([]byte(body), "default")
+	assert.NoError(t, err)
+	assert.Len(t, actions, 4)
+
+	assert.Equal(t, &Action{Type: ACTION_INDEX, Index: "web", ID: "1", Doc: map[string]any{"message": "first"}}, actions[0])
+	assert.Equal(t, &Action{Type: ACTION_CREATE, Index: "default", Doc: map[string]any{"message": "second"}}, actions[1])
+	assert.Equal(t, &Action{Type: ACTION_DELETE, Index: "web", ID: "1"}, actions[2])
+	assert.Equal(t, ACTION_UPDATE, actions[3].Type)
+	assert.Error(t, actions[3].Err)
+
+	_, err = ParseBulk([]byte("{\"index\": {}}\n"), "")
+	assert.Error(t, err, "no document line")
+
+	_, err = ParseBulk([]byte("[1]\n{}\n"), "")
+	assert.Error(t, err, "malformed action")
+}
+
+func TestMapping(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+
+	mapping, err := lm.ParseMapping("entity: app , modules:log.logger", DefaultMapping())
+	assert.NoError(t, err)
+	assert.Equal(t, "app", mapping["entity"])
+	assert.Equal(t, "@timestamp", mapping["timestamp"])
+
+	for _, s := range []string{"fields:x", "column:x", "entity"} {
+		_, err = lm.ParseMapping(s, DefaultMapping())
+		assert.Error(t, err, s)
+	}
+
+	l := mapping.ToLog(map[string]any{
+		"@timestamp": "2024-01-02T03:04:05.678Z",
+		"log":        map[string]any{"level": "warning", "logger": "http"},
+		"app":        "shop",
+		"host":       map[string]any{"name": "node-1", "ip": "10.0.0.1"},
+		"trace":      map[string]any{"id": "abc"},
+		"message":    "Slow request",
+		"tags":       []any{"beta", "eu"},
+		"http":       map[string]any{"status": float64(200)},
+		"empty":      nil,
+	}, now)
+
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 678e6, time.UTC).UnixMilli(), l.Timestamp)
+	assert.Equal(t, byte(5), l.Level)
+	assert.Equal(t, []string{"abc"}, l.Traces)
+	assert.Equal(t, "shop", l.Entity)
+	assert.Equal(t, "node-1", l.EntityID)
+	assert.Equal(t, "Slow request", l.Message)
+	assert.Equal(t, []string{"http"}, l.Modules)
+	assert.Equal(t, []string{"beta", "eu"}, l.Labels)
+	assert.Equal(t, map[string]string{"host.ip": "10.0.0.1", "http.status": "200"}, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	// Defaults
+
+	l = DefaultMapping().ToLog(map[string]any{"@timestamp": float64(1600000000000), "log": map[string]any{"level": float64(6)}}, now)
+	assert.Equal(t, int64(1600000000000), l.Timestamp)
+	assert.Equal(t, byte(6), l.Level)
+	assert.Equal(t, []string{"-"}, l.Traces)
+	assert.Equal(t, "unknown_service", l.Entity)
+	assert.Equal(t, "unknown", l.EntityID)
+	assert.Equal(t, "-", l.Message)
+	assert.Equal(t, []string{"unknown_service"}, l.Modules)
+	assert.Empty(t, l.Errors())
+
+	l = DefaultMapping().ToLog(map[string]any{}, now)
+	assert.Equal(t, now.UnixMilli(), l.Timestamp)
+	assert.Equal(t, byte(4), l.Level)
+}
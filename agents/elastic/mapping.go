@@ -0,0 +1,20 @@
+package elastic
+
+import (
+	lm "main/agents/log_mapping"
+	m "main/models"
+)
+
+// DefaultMapping maps fields of Elastic Common Schema (ECS)
+func DefaultMapping() lm.Mapping {
+	return lm.Mapping{
+		m.C_TIMESTAMP: "@timestamp",
+		m.C_LEVEL:     "log.level",
+		m.C_TRACES:    "trace.id",
+		m.C_ENTITY:    "service.name",
+		m.C_ENTITY_ID: "host.name",
+		m.C_MESSAGE:   "message",
+		m.C_MODULES:   "log.logger",
+		m.C_LABELS:    "tags",
+	}
+}
@@ -0,0 +1,110 @@
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// eventTime encodes EventTime as fixext8 with type 0
+func eventTime(secs, nanos uint32) []byte {
+	data := []byte{0xd7, 0}
+	data = binary.BigEndian.AppendUint32(data, secs)
+	return binary.BigEndian.AppendUint32(data, nanos)
+}
+
+func TestReadMessage(t *testing.T) {
+	record := map[string]any{
+		"log":        "Request failed",
+		"level":      "error",
+		"trace_id":   "abc",
+		"kubernetes": map[string]any{"pod_name": "api-1", "container_name": "api", "namespace_name": "shop"},
+		"stream":     "stderr",
+	}
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf)
+
+	// Message mode
+
+	enc.EncodeArrayLen(4)
+	enc.EncodeString("api")
+	buf.Write(eventTime(1700000000, 5000000))
+	enc.Encode(record)
+	enc.Encode(map[string]any{"chunk": "c1"})
+
+	// Forward mode with time in seconds
+
+	enc.Encode([]any{"web", []any{[]any{1700000001, map[string]any{"log": "first"}}, []any{1700000002, map[string]any{"log": "second"}}}})
+
+	// PackedForward mode with gzip
+
+	packed := &bytes.Buffer{}
+	gz := gzip.NewWriter(packed)
+	entry, _ := msgpack.Marshal([]any{1700000003, map[string]any{"log": "packed"}})
+	gz.Write(entry)
+	gz.Write(entry)
+	gz.Close()
+	enc.Encode([]any{"db", packed.Bytes(), map[string]any{"compressed": "gzip", "chunk": "c2"}})
+
+	dec := msgpack.NewDecoder(buf)
+
+	msg, err := ReadMessage(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, "api", msg.Tag)
+	assert.Equal(t, "c1", msg.Chunk)
+	assert.Len(t, msg.Entries, 1)
+	assert.Equal(t, time.Unix(1700000000, 5000000), msg.Entries[0].Time)
+
+	l := DefaultMapping().ToLog(msg.Entries[0].Record, msg.Entries[0].Time)
+	assert.Equal(t, int64(1700000000005), l.Timestamp)
+	assert.Equal(t, byte(6), l.Level)
+	assert.Equal(t, []string{"abc"}, l.Traces)
+	assert.Equal(t, "api", l.Entity)
+	assert.Equal(t, "api-1", l.EntityID)
+	assert.Equal(t, "Request failed", l.Message)
+	assert.Equal(t, []string{"shop"}, l.Modules)
+	assert.Equal(t, map[string]string{"stream": "stderr"}, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	msg, err = ReadMessage(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", msg.Tag)
+	assert.Empty(t, msg.Chunk)
+	assert.Len(t, msg.Entries, 2)
+	assert.Equal(t, time.Unix(1700000002, 0), msg.Entries[1].Time)
+	assert.Equal(t, "second", msg.Entries[1].Record["log"])
+
+	msg, err = ReadMessage(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, "db", msg.Tag)
+	assert.Equal(t, "c2", msg.Chunk)
+	assert.Len(t, msg.Entries, 2)
+	assert.Equal(t, "packed", msg.Entries[0].Record["log"])
+
+	// Incorrect messages
+
+	for _, v := range []any{
+		[]any{"app"},
+		[]any{1, 1700000000, map[string]any{}},
+		[]any{"app", "not time", map[string]any{}},
+		[]any{"app", []any{[]any{1700000000}}},
+	} {
+		data, _ := msgpack.Marshal(v)
+		_, err = ReadMessage(msgpack.NewDecoder(bytes.NewReader(data)))
+		assert.Error(t, err, v)
+	}
+}
+
+func TestAck(t *testing.T) {
+	data, err := Ack("c1")
+	assert.NoError(t, err)
+
+	resp := map[string]string{}
+	assert.NoError(t, msgpack.Unmarshal(data, &resp))
+	assert.Equal(t, map[string]string{"ack": "c1"}, resp)
+}
@@ -0,0 +1,240 @@
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+
+	lm "main/agents/log_mapping"
+	m "main/models"
+)
+
+const (
+	_MAX_ENTRIES    = 100000   // of one message
+	_MAX_PACKED     = 64 << 20 // max size of decompressed entries of PackedForward mode
+	_EVENT_TIME_EXT = 0        // type of msgpack extension of EventTime
+)
+
+// DefaultMapping maps records of Fluent Bit, which collects logs of Kubernetes containers.
+// Time of record is time of event
+func DefaultMapping() lm.Mapping {
+	return lm.Mapping{
+		m.C_LEVEL:     "level",
+		m.C_TRACES:    "trace_id",
+		m.C_ENTITY:    "kubernetes.container_name",
+		m.C_ENTITY_ID: "kubernetes.pod_name",
+		m.C_MESSAGE:   "log",
+		m.C_MODULES:   "kubernetes.namespace_name",
+		m.C_LABELS:    "tags",
+	}
+}
+
+// Message is message of forward protocol in any mode (Message, Forward, PackedForward)
+type Message struct {
+	Tag     string
+	Entries []*Entry
+	Chunk   string // ID of chunk, which is acknowledged after saving, if it's not empty
+}
+
+type Entry struct {
+	Time   time.Time
+	Record map[string]any
+}
+
+// ReadMessage reads message of forward protocol:
+//   - Message: [tag, time, record, option]
+//   - Forward: [tag, [[time, record], ...], option]
+//   - PackedForward: [tag, bin of entries (may be gzipped), option]
+func ReadMessage(dec *msgpack.Decoder) (*Message, error) {
+	size, err := dec.DecodeArrayLen()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if size < 2 || size > 4 {
+		return nil, fmt.Errorf("message must be array of 2-4 items, not %d", size)
+	}
+
+	msg := &Message{}
+
+	if msg.Tag, err = dec.DecodeString(); err != nil {
+		return nil, errors.New("tag must be string")
+	}
+
+	code, err := dec.PeekCode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var packed []byte
+	items := size - 2
+
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		msg.Entries, err = readEntries(dec)
+	case msgpcode.IsBin(code) || msgpcode.IsString(code):
+		packed, err = dec.DecodeBytes()
+	default:
+		entry, err := readEntry(dec, 2)
+
+		if err != nil {
+			return nil, err
+		}
+		msg.Entries = []*Entry{entry}
+		items--
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Option
+
+	option := map[string]any{}
+
+	if items > 0 {
+		if option, err = dec.DecodeMap(); err != nil {
+			return nil, errors.New("option must be map")
+		}
+	}
+
+	msg.Chunk, _ = option["chunk"].(string)
+
+	if packed != nil {
+		msg.Entries, err = unpackEntries(packed, option["compressed"] == "gzip")
+	}
+	return msg, err
+}
+
+// Ack returns response to message with chunk ID
+func Ack(chunk string) ([]byte, error) {
+	return msgpack.Marshal(map[string]string{"ack": chunk})
+}
+
+func readEntries(dec *msgpack.Decoder) ([]*Entry, error) {
+	size, err := dec.DecodeArrayLen()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if size > _MAX_ENTRIES {
+		return nil, fmt.Errorf("message has more than %d entries", _MAX_ENTRIES)
+	}
+
+	entries := make([]*Entry, 0, max(size, 0))
+
+	for i := 0; i < size; i++ {
+		entry, err := readEntry(dec, 0)
+
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// unpackEntries reads stream of entries of PackedForward mode
+func unpackEntries(packed []byte, gzipped bool) ([]*Entry, error) {
+	var r io.Reader = bytes.NewReader(packed)
+
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+
+		if err != nil {
+			return nil, err
+		}
+		r = io.LimitReader(gz, _MAX_PACKED)
+	}
+
+	dec := msgpack.NewDecoder(r)
+	entries := []*Entry{}
+
+	for len(entries) < _MAX_ENTRIES {
+		entry, err := readEntry(dec, 0)
+
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return nil, fmt.Errorf("message has more than %d entries", _MAX_ENTRIES)
+}
+
+// readEntry reads [time, record], 'inlined' items of entry are read without array header
+func readEntry(dec *msgpack.Decoder, inlined int) (*Entry, error) {
+	if inlined == 0 {
+		size, err := dec.DecodeArrayLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if size != 2 {
+			return nil, errors.New("entry must be array [time, record]")
+		}
+	}
+
+	t, err := readTime(dec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := dec.DecodeMap()
+
+	if err != nil {
+		return nil, errors.New("record must be map with string keys")
+	}
+	return &Entry{Time: t, Record: record}, nil
+}
+
+// readTime reads EventTime (extension with seconds and nanoseconds) or seconds
+func readTime(dec *msgpack.Decoder) (time.Time, error) {
+	code, err := dec.PeekCode()
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if msgpcode.IsExt(code) {
+		extID, extLen, err := dec.DecodeExtHeader()
+
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if extID != _EVENT_TIME_EXT || extLen != 8 {
+			return time.Time{}, errors.New("time must be EventTime or integer")
+		}
+
+		buf := make([]byte, 8)
+
+		if err = dec.ReadFull(buf); err != nil {
+			return time.Time{}, err
+		}
+		secs, nanos := binary.BigEndian.Uint32(buf), binary.BigEndian.Uint32(buf[4:])
+		return time.Unix(int64(secs), int64(nanos)), nil
+	}
+
+	secs, err := dec.DecodeFloat64()
+
+	if err != nil {
+		return time.Time{}, errors.New("time must be EventTime or integer")
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), nil
+}
@@ -0,0 +1,139 @@
+package fluent
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Listener receives messages of forward protocol over TCP and passes them to handler.
+// Message with chunk ID is acknowledged, if handler returns no error, else sender resends it
+type Listener struct {
+	handle func(trace *sl.Trace, msg *Message) error
+	tcp    net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	mx     sync.Mutex
+	wg     sync.WaitGroup
+}
+
+func NewListener(handle func(trace *sl.Trace, msg *Message) error) *Listener {
+	return &Listener{
+		handle: handle,
+		conns:  map[net.Conn]struct{}{},
+	}
+}
+
+func (ln *Listener) Run(trace *sl.Trace, addr string) error {
+	defer trace.AddModule("_Listener", "Run")()
+
+	tcp, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+	ln.tcp = tcp
+
+	ln.wg.Add(1)
+	go ln.accept()
+	trace.INFO(nil, "Fluent forward is listened on ", tcp.Addr().String())
+	return nil
+}
+
+// Stop closes socket and connections and waits for handling of received messages
+func (ln *Listener) Stop() {
+	ln.mx.Lock()
+	ln.closed = true
+
+	if ln.tcp != nil {
+		ln.tcp.Close()
+	}
+
+	for conn := range ln.conns {
+		conn.Close()
+	}
+	ln.mx.Unlock()
+
+	ln.wg.Wait()
+}
+
+func (ln *Listener) accept() {
+	trace := sl.NewTrace("fluent_forward")
+	trace.SetEntity("tcpAcceptor", uuid.New().String())
+	defer ln.wg.Done()
+
+	for {
+		conn, err := ln.tcp.Accept()
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				trace.INFO(nil, "TCP acceptor stopped")
+				return
+			}
+			trace.WARN(nil, "Accepting of TCP error: ", err.Error())
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+
+		ln.mx.Lock()
+
+		if ln.closed {
+			ln.mx.Unlock()
+			conn.Close()
+			return
+		}
+		ln.conns[conn] = struct{}{}
+		ln.wg.Add(1)
+		ln.mx.Unlock()
+
+		go ln.read(conn)
+	}
+}
+
+func (ln *Listener) read(conn net.Conn) {
+	trace := sl.NewTrace("fluent_forward")
+	trace.SetEntity("tcpReader", conn.RemoteAddr().String())
+	defer ln.wg.Done()
+
+	defer func() {
+		ln.mx.Lock()
+		delete(ln.conns, conn)
+		ln.mx.Unlock()
+		conn.Close()
+	}()
+
+	dec := msgpack.NewDecoder(bufio.NewReader(conn))
+
+	for {
+		msg, err := ReadMessage(dec)
+
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				trace.NOTE(nil, "Incorrect forward message: ", err.Error())
+			}
+			return
+		}
+
+		if err = ln.handle(trace, msg); err != nil || msg.Chunk == "" {
+			continue
+		}
+
+		ack, err := Ack(msg.Chunk)
+
+		if err == nil {
+			_, err = conn.Write(ack)
+		}
+
+		if err != nil {
+			trace.NOTE(nil, "Sending of ack error: ", err.Error())
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const _SWEEP_PERIOD = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a set of token buckets by keys (storages, clients).
+// Every bucket gets 'rate' tokens per second and holds no more than 'burst' tokens
+type Limiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	mx        sync.Mutex
+}
+
+// New returns nil if rate is 0, which means no limit
+func New(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Take takes 1 token from bucket of the key.
+// If bucket is empty, returns false and time after which the token will be available
+func (l *Limiter) Take(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+
+	if now.Sub(l.lastSweep) > _SWEEP_PERIOD {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = l.refill(b, now)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// Return gives back token taken from bucket of the key, when request is rejected by other limit
+func (l *Limiter) Return(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(b.tokens+1, l.burst)
+	}
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.rate
+	return math.Min(tokens, l.burst)
+}
+
+// sweep removes full buckets, which are the same as new ones
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
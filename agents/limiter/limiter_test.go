@@ -0,0 +1,52 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Take("a")
+		assert.True(t, ok, "burst")
+	}
+
+	ok, wait := l.Take("a")
+	assert.False(t, ok, "empty bucket")
+	assert.Equal(t, time.Millisecond*500, wait, "retry after")
+
+	ok, _ = l.Take("b")
+	assert.True(t, ok, "other key")
+
+	now = now.Add(time.Millisecond * 500)
+	ok, _ = l.Take("a")
+	assert.True(t, ok, "refilled")
+
+	ok, _ = l.Take("a")
+	assert.False(t, ok, "empty again")
+
+	now = now.Add(time.Minute * 2)
+	l.Take("a")
+	assert.Len(t, l.buckets, 1, "full buckets sweeped")
+
+	// Returned token can be taken again
+
+	l.Take("a")
+	l.Take("a")
+	ok, _ = l.Take("a")
+	assert.False(t, ok, "empty before return")
+
+	l.Return("a")
+	ok, _ = l.Take("a")
+	assert.True(t, ok, "returned token")
+
+	var noLimit *Limiter = New(0, 0)
+	ok, _ = noLimit.Take("a")
+	assert.True(t, ok, "no limit")
+}
@@ -0,0 +1,174 @@
+// Package log_mapping maps documents (JSON or msgpack objects) of other logging systems to logs
+package log_mapping
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	m "main/models"
+	"main/tools"
+)
+
+// Mapping is path of document field (with dots for nested objects) by column of log.
+// Fields of document, which are not mapped, are fields of log
+type Mapping map[string]string
+
+// ParseMapping parses pairs "column:path", separated by commas, which replace pairs of default mapping
+func ParseMapping(s string, defaults Mapping) (Mapping, error) {
+	mapping := Mapping{}
+
+	for column, path := range defaults {
+		mapping[column] = path
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		column, path, ok := strings.Cut(pair, ":")
+		column, path = strings.TrimSpace(column), strings.TrimSpace(path)
+
+		if _, isColumn := m.GetColumnType(column); !ok || !isColumn || column == m.C_FIELDS || path == "" {
+			return nil, errors.New("incorrect pair '" + pair + "', it must be 'column:path' (column is not 'fields')")
+		}
+		mapping[column] = path
+	}
+	return mapping, nil
+}
+
+// ToLog maps document to log. Missing columns get default values (timestamp is 'defaultTime'),
+// too long values are cut
+func (mp Mapping) ToLog(doc map[string]any, defaultTime time.Time) *m.Log {
+	values := map[string]any{}
+	flatten("", doc, values)
+
+	take := func(column string) any {
+		return values[mp[column]]
+	}
+
+	l := &m.Log{
+		Timestamp: toTimestamp(take(m.C_TIMESTAMP)),
+		Level:     4,
+		Traces:    toStrings(take(m.C_TRACES)),
+		Entity:    tools.Cut(tools.FirstNotEmpty(toString(take(m.C_ENTITY)), "unknown_service"), m.MAX_VALUE_LEN),
+		EntityID:  tools.Cut(tools.FirstNotEmpty(toString(take(m.C_ENTITY_ID)), "unknown"), m.MAX_VALUE_LEN),
+		Message:   tools.FirstNotEmpty(tools.Cut(toString(take(m.C_MESSAGE)), m.MAX_MESSAGE_LEN), "-"),
+		Modules:   toStrings(take(m.C_MODULES)),
+		Labels:    toStrings(take(m.C_LABELS)),
+	}
+
+	if l.Timestamp == 0 {
+		l.Timestamp = defaultTime.UnixMilli()
+	}
+
+	// Unknown level keeps the default one
+	switch level := take(m.C_LEVEL).(type) {
+	case string:
+		if num, ok := m.GetLevel(level); ok {
+			l.Level = num
+		}
+	default:
+		if num, ok := tools.ToInt(level); ok && num >= 0 && num <= 7 {
+			l.Level = byte(num)
+		}
+	}
+
+	if len(l.Traces) == 0 {
+		l.Traces = []string{"-"}
+	}
+
+	if len(l.Modules) == 0 {
+		l.Modules = []string{l.Entity}
+	}
+
+	// Other fields are sorted, so the same ones are kept, if there are too many
+
+	for _, path := range mp {
+		delete(values, path)
+	}
+
+	keys := tools.KeysToSlice(values)
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := tools.Cut(toString(values[key]), m.MAX_VALUE_LEN)
+
+		if value == "" || len(l.Fields) == m.MAX_ITEMS {
+			continue
+		}
+
+		if l.Fields == nil {
+			l.Fields = map[string]string{}
+		}
+		l.Fields[tools.Cut(key, m.MAX_VALUE_LEN)] = value
+	}
+	return l
+}
+
+// flatten puts values of nested objects by paths with dots
+func flatten(prefix string, obj map[string]any, values map[string]any) {
+	for key, value := range obj {
+		if nested, ok := value.(map[string]any); ok && len(nested) > 0 {
+			flatten(prefix+key+".", nested, values)
+		} else {
+			values[prefix+key] = value
+		}
+	}
+}
+
+// toTimestamp converts date (RFC 3339 string or epoch milliseconds) to milliseconds
+func toTimestamp(value any) int64 {
+	if ms, ok := tools.ToInt(value); ok {
+		return ms
+	}
+
+	switch value := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t.UnixMilli()
+		}
+
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return ms
+		}
+	}
+	return 0
+}
+
+// toString returns string (or bytes) as is, null as empty string, other values as JSON
+func toString(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
+
+// toStrings converts value or array of values to array of strings
+func toStrings(value any) []string {
+	items, ok := value.([]any)
+
+	if !ok {
+		items = []any{value}
+	}
+
+	strs := []string{}
+
+	for _, item := range items {
+		if s := tools.Cut(toString(item), m.MAX_VALUE_LEN); s != "" && len(strs) < m.MAX_ITEMS {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
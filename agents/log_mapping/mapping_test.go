@@ -0,0 +1,41 @@
+package log_mapping
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	m "main/models"
+)
+
+func TestToLogLevel(t *testing.T) {
+	mapping := Mapping{m.C_LEVEL: "level"}
+
+	testCases := []struct {
+		name  string
+		level any
+		want  byte
+	}{
+		{name: "name", level: "error", want: 6},
+		{name: "name in upper case", level: "WARN", want: 5},
+		{name: "unknown name", level: "verbose", want: 4},
+		{name: "unknown short name", level: "I", want: 4},
+		{name: "number of JSON", level: json.Number("2"), want: 2},
+		{name: "number of msgpack", level: int8(7), want: 7},
+		{name: "too big number", level: float64(8), want: 4},
+		{name: "no level", level: nil, want: 4},
+	}
+
+	for _, tc := range testCases {
+		doc := map[string]any{}
+
+		if tc.level != nil {
+			doc["level"] = tc.level
+		}
+
+		l := mapping.ToLog(doc, time.Now())
+		assert.Equal(t, tc.want, l.Level, tc.name)
+	}
+}
@@ -1,18 +1,39 @@
 package log_utils
 
 import (
+	"fmt"
+	"hash/fnv"
+	"io"
+
 	sl "github.com/j-hitgate/sherlog"
 
+	aerr "main/app_errors"
 	m "main/models"
+	fsr "main/relays/file_sys"
 	"main/tools"
 )
 
+const _SPILL_PARTS = 16
+
+// Partial aggregates of group in spill file
+type groupRecord struct {
+	Str    string             `msgpack:",omitempty"`
+	Int    int64              `msgpack:",omitempty"`
+	Arr    []string           `msgpack:",omitempty"`
+	States map[string][]int64 `msgpack:",omitempty"`
+}
+
 type Groups struct {
 	groupBy      string
 	aggrs        map[string]m.IAggregator
 	groups       map[any]map[string]m.IAggregator
 	groupingVals map[any]any
 	havingCond   m.ICondition
+
+	memSize     int64
+	memoryLimit int64
+	spill       *fsr.Spill
+	parts       []*fsr.SpillWriter
 }
 
 func NewGroups(groupBy string, aggrs map[string]m.IAggregator, havingCond m.ICondition) *Groups {
@@ -25,7 +46,26 @@ func NewGroups(groupBy string, aggrs map[string]m.IAggregator, havingCond m.ICon
 	}
 }
 
-func (g *Groups) Update(trace *sl.Trace, l *m.Log) {
+func (g *Groups) SetSpill(spill *fsr.Spill, memoryLimit int64) {
+	g.spill = spill
+	g.memoryLimit = memoryLimit
+}
+
+func (*Groups) sizeOf(val any, aggrsLen int) int64 {
+	size := 96 + 48*aggrsLen
+
+	switch val := val.(type) {
+	case string:
+		size += len(val)
+	case []string:
+		for i := range val {
+			size += 16 + len(val[i])
+		}
+	}
+	return int64(size)
+}
+
+func (g *Groups) Update(trace *sl.Trace, l *m.Log) error {
 	val, _ := l.GetValue(g.groupBy)
 	groupKey := tools.ToOrderedValue(val)
 	aggrs, ok := g.groups[groupKey]
@@ -38,16 +78,137 @@ func (g *Groups) Update(trace *sl.Trace, l *m.Log) {
 		}
 		g.groups[groupKey] = aggrs
 		g.groupingVals[groupKey] = val
+		g.memSize += g.sizeOf(val, len(aggrs))
 	}
 
 	for _, aggr := range aggrs {
 		aggr.Update(trace, l)
 	}
+
+	if g.spill != nil && g.memSize > g.memoryLimit {
+		return g.spillGroups(trace)
+	}
+	return nil
 }
 
-func (g *Groups) GetAggrSources(trace *sl.Trace) ([]*m.AggrSource, error) {
-	sources := []*m.AggrSource{}
+// Spill
+
+func (*Groups) partOf(key any) int {
+	h := fnv.New32a()
+	fmt.Fprint(h, key)
+	return int(h.Sum32() % _SPILL_PARTS)
+}
+
+func (g *Groups) spillGroups(trace *sl.Trace) error {
+	defer trace.AddModule("_Groups", "spillGroups")()
+
+	if g.parts == nil {
+		g.parts = make([]*fsr.SpillWriter, _SPILL_PARTS)
+
+		for i := range g.parts {
+			sw, err := g.spill.Create(fmt.Sprint("groups_", i))
+
+			if err != nil {
+				return err
+			}
+			g.parts[i] = sw
+		}
+	}
+
+	for key, aggrs := range g.groups {
+		record := &groupRecord{States: make(map[string][]int64, len(aggrs))}
+
+		switch val := g.groupingVals[key].(type) {
+		case string:
+			record.Str = val
+		case int64:
+			record.Int = val
+		case []string:
+			record.Arr = val
+		}
+
+		for name, aggr := range aggrs {
+			record.States[name] = aggr.GetState()
+		}
+
+		if err := g.parts[g.partOf(key)].Put(record); err != nil {
+			return err
+		}
+	}
+
+	trace.DEBUG(nil, len(g.groups), " groups spilled to disk, spill size: ", g.spill.Size(), " bytes")
+
+	g.groups = map[any]map[string]m.IAggregator{}
+	g.groupingVals = map[any]any{}
+	g.memSize = 0
+	return nil
+}
+
+func (g *Groups) readPart(trace *sl.Trace, part int) error {
+	defer trace.AddModule("_Groups", "readPart")()
+
+	reader, err := g.spill.Open(fmt.Sprint("groups_", part))
+
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
 
+	g.groups = map[any]map[string]m.IAggregator{}
+	g.groupingVals = map[any]any{}
+	colType, _ := m.GetColumnType(g.groupBy)
+
+	for {
+		record := &groupRecord{}
+		err = reader.Get(record)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var val any
+
+		switch colType {
+		case m.STR:
+			val = record.Str
+		case m.INT:
+			val = record.Int
+		default:
+			if record.Arr == nil {
+				record.Arr = []string{}
+			}
+			val = record.Arr
+		}
+
+		key := tools.ToOrderedValue(val)
+		aggrs, ok := g.groups[key]
+
+		if !ok {
+			aggrs = map[string]m.IAggregator{}
+
+			for name, aggr := range g.aggrs {
+				aggrs[name] = aggr.CopyDefault()
+			}
+			g.groups[key] = aggrs
+			g.groupingVals[key] = val
+		}
+
+		for name, state := range record.States {
+			aggrs[name].MergeState(state)
+		}
+	}
+
+	trace.DEBUG(nil, len(g.groups), " groups readed from spill part ", part)
+	return nil
+}
+
+// Result
+
+// appendAggrSources appends groups, which match 'having'. Error is returned, if there are more than 'maxRows' sources
+func (g *Groups) appendAggrSources(trace *sl.Trace, sources []*m.AggrSource, maxRows int) ([]*m.AggrSource, error) {
 	for key, aggrs := range g.groups {
 		source := m.NewAggrSource(g.groupBy, g.groupingVals[key], aggrs)
 
@@ -64,6 +225,51 @@ func (g *Groups) GetAggrSources(trace *sl.Trace) ([]*m.AggrSource, error) {
 		}
 
 		sources = append(sources, source)
+
+		if maxRows > 0 && len(sources) > maxRows {
+			err := aerr.NewAppErr(aerr.LimitExceeded,
+				"More than ", maxRows, " groups, narrow 'time_range', 'where' or 'having'",
+			)
+			trace.NOTE(nil, err.Error())
+			return nil, err
+		}
+	}
+
+	return sources, nil
+}
+
+// GetAggrSources returns groups, which match 'having'. Spilled groups are merged by parts,
+// and merging stops as soon as there are more than 'maxRows' groups (0 is no limit)
+func (g *Groups) GetAggrSources(trace *sl.Trace, maxRows int) ([]*m.AggrSource, error) {
+	if g.parts == nil {
+		return g.appendAggrSources(trace, []*m.AggrSource{}, maxRows)
+	}
+
+	// Groups are spilled, so spill rest and merge them by parts
+
+	if err := g.spillGroups(trace); err != nil {
+		return nil, err
+	}
+
+	for _, sw := range g.parts {
+		if err := sw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sources := []*m.AggrSource{}
+	var err error
+
+	for i := range g.parts {
+		if err = g.readPart(trace, i); err != nil {
+			return nil, err
+		}
+
+		sources, err = g.appendAggrSources(trace, sources, maxRows)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return sources, nil
@@ -2,6 +2,7 @@ package log_utils
 
 import (
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
 
@@ -12,21 +13,29 @@ import (
 	"main/agents/time_range"
 	aerr "main/app_errors"
 	m "main/models"
+	fsr "main/relays/file_sys"
 	"main/tools"
 )
 
 type Processor struct {
 	logPacks  [][]*m.Log
+	memSize   int64
+	runs      []string
+	spill     *fsr.Spill
+	config    *m.QueryConfig
 	query     *m.SearchQuery
 	whereCond m.ICondition
 	aggrs     map[string]m.IAggregator
 	groups    *Groups
+	aggrOnly  bool // result is taken from aggregators and metas
+	matched   int  // count of logs in aggregators, when aggrOnly
 	offset    uint
 	limit     uint
 	trace     *sl.Trace
 }
 
-func NewProcessor(trace *sl.Trace, query *m.SearchQuery) (proc *Processor, lld *m.LoadLogsData, err error) {
+// Config may be nil, then logs and groups are not limited and not spilled to disk
+func NewProcessor(trace *sl.Trace, query *m.SearchQuery, config *m.QueryConfig) (proc *Processor, lld *m.LoadLogsData, err error) {
 	defer trace.AddModule("", "NewSearcher")()
 	trace.STAGE(nil, "Query processing...")
 
@@ -61,10 +70,15 @@ func NewProcessor(trace *sl.Trace, query *m.SearchQuery) (proc *Processor, lld *
 
 	// Select entries
 	aggrs := map[string]m.IAggregator{}
+	aggrOnly := query.GroupBy == "" && len(query.Select) > 0
 
 	for _, entry := range query.Select {
 		entry = strings.TrimSpace(entry)
 
+		if entry[len(entry)-1] != ']' {
+			aggrOnly = false
+		}
+
 		if entry[len(entry)-1] == ']' {
 			aggrs[entry], err = aggregs.ParseAggregator(trace, entry, query.AggregValues, lld)
 
@@ -115,6 +129,26 @@ func NewProcessor(trace *sl.Trace, query *m.SearchQuery) (proc *Processor, lld *
 		groups = NewGroups(query.GroupBy, aggrs, havingCond)
 	}
 
+	// Aggregators only: fully covered chunks can be taken from metas, then result is made
+	// from aggregators in the same shape. Otherwise result is made from logs as for other queries
+	if aggrOnly {
+		aggrOnly = whereCond == nil
+
+		for _, aggr := range aggrs {
+			metaAggr, ok := aggr.(m.IMetaAggregator)
+
+			if !ok || !metaAggr.IsMetaUpdatable() {
+				aggrOnly = false
+				break
+			}
+		}
+	}
+
+	if aggrOnly {
+		lld.Columns[m.C_TIMESTAMP] = true
+		lld.UseMetas = true
+	}
+
 	// Order
 	if query.OrderBy != "" {
 		key := query.OrderBy
@@ -140,14 +174,30 @@ func NewProcessor(trace *sl.Trace, query *m.SearchQuery) (proc *Processor, lld *
 		}
 	}
 
+	// Spill
+
+	var spill *fsr.Spill
+
+	if config != nil {
+		spill = fsr.NewSpill(trace, config.SpillLimit)
+
+		if groups != nil {
+			groups.SetSpill(spill, config.MemoryLimit)
+		}
+	}
+
 	trace.STAGE(nil, "Query processed")
 
 	return &Processor{
 		logPacks:  [][]*m.Log{},
+		runs:      []string{},
+		spill:     spill,
+		config:    config,
 		query:     query,
 		whereCond: whereCond,
 		aggrs:     aggrs,
 		groups:    groups,
+		aggrOnly:  aggrOnly,
 		offset:    query.Offset,
 		limit:     query.Limit,
 		trace:     trace,
@@ -209,7 +259,7 @@ func (p *Processor) sortAndJoinLogPacks(desc bool) []*m.Log {
 	if desc {
 		return tools.JoinSlices(logPacks...)
 	}
-	return tools.JoinSlicesRevers(logPacks...)
+	return tools.JoinSlicesBackward(logPacks...)
 }
 
 func (p *Processor) sortAndGetLogs() ([]*m.Log, error) {
@@ -265,27 +315,197 @@ func (p *Processor) sortAndGetLogs() ([]*m.Log, error) {
 	return logs, nil
 }
 
-func (p *Processor) getResultFromLogs() (rows [][]any, err error) {
-	defer p.trace.AddModule("_Searcher", "getResultFromLogs")()
-	p.trace.STAGE(nil, "Getting results...")
+// getResultFromAggrs returns the same rows as results from logs: row of aggregator results per matched log
+func (p *Processor) getResultFromAggrs() (rows [][]any, err error) {
+	defer p.trace.AddModule("_Searcher", "getResultFromAggrs")()
+
+	// Get page of matched logs
+
+	if p.offset >= uint(p.matched) {
+		return [][]any{}, nil
+	}
+	count := p.matched - int(p.offset)
+
+	if p.limit != 0 && count > int(p.limit) {
+		count = int(p.limit)
+	}
+
+	if p.config != nil && count > p.config.MaxRows {
+		err = aerr.NewAppErr(aerr.LimitExceeded,
+			"Result has more than ", p.config.MaxRows, " rows, specify 'limit'",
+		)
+		p.trace.NOTE(nil, err.Error())
+		return nil, err
+	}
+
+	// Create result
+
+	rows = make([][]any, count)
+
+	for i := range rows {
+		row := make([]any, len(p.query.Select))
+
+		for j, entry := range p.query.Select {
+			row[j] = p.aggrs[strings.TrimSpace(entry)].GetResult()
+		}
+		rows[i] = row
+	}
+
+	p.trace.STAGE(nil, "Results getted: ", len(rows), " rows")
+	return rows, nil
+}
+
+func (p *Processor) getLess() func(l1, l2 *m.Log) bool {
+	key := p.query.OrderBy
+	desk := true
+
+	if len(key) > 0 && key[0] == '-' {
+		desk = false
+		key = key[1:]
+	}
+
+	if key == "" {
+		key = m.C_TIMESTAMP
+	}
+
+	return func(l1, l2 *m.Log) bool {
+		val1, _ := l1.GetValue(key)
+		val2, _ := l2.GetValue(key)
+
+		if !desk {
+			val1, val2 = val2, val1
+		}
+
+		switch val1 := tools.ToOrderedValue(val1).(type) {
+		case int64:
+			return val1 < val2.(int64)
+		case string:
+			return val1 < tools.ToOrderedValue(val2).(string)
+		}
+		return false
+	}
+}
+
+func (p *Processor) spillLogs() error {
+	defer p.trace.AddModule("_Searcher", "spillLogs")()
 
 	logs, err := p.sortAndGetLogs()
 
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprint("run_", len(p.runs))
+	sw, err := p.spill.Create(name)
+
+	if err != nil {
+		return err
+	}
+
+	for _, l := range logs {
+		if err = sw.Put(l); err != nil {
+			sw.Close()
+			return err
+		}
+	}
+
+	if err = sw.Close(); err != nil {
+		return err
+	}
+
+	p.runs = append(p.runs, name)
+	p.logPacks = [][]*m.Log{}
+	p.memSize = 0
+
+	p.trace.DEBUG(nil, len(logs), " logs spilled to disk, spill size: ", p.spill.Size(), " bytes")
+	return nil
+}
+
+func (p *Processor) getPageOfLogs() ([]*m.Log, error) {
+	defer p.trace.AddModule("_Searcher", "getPageOfLogs")()
+
+	// Logs in memory
+
+	if len(p.runs) == 0 {
+		logs, err := p.sortAndGetLogs()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.offset >= uint(len(logs)) {
+			return []*m.Log{}, nil
+		}
+		end := int(p.offset + p.limit)
+
+		if p.limit == 0 || end > len(logs) {
+			end = len(logs)
+		}
+		return logs[p.offset:end], nil
+	}
+
+	// Spilled logs
+
+	if len(p.logPacks) > 0 {
+		if err := p.spillLogs(); err != nil {
+			return nil, err
+		}
+	}
+
+	mr, err := newMerger(p.spill, p.runs, p.getLess())
+
 	if err != nil {
 		return nil, err
 	}
+	defer mr.Close()
 
-	// Get log slice
+	logs := []*m.Log{}
+	var i uint
 
-	if p.offset >= uint(len(logs)) {
-		return [][]any{}, nil
+	for ; p.limit == 0 || i < p.offset+p.limit; i++ {
+		l, err := mr.Next()
+
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			break
+		}
+
+		if i >= p.offset {
+			logs = append(logs, l)
+		}
+
+		if len(logs) > p.config.MaxRows {
+			break
+		}
+	}
+
+	p.trace.DEBUG(nil, len(p.runs), " spilled runs merged")
+	return logs, nil
+}
+
+func (p *Processor) getResultFromLogs() (rows [][]any, err error) {
+	defer p.trace.AddModule("_Searcher", "getResultFromLogs")()
+	p.trace.STAGE(nil, "Getting results...")
+
+	if p.aggrOnly {
+		return p.getResultFromAggrs()
+	}
+
+	logs, err := p.getPageOfLogs()
+
+	if err != nil {
+		return nil, err
 	}
-	end := int(p.offset + p.limit)
 
-	if p.limit == 0 || end > len(logs) {
-		end = len(logs)
+	if p.config != nil && len(logs) > p.config.MaxRows {
+		err = aerr.NewAppErr(aerr.LimitExceeded,
+			"Result has more than ", p.config.MaxRows, " rows, specify 'limit'",
+		)
+		p.trace.NOTE(nil, err.Error())
+		return nil, err
 	}
-	logs = logs[p.offset:end]
 
 	// Create result
 
@@ -367,7 +587,12 @@ func (p *Processor) getResultFromGroups() (rows [][]any, err error) {
 	defer p.trace.AddModule("_Searcher", "getResultFromGroups")()
 	p.trace.STAGE(nil, "Getting results...")
 
-	groups, err := p.groups.GetAggrSources(p.trace)
+	maxRows := 0
+
+	if p.config != nil {
+		maxRows = p.config.MaxRows
+	}
+	groups, err := p.groups.GetAggrSources(p.trace, maxRows)
 
 	if err != nil {
 		return nil, err
@@ -413,6 +638,7 @@ func (p *Processor) PutLogs(logs []*m.Log) error {
 	defer p.trace.AddModule("_Searcher", "PutLogs")()
 
 	logPack := []*m.Log{}
+	var size int64
 
 	for _, l := range logs {
 		// Filter
@@ -432,24 +658,54 @@ func (p *Processor) PutLogs(logs []*m.Log) error {
 		// Collect or/and pass through aggregators
 
 		if p.query.GroupBy == "" {
-			logPack = append(logPack, l)
+			if p.aggrOnly {
+				p.matched++
+			} else {
+				logPack = append(logPack, l)
+				size += l.Size()
+			}
 
 			for _, aggr := range p.aggrs {
 				aggr.Update(p.trace, l)
 			}
-		} else {
-			p.groups.Update(p.trace, l)
+		} else if err := p.groups.Update(p.trace, l); err != nil {
+			return err
 		}
 	}
 
 	if len(logPack) > 0 {
 		p.logPacks = append(p.logPacks, logPack)
+		p.memSize += size
+
+		if p.config != nil && p.memSize > p.config.MemoryLimit {
+			if err := p.spillLogs(); err != nil {
+				return err
+			}
+		}
 	}
 
 	p.trace.DEBUG(nil, "Logs putted: ", len(p.logPacks), " chunks readed")
 	return nil
 }
 
+func (p *Processor) PutMetas(metas []*m.Meta) {
+	defer p.trace.AddModule("_Searcher", "PutMetas")()
+
+	if len(metas) == 0 {
+		return
+	}
+
+	for _, meta := range metas {
+		p.matched += meta.LogsLen
+
+		for _, aggr := range p.aggrs {
+			aggr.(m.IMetaAggregator).UpdateByMeta(meta)
+		}
+	}
+
+	p.trace.DEBUG(nil, "Metas putted: ", len(metas), " chunks not readed")
+}
+
 func (p *Processor) PutLogsFromChanel(output <-chan []*m.Log, errCh <-chan error) error {
 	for logs := range output {
 		err := p.PutLogs(logs)
@@ -461,6 +717,13 @@ func (p *Processor) PutLogsFromChanel(output <-chan []*m.Log, errCh <-chan error
 	return <-errCh
 }
 
+// Close removes spilled logs and groups
+func (p *Processor) Close() {
+	if p.spill != nil {
+		p.spill.Remove()
+	}
+}
+
 func (p *Processor) GetResult() ([][]any, error) {
 	if p.query.GroupBy == "" {
 		return p.getResultFromLogs()
@@ -476,6 +739,7 @@ func (s *Processor) Equals(other *Processor) bool {
 		s.whereCond.Equals(other.whereCond) &&
 		tools.DeepEqualMaps(s.aggrs, other.aggrs) &&
 		s.groups.Equals(other.groups) &&
+		s.aggrOnly == other.aggrOnly &&
 		s.offset == other.offset &&
 		s.limit == other.limit
 }
@@ -2,11 +2,13 @@ package log_utils
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	sl "github.com/j-hitgate/sherlog"
 	"github.com/stretchr/testify/assert"
 
+	aerr "main/app_errors"
 	m "main/models"
 	tt "main/test_tools"
 	"main/tools"
@@ -105,7 +107,7 @@ func TestProcessor(t *testing.T) {
 		// Create processor
 
 		tt.SherlogInit()
-		proc, lld, err := NewProcessor(sl.NewTrace("Main"), tc.query)
+		proc, lld, err := NewProcessor(sl.NewTrace("Main"), tc.query, nil)
 
 		if err != nil {
 			assert.True(t, tc.hasError, fmt.Sprintf("%s: %s", tc.name, err.Error()))
@@ -161,3 +163,243 @@ func TestProcessor(t *testing.T) {
 		assert.True(t, tc.lld.Equals(lld), tc.name)
 	}
 }
+
+func TestProcessorMetas(t *testing.T) {
+	tt.SherlogInit()
+
+	query := &m.SearchQuery{
+		Storage:   "storage",
+		Select:    []string{"count[]", "min[timestamp]", "max[timestamp]"},
+		TimeRange: "2 - 10",
+	}
+
+	proc, lld, err := NewProcessor(sl.NewTrace("Main"), query, nil)
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+
+	if !assert.True(t, lld.UseMetas, "metas can be used") {
+		return
+	}
+
+	// Boundary chunk is readed, other chunks are fully in range
+
+	err = proc.PutLogs([]*m.Log{{Timestamp: 2}, {Timestamp: 4}})
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+
+	proc.PutMetas([]*m.Meta{
+		{LogsLen: 3, TimeRange: m.TimeRange{Start: 3, End: 5}},
+		{LogsLen: 2, TimeRange: m.TimeRange{Start: 6, End: 9}},
+	})
+
+	result, err := proc.GetResult()
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+
+	// Row per matched log, as without metas
+
+	if assert.Len(t, result, 7, "row per log") {
+		assert.Equal(t, []any{int64(7), int64(2), int64(9)}, result[6])
+	}
+
+	// Page of rows
+
+	query.Offset, query.Limit = 5, 10
+	proc, _, err = NewProcessor(sl.NewTrace("Main"), query, nil)
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+	proc.PutMetas([]*m.Meta{{LogsLen: 3, TimeRange: m.TimeRange{Start: 3, End: 5}}})
+
+	result, err = proc.GetResult()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{}, result, "offset over matched logs")
+
+	query.Offset, query.Limit = 1, 1
+	proc, _, _ = NewProcessor(sl.NewTrace("Main"), query, nil)
+	proc.PutMetas([]*m.Meta{{LogsLen: 3, TimeRange: m.TimeRange{Start: 3, End: 5}}})
+
+	result, err = proc.GetResult()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{{int64(3), int64(3), int64(5)}}, result, "limited page")
+	query.Offset, query.Limit = 0, 0
+
+	// No matched logs, no rows
+
+	proc, _, err = NewProcessor(sl.NewTrace("Main"), query, nil)
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+
+	result, err = proc.GetResult()
+	assert.NoError(t, err)
+	assert.Empty(t, result, "no matched logs")
+
+	// Condition in aggregator disables metas, result is made from logs
+
+	query.Select = []string{"count[level > ?0]"}
+	query.AggregValues = []any{1.0}
+
+	proc, lld, err = NewProcessor(sl.NewTrace("Main"), query, nil)
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+	assert.False(t, lld.UseMetas, "metas can not be used")
+
+	err = proc.PutLogs([]*m.Log{{Timestamp: 2, Level: 2}, {Timestamp: 4, Level: 1}})
+
+	if err != nil {
+		assert.Fail(t, err.Error())
+		return
+	}
+
+	result, err = proc.GetResult()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]any{{int64(1)}, {int64(1)}}, result, "row per log, as with metas")
+}
+
+func TestProcessorOrderByTimestamp(t *testing.T) {
+	tt.SherlogInit()
+
+	logPacks := [][]*m.Log{
+		{{Timestamp: 1, Entity: "e1"}, {Timestamp: 2, Entity: "e2"}},
+		{{Timestamp: 5, Entity: "e5"}},
+		{{Timestamp: 3, Entity: "e3"}, {Timestamp: 4, Entity: "e4"}},
+	}
+
+	for orderBy, expected := range map[string][][]any{
+		"timestamp":  {{"e1"}, {"e2"}, {"e3"}, {"e4"}, {"e5"}},
+		"-timestamp": {{"e5"}, {"e4"}, {"e3"}, {"e2"}, {"e1"}},
+	} {
+		query := &m.SearchQuery{Storage: "storage", Select: []string{"entity"}, OrderBy: orderBy}
+		proc, _, err := NewProcessor(sl.NewTrace("Main"), query, nil)
+		assert.NoError(t, err)
+
+		for _, logs := range logPacks {
+			assert.NoError(t, proc.PutLogs(logs))
+		}
+
+		result, err := proc.GetResult()
+		proc.Close()
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result, orderBy)
+	}
+}
+
+func TestProcessorSpill(t *testing.T) {
+	tt.SherlogInit()
+
+	wd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	config := &m.QueryConfig{MemoryLimit: 1, SpillLimit: 1 << 20, MaxRows: 100}
+
+	testCases := []struct {
+		name   string
+		query  *m.SearchQuery
+		result [][]any
+	}{
+		{
+			name: "external sort",
+			query: &m.SearchQuery{
+				Storage: "storage",
+				Select:  []string{"entity", "level"},
+				OrderBy: "-entity",
+				Offset:  1,
+				Limit:   3,
+			},
+			result: [][]any{{"e4", int64(2)}, {"e3", int64(3)}, {"e2", int64(1)}},
+		},
+		{
+			name: "spilled groups",
+			query: &m.SearchQuery{
+				Storage: "storage",
+				Select:  []string{"level", "count[]", "max[timestamp]"},
+				GroupBy: "level",
+				OrderBy: "level",
+			},
+			result: [][]any{
+				{int64(1), int64(2), int64(4)},
+				{int64(2), int64(2), int64(5)},
+				{int64(3), int64(1), int64(3)},
+			},
+		},
+	}
+
+	logPacks := [][]*m.Log{
+		{{Timestamp: 1, Entity: "e1", Level: 2}, {Timestamp: 2, Entity: "e5", Level: 1}},
+		{{Timestamp: 3, Entity: "e3", Level: 3}},
+		{{Timestamp: 4, Entity: "e2", Level: 1}, {Timestamp: 5, Entity: "e4", Level: 2}},
+	}
+
+	for _, tc := range testCases {
+		proc, _, err := NewProcessor(sl.NewTrace("Main"), tc.query, config)
+
+		if err != nil {
+			assert.Fail(t, tc.name, err.Error())
+			continue
+		}
+
+		for _, logs := range logPacks {
+			if err = proc.PutLogs(logs); err != nil {
+				break
+			}
+		}
+
+		var result [][]any
+
+		if err == nil {
+			result, err = proc.GetResult()
+		}
+		proc.Close()
+
+		if err != nil {
+			assert.Fail(t, tc.name, err.Error())
+			continue
+		}
+		assert.Equal(t, tc.result, result, tc.name)
+	}
+
+	// Hard limit
+
+	config.SpillLimit = 10
+	proc, _, _ := NewProcessor(sl.NewTrace("Main"), testCases[0].query, config)
+	err := proc.PutLogs(logPacks[0])
+	proc.Close()
+
+	assert.Error(t, err, "spill limit")
+
+	// Merging of spilled groups stops at limit of rows
+
+	config.SpillLimit, config.MaxRows = 1<<20, 2
+	query := &m.SearchQuery{Storage: "storage", Select: []string{"entity", "count[]"}, GroupBy: "entity"}
+	proc, _, err = NewProcessor(sl.NewTrace("Main"), query, config)
+	assert.NoError(t, err)
+
+	for _, logs := range logPacks {
+		assert.NoError(t, proc.PutLogs(logs))
+	}
+	_, err = proc.GetResult()
+	proc.Close()
+
+	if assert.IsType(t, &aerr.AppErr{}, err) {
+		assert.Equal(t, aerr.LimitExceeded, err.(*aerr.AppErr).Type())
+	}
+}
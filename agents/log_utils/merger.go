@@ -0,0 +1,127 @@
+package log_utils
+
+import (
+	"container/heap"
+	"io"
+
+	m "main/models"
+	fsr "main/relays/file_sys"
+)
+
+// Merges sorted runs of logs from spill files
+
+type runSource struct {
+	reader *fsr.SpillReader
+	curr   *m.Log
+}
+
+func (rs *runSource) next() error {
+	l := &m.Log{}
+	err := rs.reader.Get(l)
+
+	if err == io.EOF {
+		rs.curr = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rs.curr = l
+	return nil
+}
+
+type merger struct {
+	sources []*runSource
+	less    func(l1, l2 *m.Log) bool
+}
+
+func newMerger(spill *fsr.Spill, runs []string, less func(l1, l2 *m.Log) bool) (*merger, error) {
+	mr := &merger{
+		sources: make([]*runSource, 0, len(runs)),
+		less:    less,
+	}
+
+	for _, run := range runs {
+		reader, err := spill.Open(run)
+
+		if err != nil {
+			mr.Close()
+			return nil, err
+		}
+
+		source := &runSource{reader: reader}
+		mr.sources = append(mr.sources, source)
+
+		if err = source.next(); err != nil {
+			mr.Close()
+			return nil, err
+		}
+	}
+
+	j := 0
+
+	for _, source := range mr.sources {
+		if source.curr != nil {
+			mr.sources[j] = source
+			j++
+		} else {
+			source.reader.Close()
+		}
+	}
+	mr.sources = mr.sources[:j]
+
+	heap.Init(mr)
+	return mr, nil
+}
+
+// Next returns nil if all runs are merged
+func (mr *merger) Next() (*m.Log, error) {
+	if len(mr.sources) == 0 {
+		return nil, nil
+	}
+	source := mr.sources[0]
+	l := source.curr
+
+	if err := source.next(); err != nil {
+		return nil, err
+	}
+
+	if source.curr == nil {
+		source.reader.Close()
+		heap.Pop(mr)
+	} else {
+		heap.Fix(mr, 0)
+	}
+	return l, nil
+}
+
+func (mr *merger) Close() {
+	for _, source := range mr.sources {
+		source.reader.Close()
+	}
+	mr.sources = nil
+}
+
+// heap.Interface
+
+func (mr *merger) Len() int {
+	return len(mr.sources)
+}
+
+func (mr *merger) Less(i, j int) bool {
+	return mr.less(mr.sources[i].curr, mr.sources[j].curr)
+}
+
+func (mr *merger) Swap(i, j int) {
+	mr.sources[i], mr.sources[j] = mr.sources[j], mr.sources[i]
+}
+
+func (mr *merger) Push(x any) {
+	mr.sources = append(mr.sources, x.(*runSource))
+}
+
+func (mr *merger) Pop() any {
+	last := mr.sources[len(mr.sources)-1]
+	mr.sources = mr.sources[:len(mr.sources)-1]
+	return last
+}
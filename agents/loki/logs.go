@@ -0,0 +1,100 @@
+package loki
+
+import (
+	"sort"
+	"time"
+
+	m "main/models"
+	"main/tools"
+)
+
+// ToLogs maps entries of streams to logs by storages. Storage is chosen by label of stream,
+// entries of streams without storage are rejected. Too long values are cut
+func (req *PushRequest) ToLogs(storageLabel, defaultStorage string) (logs map[string][]*m.Log, rejected int) {
+	logs = map[string][]*m.Log{}
+
+	for _, stream := range req.Streams {
+		storage := tools.FirstNotEmpty(stream.Labels[storageLabel], defaultStorage)
+
+		if storage == "" {
+			rejected += len(stream.Entries)
+			continue
+		}
+
+		for _, entry := range stream.Entries {
+			logs[storage] = append(logs[storage], stream.toLog(entry))
+		}
+	}
+	return logs, rejected
+}
+
+// toLog maps entry to log. Labels of stream are labels "name=value",
+// structured metadata of entry is fields. Well-known labels are also entity, entity ID, module and level
+func (stream *Stream) toLog(entry *Entry) *m.Log {
+	labels := stream.Labels
+	entity := tools.FirstNotEmpty(labels["service_name"], labels["app"], labels["job"], "unknown_service")
+
+	l := &m.Log{
+		Timestamp: entry.Time / int64(time.Millisecond),
+		Level:     4,
+		Traces:    []string{},
+		Entity:    tools.Cut(entity, m.MAX_VALUE_LEN),
+		EntityID:  tools.Cut(tools.FirstNotEmpty(labels["instance"], labels["pod"], labels["host"], labels["hostname"], "unknown"), m.MAX_VALUE_LEN),
+		Message:   tools.FirstNotEmpty(tools.Cut(entry.Line, m.MAX_MESSAGE_LEN), "-"),
+		Modules:   []string{tools.Cut(tools.FirstNotEmpty(labels["component"], labels["container"], entity), m.MAX_VALUE_LEN)},
+	}
+
+	if l.Timestamp == 0 {
+		l.Timestamp = time.Now().UnixMilli()
+	}
+
+	levelName := tools.FirstNotEmpty(entry.Metadata["level"], labels["level"], labels["detected_level"], labels["severity"])
+
+	if level, ok := m.GetLevel(levelName); ok {
+		l.Level = level
+	}
+
+	// Traces
+
+	for _, id := range []string{entry.Metadata["trace_id"], entry.Metadata["span_id"]} {
+		if id != "" {
+			l.Traces = append(l.Traces, tools.Cut(id, m.MAX_VALUE_LEN))
+		}
+	}
+
+	if len(l.Traces) == 0 {
+		l.Traces = append(l.Traces, "-")
+	}
+
+	// Labels and fields are sorted, so the same ones are kept, if there are too many
+
+	for _, name := range sortedKeys(labels) {
+		if len(l.Labels) == m.MAX_ITEMS {
+			break
+		}
+
+		if labels[name] != "" {
+			l.Labels = append(l.Labels, tools.Cut(name+"="+labels[name], m.MAX_VALUE_LEN))
+		}
+	}
+
+	for _, key := range sortedKeys(entry.Metadata) {
+		value := entry.Metadata[key]
+
+		if key == "trace_id" || key == "span_id" || value == "" || len(l.Fields) == m.MAX_ITEMS {
+			continue
+		}
+
+		if l.Fields == nil {
+			l.Fields = map[string]string{}
+		}
+		l.Fields[tools.Cut(key, m.MAX_VALUE_LEN)] = tools.Cut(value, m.MAX_VALUE_LEN)
+	}
+	return l
+}
+
+func sortedKeys(kv map[string]string) []string {
+	keys := tools.KeysToSlice(kv)
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package loki
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// PushRequest is body of push API of Loki. JSON keys are the same as in Loki
+type PushRequest struct {
+	Streams []*Stream `json:"streams"`
+}
+
+type Stream struct {
+	Labels  map[string]string `json:"stream"`
+	Entries []*Entry          `json:"values"`
+}
+
+// Entry is line of stream, in JSON it's array ["<unix ns>", "<line>", {<structured metadata>}]
+type Entry struct {
+	Time     int64 // unix nanoseconds
+	Line     string
+	Metadata map[string]string
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	values := []json.RawMessage{}
+	err := json.Unmarshal(data, &values)
+
+	if err != nil {
+		return err
+	}
+
+	if len(values) < 2 || len(values) > 3 {
+		return errors.New("entry must be array of timestamp, line and optional metadata")
+	}
+
+	var ts string
+
+	if err = json.Unmarshal(values[0], &ts); err != nil {
+		return errors.New("timestamp of entry must be string")
+	}
+
+	if e.Time, err = strconv.ParseInt(ts, 10, 64); err != nil {
+		return errors.New("incorrect timestamp of entry: " + ts)
+	}
+
+	if err = json.Unmarshal(values[1], &e.Line); err != nil {
+		return errors.New("line of entry must be string")
+	}
+
+	if len(values) == 3 {
+		if err = json.Unmarshal(values[2], &e.Metadata); err != nil {
+			return errors.New("metadata of entry must be object of strings")
+		}
+	}
+	return nil
+}
+
+// parseLabels parses labels of stream in format of Prometheus: {name="value", ...}
+func parseLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, errors.New("labels must be in braces: " + s)
+	}
+	s = s[1 : len(s)-1]
+	labels := map[string]string{}
+
+	for {
+		s = strings.TrimLeft(s, " ,")
+
+		if s == "" {
+			return labels, nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+
+		if eq <= 0 {
+			return nil, errors.New("incorrect label: " + s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		quoted, err := strconv.QuotedPrefix(s)
+
+		if err != nil {
+			return nil, errors.New("value of label '" + name + "' must be quoted")
+		}
+
+		value, err := strconv.Unquote(quoted)
+
+		if err != nil {
+			return nil, errors.New("incorrect value of label '" + name + "'")
+		}
+		labels[name] = value
+		s = s[len(quoted):]
+	}
+}
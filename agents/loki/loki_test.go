@@ -0,0 +1,111 @@
+package loki
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pw "main/agents/protowire"
+)
+
+func protoBytes(field int, value []byte) []byte {
+	data := binary.AppendUvarint(nil, uint64(field<<3|pw.BYTES))
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func protoVarint(field int, value uint64) []byte {
+	return binary.AppendUvarint(binary.AppendUvarint(nil, uint64(field<<3|pw.VARINT)), value)
+}
+
+func TestDecodeSnappy(t *testing.T) {
+	// Literal "abc", copy of 6 bytes with 1-byte offset, copy of 3 bytes with 2-byte offset
+
+	data, err := DecodeSnappy([]byte{12, 2 << 2, 'a', 'b', 'c', (6-4)<<2 | 1, 3, (3-1)<<2 | 2, 3, 0}, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcabcabcabc", string(data))
+
+	// Literal with length in next byte
+
+	long := bytes.Repeat([]byte("x"), 70)
+	data, err = DecodeSnappy(append([]byte{70, 60 << 2, 69}, long...), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, long, data)
+
+	_, err = DecodeSnappy([]byte{70, 60 << 2, 69}, 50)
+	assert.Error(t, err, "too large")
+
+	_, err = DecodeSnappy([]byte{6, 2 << 2, 'a', 'b', 'c', (6-4)<<2 | 1, 9}, 100)
+	assert.Error(t, err, "offset out of output")
+}
+
+func TestUnmarshalProto(t *testing.T) {
+	ts := append(protoVarint(1, 1700000000), protoVarint(2, 5000000)...)
+
+	entry := protoBytes(1, ts)
+	entry = append(entry, protoBytes(2, []byte("Request failed"))...)
+	entry = append(entry, protoBytes(3, append(protoBytes(1, []byte("trace_id")), protoBytes(2, []byte("abc"))...))...)
+	entry = append(entry, protoBytes(3, append(protoBytes(1, []byte("user")), protoBytes(2, []byte("bob"))...))...)
+
+	stream := protoBytes(1, []byte(`{job="api", app="web", pod="web-1", level="warn", msg="a\"b"}`))
+	stream = append(stream, protoBytes(2, entry)...)
+	stream = append(stream, protoVarint(3, 12345)...)
+
+	req, err := UnmarshalProto(protoBytes(1, stream))
+	assert.NoError(t, err)
+
+	logs, rejected := req.ToLogs("job", "")
+	assert.Equal(t, 0, rejected)
+	assert.Len(t, logs["api"], 1)
+
+	l := logs["api"][0]
+	assert.Equal(t, int64(1700000000005), l.Timestamp)
+	assert.Equal(t, byte(5), l.Level)
+	assert.Equal(t, "web", l.Entity)
+	assert.Equal(t, "web-1", l.EntityID)
+	assert.Equal(t, "Request failed", l.Message)
+	assert.Equal(t, []string{"web"}, l.Modules)
+	assert.Equal(t, []string{"abc"}, l.Traces)
+	assert.Equal(t, []string{"app=web", "job=api", "level=warn", `msg=a"b`, "pod=web-1"}, l.Labels)
+	assert.Equal(t, map[string]string{"user": "bob"}, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	_, err = UnmarshalProto(protoBytes(1, protoBytes(1, []byte(`job="api"`))))
+	assert.Error(t, err, "labels without braces")
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	body := `{"streams": [
+		{"stream": {"tenant": "acme"}, "values": [["1700000000000000000", "first"], ["0", "", {"level": "ERROR"}]]},
+		{"stream": {"job": "other"}, "values": [["1700000000000000000", "second"]]}
+	]}`
+
+	req := &PushRequest{}
+	assert.NoError(t, json.Unmarshal([]byte(body), req))
+
+	logs, rejected := req.ToLogs("tenant", "")
+	assert.Equal(t, 1, rejected, "stream without storage")
+	assert.Len(t, logs["acme"], 2)
+
+	l := logs["acme"][0]
+	assert.Equal(t, int64(1700000000000), l.Timestamp)
+	assert.Equal(t, byte(4), l.Level)
+	assert.Equal(t, "unknown_service", l.Entity)
+	assert.Equal(t, "unknown", l.EntityID)
+	assert.Equal(t, []string{"-"}, l.Traces)
+	assert.Equal(t, []string{"tenant=acme"}, l.Labels)
+
+	l = logs["acme"][1]
+	assert.NotZero(t, l.Timestamp, "now")
+	assert.Equal(t, byte(6), l.Level)
+	assert.Equal(t, "-", l.Message)
+	assert.Equal(t, map[string]string{"level": "ERROR"}, l.Fields)
+
+	logs, _ = req.ToLogs("tenant", "default")
+	assert.Len(t, logs["default"], 1)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"streams": [{"values": [[1, "line"]]}]}`), &PushRequest{}))
+}
@@ -0,0 +1,113 @@
+package loki
+
+import pw "main/agents/protowire"
+
+// UnmarshalProto decodes PushRequest from protobuf (not compressed)
+func UnmarshalProto(data []byte) (*PushRequest, error) {
+	req := &PushRequest{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if field == 1 && wireType == pw.BYTES {
+			stream, err := pw.SubMessage(r, decodeStream)
+			req.Streams = append(req.Streams, stream)
+			return true, err
+		}
+		return false, nil
+	})
+	return req, err
+}
+
+func decodeStream(data []byte) (*Stream, error) {
+	stream := &Stream{}
+	labels := ""
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if wireType != pw.BYTES {
+			return false, nil
+		}
+
+		switch field {
+		case 1:
+			value, err := r.Bytes()
+			labels = string(value)
+			return true, err
+		case 2:
+			entry, err := pw.SubMessage(r, decodeEntry)
+			stream.Entries = append(stream.Entries, entry)
+			return true, err
+		}
+		return false, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	stream.Labels, err = parseLabels(labels)
+	return stream, err
+}
+
+func decodeEntry(data []byte) (*Entry, error) {
+	entry := &Entry{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if wireType != pw.BYTES {
+			return false, nil
+		}
+
+		switch field {
+		case 1:
+			ts, err := pw.SubMessage(r, decodeTimestamp)
+			entry.Time = ts
+			return true, err
+		case 2:
+			line, err := r.Bytes()
+			entry.Line = string(line)
+			return true, err
+		case 3:
+			pair, err := pw.SubMessage(r, decodeLabelPair)
+
+			if entry.Metadata == nil {
+				entry.Metadata = map[string]string{}
+			}
+			entry.Metadata[pair[0]] = pair[1]
+			return true, err
+		}
+		return false, nil
+	})
+	return entry, err
+}
+
+// decodeTimestamp decodes google.protobuf.Timestamp to unix nanoseconds
+func decodeTimestamp(data []byte) (int64, error) {
+	var seconds, nanos int64
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if (field != 1 && field != 2) || wireType != pw.VARINT {
+			return false, nil
+		}
+		num, err := r.Varint()
+
+		if field == 1 {
+			seconds = int64(num)
+		} else {
+			nanos = int64(int32(num))
+		}
+		return true, err
+	})
+	return seconds*1e9 + nanos, err
+}
+
+func decodeLabelPair(data []byte) ([2]string, error) {
+	pair := [2]string{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if (field != 1 && field != 2) || wireType != pw.BYTES {
+			return false, nil
+		}
+		value, err := r.Bytes()
+		pair[field-1] = string(value)
+		return true, err
+	})
+	return pair, err
+}
@@ -0,0 +1,108 @@
+package loki
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Tags of elements of snappy block
+const (
+	_LITERAL = 0
+	_COPY_1  = 1 // copy with 1-byte offset
+	_COPY_2  = 2 // copy with 2-byte offset
+	_COPY_4  = 3 // copy with 4-byte offset
+)
+
+var errCorrupt = errors.New("snappy: corrupt input")
+
+// DecodeSnappy decodes snappy block (without framing), which length is no larger than maxLen
+func DecodeSnappy(src []byte, maxLen int) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+
+	if n <= 0 {
+		return nil, errCorrupt
+	}
+
+	if length > uint64(maxLen) {
+		return nil, errors.New("snappy: decoded block is too large")
+	}
+
+	dst := make([]byte, 0, length)
+	src = src[n:]
+
+	for len(src) > 0 {
+		tag := src[0]
+		var size, offset int
+
+		switch tag & 3 {
+		case _LITERAL:
+			size = int(tag >> 2)
+			src = src[1:]
+
+			// Sizes from 60 are stored in next 1-4 bytes
+
+			if size >= 60 {
+				bytes := size - 59
+
+				if len(src) < bytes {
+					return nil, errCorrupt
+				}
+				size = 0
+
+				for i := bytes - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				src = src[bytes:]
+			}
+			size++
+
+			if size > len(src) || len(dst)+size > int(length) {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+
+		case _COPY_1:
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			size = 4 + int(tag>>2)&7
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+
+		case _COPY_2:
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+
+		case _COPY_4:
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || len(dst)+size > int(length) {
+			return nil, errCorrupt
+		}
+
+		// Copy may overlap its output, so it's copied by bytes
+
+		start := len(dst) - offset
+
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if len(dst) != int(length) {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
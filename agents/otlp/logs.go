@@ -0,0 +1,175 @@
+package otlp
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	m "main/models"
+	"main/tools"
+)
+
+// ToLogs maps log records to logs by storages. Storage is chosen by resource attribute,
+// records of resources without storage are rejected. Too long values are cut.
+// Null items of arrays (possible in JSON) are skipped
+func (req *Request) ToLogs(storageAttr, defaultStorage string) (logs map[string][]*m.Log, rejected int) {
+	logs = map[string][]*m.Log{}
+
+	for _, rl := range req.ResourceLogs {
+		if rl == nil {
+			continue
+		}
+		attrs := map[string]string{}
+
+		for _, kv := range rl.Resource.Attributes {
+			if kv != nil {
+				attrs[kv.Key] = kv.Value.String()
+			}
+		}
+
+		storage := attrs[storageAttr]
+
+		if storage == "" {
+			storage = defaultStorage
+		}
+
+		if storage == "" {
+			for _, sl := range rl.ScopeLogs {
+				if sl == nil {
+					continue
+				}
+
+				for _, record := range sl.LogRecords {
+					if record != nil {
+						rejected++
+					}
+				}
+			}
+			continue
+		}
+
+		entity := tools.FirstNotEmpty(attrs["service.name"], "unknown_service")
+		entityID := tools.FirstNotEmpty(attrs["service.instance.id"], attrs["host.name"], "unknown")
+
+		for _, sl := range rl.ScopeLogs {
+			if sl == nil {
+				continue
+			}
+			module := tools.FirstNotEmpty(sl.Scope.Name, entity)
+
+			for _, record := range sl.LogRecords {
+				if record == nil {
+					continue
+				}
+				l := record.toLog()
+				l.Entity = tools.Cut(entity, m.MAX_VALUE_LEN)
+				l.EntityID = tools.Cut(entityID, m.MAX_VALUE_LEN)
+				l.Modules = []string{tools.Cut(module, m.MAX_VALUE_LEN)}
+				logs[storage] = append(logs[storage], l)
+			}
+		}
+	}
+	return logs, rejected
+}
+
+func (record *LogRecord) toLog() *m.Log {
+	l := &m.Log{
+		Level:   severityToLevel(record.SeverityNumber),
+		Message: tools.FirstNotEmpty(tools.Cut(record.Body.String(), m.MAX_MESSAGE_LEN), "-"),
+		Traces:  []string{},
+	}
+
+	// Timestamp in milliseconds
+
+	nanos := uint64(record.TimeUnixNano)
+
+	if nanos == 0 {
+		nanos = uint64(record.ObservedTimeUnixNano)
+	}
+	l.Timestamp = int64(nanos / uint64(time.Millisecond))
+
+	if l.Timestamp == 0 {
+		l.Timestamp = time.Now().UnixMilli()
+	}
+
+	// Traces
+
+	for _, id := range []string{record.TraceID, record.SpanID} {
+		if id != "" {
+			l.Traces = append(l.Traces, tools.Cut(strings.ToLower(id), m.MAX_VALUE_LEN))
+		}
+	}
+
+	if len(l.Traces) == 0 {
+		l.Traces = append(l.Traces, "-")
+	}
+
+	// True flags and string arrays are labels, other attributes are fields
+
+	attrs := make([]*KeyValue, 0, len(record.Attributes))
+
+	for _, kv := range record.Attributes {
+		if kv != nil {
+			attrs = append(attrs, kv)
+		}
+	}
+
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Key < attrs[j].Key
+	})
+
+	for _, kv := range attrs {
+		switch val := kv.Value.Native().(type) {
+		case bool:
+			if val {
+				l.Labels = addLabel(l.Labels, kv.Key)
+			}
+		case []any:
+			for _, item := range val {
+				if s, ok := item.(string); ok {
+					l.Labels = addLabel(l.Labels, s)
+				}
+			}
+		default:
+			key, value := tools.Cut(kv.Key, m.MAX_VALUE_LEN), tools.Cut(kv.Value.String(), m.MAX_VALUE_LEN)
+
+			if key == "" || value == "" || len(l.Fields) == m.MAX_ITEMS {
+				continue
+			}
+
+			if l.Fields == nil {
+				l.Fields = map[string]string{}
+			}
+			l.Fields[key] = value
+		}
+	}
+	return l
+}
+
+// severityToLevel maps severity number of OTel (1-24) to level of log (0-7).
+// Unspecified severity is info
+func severityToLevel(severity int32) byte {
+	switch {
+	case severity <= 0:
+		return 4
+	case severity <= 4: // trace
+		return 0
+	case severity <= 8: // debug
+		return 1
+	case severity <= 12: // info
+		return 4
+	case severity <= 16: // warn
+		return 5
+	case severity <= 20: // error
+		return 6
+	default: // fatal
+		return 7
+	}
+}
+
+func addLabel(labels []string, label string) []string {
+	if label == "" || len(labels) == m.MAX_ITEMS {
+		return labels
+	}
+	return append(labels, tools.Cut(label, m.MAX_VALUE_LEN))
+}
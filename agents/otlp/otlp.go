@@ -0,0 +1,148 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Request is ExportLogsServiceRequest of OTLP. JSON keys are the same as in OTLP/JSON
+type Request struct {
+	ResourceLogs []*ResourceLogs `json:"resourceLogs"`
+}
+
+type ResourceLogs struct {
+	Resource  Resource     `json:"resource"`
+	ScopeLogs []*ScopeLogs `json:"scopeLogs"`
+}
+
+type Resource struct {
+	Attributes []*KeyValue `json:"attributes"`
+}
+
+type ScopeLogs struct {
+	Scope      Scope        `json:"scope"`
+	LogRecords []*LogRecord `json:"logRecords"`
+}
+
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type LogRecord struct {
+	TimeUnixNano         Uint64      `json:"timeUnixNano"`
+	ObservedTimeUnixNano Uint64      `json:"observedTimeUnixNano"`
+	SeverityNumber       int32       `json:"severityNumber"`
+	Body                 *AnyValue   `json:"body"`
+	Attributes           []*KeyValue `json:"attributes"`
+	TraceID              string      `json:"traceId"` // hex
+	SpanID               string      `json:"spanId"`  // hex
+}
+
+type KeyValue struct {
+	Key   string    `json:"key"`
+	Value *AnyValue `json:"value"`
+}
+
+type ArrayValue struct {
+	Values []*AnyValue `json:"values"`
+}
+
+type KeyValueList struct {
+	Values []*KeyValue `json:"values"`
+}
+
+// AnyValue has one of values
+type AnyValue struct {
+	StringValue *string       `json:"stringValue,omitempty"`
+	BoolValue   *bool         `json:"boolValue,omitempty"`
+	IntValue    *Int64        `json:"intValue,omitempty"`
+	DoubleValue *float64      `json:"doubleValue,omitempty"`
+	ArrayValue  *ArrayValue   `json:"arrayValue,omitempty"`
+	KvlistValue *KeyValueList `json:"kvlistValue,omitempty"`
+	BytesValue  []byte        `json:"bytesValue,omitempty"`
+}
+
+// Native returns value as Go value (string, bool, int64, float64, []any, map[string]any)
+func (v *AnyValue) Native() any {
+	switch {
+	case v == nil:
+		return nil
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		arr := make([]any, len(v.ArrayValue.Values))
+
+		for i, item := range v.ArrayValue.Values {
+			arr[i] = item.Native()
+		}
+		return arr
+	case v.KvlistValue != nil:
+		kv := make(map[string]any, len(v.KvlistValue.Values))
+
+		for _, item := range v.KvlistValue.Values {
+			if item != nil {
+				kv[item.Key] = item.Value.Native()
+			}
+		}
+		return kv
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	}
+	return nil
+}
+
+// String returns string, number or bool as is, other values as JSON
+func (v *AnyValue) String() string {
+	switch val := v.Native().(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+// Int64 is integer, which is string or number in JSON
+type Int64 int64
+
+func (n *Int64) UnmarshalJSON(data []byte) error {
+	num, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	*n = Int64(num)
+	return err
+}
+
+// Uint64 is unsigned integer, which is string or number in JSON
+type Uint64 uint64
+
+func (n *Uint64) UnmarshalJSON(data []byte) error {
+	num, err := strconv.ParseUint(strings.Trim(string(data), `"`), 10, 64)
+	*n = Uint64(num)
+	return err
+}
+
+// Response is ExportLogsServiceResponse of OTLP
+type Response struct {
+	PartialSuccess *PartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+type PartialSuccess struct {
+	RejectedLogRecords int64  `json:"rejectedLogRecords"`
+	ErrorMessage       string `json:"errorMessage"`
+}
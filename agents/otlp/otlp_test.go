@@ -0,0 +1,130 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pw "main/agents/protowire"
+)
+
+func protoBytes(field int, value []byte) []byte {
+	data := binary.AppendUvarint(nil, uint64(field<<3|pw.BYTES))
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func protoString(field int, value string) []byte {
+	return protoBytes(field, []byte(value))
+}
+
+func protoKV(key string, value []byte) []byte {
+	return append(protoString(1, key), protoBytes(2, value)...)
+}
+
+func TestUnmarshalProto(t *testing.T) {
+	// LogRecord
+
+	record := binary.AppendUvarint(nil, 1<<3|pw.FIXED64)
+	record = binary.LittleEndian.AppendUint64(record, 1700000000123456789)
+	record = binary.AppendUvarint(record, 2<<3|pw.VARINT)
+	record = binary.AppendUvarint(record, 17)
+	record = append(record, protoBytes(5, protoString(1, "Payment failed"))...)
+	record = append(record, protoBytes(6, protoKV("order", binary.AppendUvarint([]byte{3 << 3}, 42)))...)
+	record = append(record, protoBytes(6, protoKV("retry", []byte{2 << 3, 1}))...)
+	record = append(record, protoBytes(9, []byte{0xAB, 0xCD})...)
+	record = append(record, protoBytes(10, []byte{0x01})...)
+	record = append(record, protoString(99, "unknown field")...)
+
+	scopeLogs := append(protoBytes(1, protoString(1, "payments")), protoBytes(2, record)...)
+	resource := protoBytes(1, protoKV("service.name", protoString(1, "shop")))
+	resource = append(resource, protoBytes(1, protoKV("host.name", protoString(1, "node-1")))...)
+	resourceLogs := append(protoBytes(1, resource), protoBytes(2, scopeLogs)...)
+
+	req, err := UnmarshalProto(protoBytes(1, resourceLogs))
+	assert.NoError(t, err)
+
+	logs, rejected := req.ToLogs("service.name", "")
+	assert.Equal(t, 0, rejected)
+	assert.Len(t, logs["shop"], 1)
+
+	l := logs["shop"][0]
+	assert.Equal(t, int64(1700000000123), l.Timestamp)
+	assert.Equal(t, byte(6), l.Level)
+	assert.Equal(t, "Payment failed", l.Message)
+	assert.Equal(t, "shop", l.Entity)
+	assert.Equal(t, "node-1", l.EntityID)
+	assert.Equal(t, []string{"payments"}, l.Modules)
+	assert.Equal(t, []string{"abcd", "01"}, l.Traces)
+	assert.Equal(t, []string{"retry"}, l.Labels)
+	assert.Equal(t, map[string]string{"order": "42"}, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	// Truncated message
+
+	_, err = UnmarshalProto(protoBytes(1, resourceLogs)[:20])
+	assert.Error(t, err)
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	body := `{"resourceLogs": [
+		{
+			"resource": {"attributes": [{"key": "tenant", "value": {"stringValue": "acme"}}]},
+			"scopeLogs": [{"logRecords": [
+				{"observedTimeUnixNano": "1700000000000000000", "body": {"intValue": "5"}}
+			]}]
+		},
+		{
+			"scopeLogs": [{"logRecords": [{"severityNumber": 9}, {"severityNumber": 13}]}]
+		}
+	]}`
+
+	req := &Request{}
+	assert.NoError(t, json.Unmarshal([]byte(body), req))
+
+	logs, rejected := req.ToLogs("tenant", "")
+	assert.Equal(t, 2, rejected, "resource without storage")
+	assert.Len(t, logs["acme"], 1)
+
+	l := logs["acme"][0]
+	assert.Equal(t, int64(1700000000000), l.Timestamp)
+	assert.Equal(t, byte(4), l.Level)
+	assert.Equal(t, "5", l.Message)
+	assert.Equal(t, "unknown_service", l.Entity)
+	assert.Equal(t, "unknown", l.EntityID)
+	assert.Equal(t, []string{"-"}, l.Traces)
+
+	logs, rejected = req.ToLogs("tenant", "other")
+	assert.Equal(t, 0, rejected)
+	assert.Len(t, logs["other"], 2)
+	assert.Equal(t, byte(5), logs["other"][1].Level)
+
+	// Null items are skipped
+
+	body = `{"resourceLogs": [null, {
+		"resource": {"attributes": [null]},
+		"scopeLogs": [null, {"logRecords": [null, {
+			"body": {"kvlistValue": {"values": [null]}}, "attributes": [null, {"key": "a", "value": {"stringValue": "b"}}]
+		}]}]
+	}]}`
+
+	req = &Request{}
+	assert.NoError(t, json.Unmarshal([]byte(body), req))
+
+	logs, rejected = req.ToLogs("tenant", "other")
+	assert.Equal(t, 0, rejected)
+
+	if assert.Len(t, logs["other"], 1, "null items") {
+		assert.Equal(t, map[string]string{"a": "b"}, logs["other"][0].Fields)
+	}
+
+	logs, rejected = req.ToLogs("tenant", "")
+	assert.Equal(t, 1, rejected, "null items without storage")
+
+	// Response
+
+	resp := &Response{PartialSuccess: &PartialSuccess{RejectedLogRecords: 2, ErrorMessage: "x"}}
+	assert.Equal(t, []byte{1<<3 | pw.BYTES, 5, 1 << 3, 2, 2<<3 | pw.BYTES, 1, 'x'}, resp.MarshalProto())
+}
@@ -0,0 +1,272 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+
+	pw "main/agents/protowire"
+)
+
+// UnmarshalProto decodes ExportLogsServiceRequest from protobuf
+func UnmarshalProto(data []byte) (*Request, error) {
+	req := &Request{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if field == 1 && wireType == pw.BYTES {
+			rl, err := pw.SubMessage(r, decodeResourceLogs)
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+			return true, err
+		}
+		return false, nil
+	})
+	return req, err
+}
+
+func decodeResourceLogs(data []byte) (*ResourceLogs, error) {
+	rl := &ResourceLogs{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if wireType != pw.BYTES {
+			return false, nil
+		}
+
+		switch field {
+		case 1:
+			resource, err := pw.SubMessage(r, decodeResource)
+			rl.Resource = resource
+			return true, err
+		case 2:
+			sl, err := pw.SubMessage(r, decodeScopeLogs)
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+			return true, err
+		}
+		return false, nil
+	})
+	return rl, err
+}
+
+func decodeResource(data []byte) (Resource, error) {
+	resource := Resource{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if field == 1 && wireType == pw.BYTES {
+			kv, err := pw.SubMessage(r, decodeKeyValue)
+			resource.Attributes = append(resource.Attributes, kv)
+			return true, err
+		}
+		return false, nil
+	})
+	return resource, err
+}
+
+func decodeScopeLogs(data []byte) (*ScopeLogs, error) {
+	sl := &ScopeLogs{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if wireType != pw.BYTES {
+			return false, nil
+		}
+
+		switch field {
+		case 1:
+			scope, err := pw.SubMessage(r, decodeScope)
+			sl.Scope = scope
+			return true, err
+		case 2:
+			record, err := pw.SubMessage(r, decodeLogRecord)
+			sl.LogRecords = append(sl.LogRecords, record)
+			return true, err
+		}
+		return false, nil
+	})
+	return sl, err
+}
+
+func decodeScope(data []byte) (Scope, error) {
+	scope := Scope{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if wireType != pw.BYTES || (field != 1 && field != 2) {
+			return false, nil
+		}
+		value, err := r.Bytes()
+
+		if field == 1 {
+			scope.Name = string(value)
+		} else {
+			scope.Version = string(value)
+		}
+		return true, err
+	})
+	return scope, err
+}
+
+func decodeLogRecord(data []byte) (*LogRecord, error) {
+	record := &LogRecord{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		switch {
+		case (field == 1 || field == 11) && wireType == pw.FIXED64:
+			num, err := r.Fixed64()
+
+			if field == 1 {
+				record.TimeUnixNano = Uint64(num)
+			} else {
+				record.ObservedTimeUnixNano = Uint64(num)
+			}
+			return true, err
+
+		case field == 2 && wireType == pw.VARINT:
+			num, err := r.Varint()
+			record.SeverityNumber = int32(num)
+			return true, err
+
+		case field == 5 && wireType == pw.BYTES:
+			body, err := pw.SubMessage(r, decodeAnyValue)
+			record.Body = body
+			return true, err
+
+		case field == 6 && wireType == pw.BYTES:
+			kv, err := pw.SubMessage(r, decodeKeyValue)
+			record.Attributes = append(record.Attributes, kv)
+			return true, err
+
+		case (field == 9 || field == 10) && wireType == pw.BYTES:
+			id, err := r.Bytes()
+
+			if field == 9 {
+				record.TraceID = hex.EncodeToString(id)
+			} else {
+				record.SpanID = hex.EncodeToString(id)
+			}
+			return true, err
+		}
+		return false, nil
+	})
+	return record, err
+}
+
+func decodeKeyValue(data []byte) (*KeyValue, error) {
+	kv := &KeyValue{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if wireType != pw.BYTES {
+			return false, nil
+		}
+
+		switch field {
+		case 1:
+			key, err := r.Bytes()
+			kv.Key = string(key)
+			return true, err
+		case 2:
+			value, err := pw.SubMessage(r, decodeAnyValue)
+			kv.Value = value
+			return true, err
+		}
+		return false, nil
+	})
+	return kv, err
+}
+
+func decodeAnyValue(data []byte) (*AnyValue, error) {
+	v := &AnyValue{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		switch {
+		case field == 1 && wireType == pw.BYTES:
+			str, err := r.Bytes()
+			s := string(str)
+			v.StringValue = &s
+			return true, err
+
+		case field == 2 && wireType == pw.VARINT:
+			num, err := r.Varint()
+			b := num != 0
+			v.BoolValue = &b
+			return true, err
+
+		case field == 3 && wireType == pw.VARINT:
+			num, err := r.Varint()
+			n := Int64(num)
+			v.IntValue = &n
+			return true, err
+
+		case field == 4 && wireType == pw.FIXED64:
+			num, err := r.Fixed64()
+			f := math.Float64frombits(num)
+			v.DoubleValue = &f
+			return true, err
+
+		case field == 5 && wireType == pw.BYTES:
+			arr, err := pw.SubMessage(r, decodeArrayValue)
+			v.ArrayValue = arr
+			return true, err
+
+		case field == 6 && wireType == pw.BYTES:
+			kvList, err := pw.SubMessage(r, decodeKeyValueList)
+			v.KvlistValue = kvList
+			return true, err
+
+		case field == 7 && wireType == pw.BYTES:
+			b, err := r.Bytes()
+			v.BytesValue = append([]byte{}, b...)
+			return true, err
+		}
+		return false, nil
+	})
+	return v, err
+}
+
+func decodeArrayValue(data []byte) (*ArrayValue, error) {
+	arr := &ArrayValue{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if field == 1 && wireType == pw.BYTES {
+			item, err := pw.SubMessage(r, decodeAnyValue)
+			arr.Values = append(arr.Values, item)
+			return true, err
+		}
+		return false, nil
+	})
+	return arr, err
+}
+
+func decodeKeyValueList(data []byte) (*KeyValueList, error) {
+	kvList := &KeyValueList{}
+
+	err := pw.ReadMessage(data, func(r *pw.Reader, field, wireType int) (bool, error) {
+		if field == 1 && wireType == pw.BYTES {
+			kv, err := pw.SubMessage(r, decodeKeyValue)
+			kvList.Values = append(kvList.Values, kv)
+			return true, err
+		}
+		return false, nil
+	})
+	return kvList, err
+}
+
+// MarshalProto encodes ExportLogsServiceResponse to protobuf
+func (resp *Response) MarshalProto() []byte {
+	if resp.PartialSuccess == nil {
+		return []byte{}
+	}
+
+	ps := []byte{}
+
+	if resp.PartialSuccess.RejectedLogRecords != 0 {
+		ps = binary.AppendUvarint(ps, 1<<3|pw.VARINT)
+		ps = binary.AppendUvarint(ps, uint64(resp.PartialSuccess.RejectedLogRecords))
+	}
+
+	if resp.PartialSuccess.ErrorMessage != "" {
+		ps = binary.AppendUvarint(ps, 2<<3|pw.BYTES)
+		ps = binary.AppendUvarint(ps, uint64(len(resp.PartialSuccess.ErrorMessage)))
+		ps = append(ps, resp.PartialSuccess.ErrorMessage...)
+	}
+
+	data := binary.AppendUvarint(nil, 1<<3|pw.BYTES)
+	data = binary.AppendUvarint(data, uint64(len(ps)))
+	return append(data, ps...)
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Common grok patterns, other text of grok pattern is regex
+var _grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"POSINT":            `\b[1-9]\d*\b`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"BASE10NUM":         `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:[0-9A-Fa-f]*:[0-9A-Fa-f:.]+|(?:\d{1,3}\.){3}\d{1,3})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":          `(?:[0-9A-Fa-f]*:[0-9A-Fa-f:.]+|[0-9A-Za-z][0-9A-Za-z.-]*)`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"LOGLEVEL":          `(?i:trace|debug|info|information|notice|warn|warning|error|err|crit|critical|fatal|alert|emerg|emergency|panic)`,
+	"PATH":              `(?:/[^\s/]*)+`,
+	"URIPATH":           `/[^\s?#]*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"HTTPDATE":          `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+}
+
+// %{PATTERN}, %{PATTERN:name} or %{PATTERN:name:type}, type is ignored
+var _grokRef = regexp.MustCompile(`%\{(\w+)(?::(\w+))?(?::\w+)?\}`)
+
+// grokToRegex replaces references to patterns by groups, which are named if reference has name
+func grokToRegex(grok string) (string, error) {
+	var err error
+
+	regex := _grokRef.ReplaceAllStringFunc(grok, func(ref string) string {
+		match := _grokRef.FindStringSubmatch(ref)
+		pattern, ok := _grokPatterns[match[1]]
+
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern '%s'", match[1])
+			return ref
+		}
+
+		if match[2] == "" {
+			return "(?:" + pattern + ")"
+		}
+		return "(?P<" + match[2] + ">" + pattern + ")"
+	})
+	return regex, err
+}
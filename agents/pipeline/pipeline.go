@@ -0,0 +1,399 @@
+// Package pipeline transforms received logs of storage by steps of its pipeline
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	conds "main/agents/conditions"
+	aerr "main/app_errors"
+	m "main/models"
+	"main/tools"
+)
+
+const (
+	_MAX_STEPS     = 100 // max steps of pipeline including nested ones
+	_FIELDS_PREFIX = m.C_FIELDS + "."
+	_LEVEL_FIELD   = _FIELDS_PREFIX + m.C_LEVEL // default source of level
+)
+
+type step func(trace *sl.Trace, l *m.Log)
+
+// Pipeline is compiled definition of pipeline, its steps are applied to each log in order
+type Pipeline struct {
+	def   *m.Pipeline
+	steps []step
+}
+
+// Compile checks steps of definition and prepares regexes and conditions
+func Compile(trace *sl.Trace, def *m.Pipeline) (*Pipeline, error) {
+	defer trace.AddModule("", "Compile")()
+
+	c := &compiler{trace: trace}
+	steps, err := c.compile(def.Steps, "")
+
+	if err != nil {
+		trace.NOTE(nil, err.Error())
+		return nil, err
+	}
+	return &Pipeline{def: def, steps: steps}, nil
+}
+
+// Definition returns definition, which pipeline is compiled from
+func (p *Pipeline) Definition() *m.Pipeline {
+	return p.def
+}
+
+// Apply transforms logs in place
+func (p *Pipeline) Apply(trace *sl.Trace, logs ...*m.Log) {
+	defer trace.AddModule("_Pipeline", "Apply")()
+
+	for _, l := range logs {
+		if l == nil {
+			continue
+		}
+
+		for _, s := range p.steps {
+			s(trace, l)
+		}
+	}
+}
+
+// Columns
+
+// column is string column of log or key of fields
+type column struct {
+	name string // name of column, empty for field
+	key  string
+}
+
+func parseColumn(s string) (column, bool) {
+	switch s {
+	case m.C_MESSAGE, m.C_ENTITY, m.C_ENTITY_ID:
+		return column{name: s}, true
+	}
+
+	if key, ok := strings.CutPrefix(s, _FIELDS_PREFIX); ok && key != "" && len(key) <= m.MAX_VALUE_LEN {
+		return column{key: key}, true
+	}
+	return column{}, false
+}
+
+func (c column) get(l *m.Log) string {
+	switch c.name {
+	case m.C_MESSAGE:
+		return l.Message
+	case m.C_ENTITY:
+		return l.Entity
+	case m.C_ENTITY_ID:
+		return l.EntityID
+	}
+	return l.Fields[c.key]
+}
+
+// set sets value cut to max length of column. Empty value removes field,
+// new field isn't added to log with max number of fields
+func (c column) set(l *m.Log, value string) {
+	switch c.name {
+	case m.C_MESSAGE:
+		l.Message = tools.Cut(value, m.MAX_MESSAGE_LEN)
+		return
+	case m.C_ENTITY:
+		l.Entity = tools.Cut(value, m.MAX_VALUE_LEN)
+		return
+	case m.C_ENTITY_ID:
+		l.EntityID = tools.Cut(value, m.MAX_VALUE_LEN)
+		return
+	}
+
+	if value == "" {
+		delete(l.Fields, c.key)
+		return
+	}
+
+	if _, ok := l.Fields[c.key]; !ok && len(l.Fields) >= m.MAX_ITEMS {
+		return
+	}
+
+	if l.Fields == nil {
+		l.Fields = map[string]string{}
+	}
+	l.Fields[c.key] = tools.Cut(value, m.MAX_VALUE_LEN)
+}
+
+// Compiler
+
+type compiler struct {
+	trace *sl.Trace
+	count int // compiled steps
+}
+
+// compile compiles steps, 'path' is position of parent step for errors
+func (c *compiler) compile(defs []*m.PipelineStep, path string) ([]step, error) {
+	steps := make([]step, 0, len(defs))
+
+	for i, def := range defs {
+		stepPath := path + strconv.Itoa(i+1)
+		c.count++
+
+		if c.count > _MAX_STEPS {
+			return nil, aerr.NewAppErr(aerr.BadReq, "Number of steps of pipeline is more than ", _MAX_STEPS)
+		}
+
+		if def == nil {
+			return nil, aerr.NewAppErr(aerr.BadReq, "Step ", stepPath, " is null")
+		}
+
+		s, err := c.compileStep(def, stepPath)
+
+		// Error of nested step already has its path
+		if appErr, ok := err.(*aerr.AppErr); ok {
+			return nil, appErr
+		}
+
+		if err != nil {
+			return nil, aerr.NewAppErr(aerr.BadReq, "Step ", stepPath, " (", def.Type, "): ", err.Error())
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+func (c *compiler) compileStep(def *m.PipelineStep, path string) (step, error) {
+	switch def.Type {
+	case m.STEP_EXTRACT:
+		return compileExtract(def)
+	case m.STEP_RENAME:
+		return compileRename(def)
+	case m.STEP_LABELS:
+		return compileLabels(def)
+	case m.STEP_LEVEL:
+		return compileLevel(def)
+	case m.STEP_DROP:
+		return compileDrop(def)
+	case m.STEP_IF:
+		return c.compileIf(def, path)
+	}
+	return nil, fmt.Errorf("unknown type, it must be one of: %s, %s, %s, %s, %s, %s",
+		m.STEP_EXTRACT, m.STEP_RENAME, m.STEP_LABELS, m.STEP_LEVEL, m.STEP_DROP, m.STEP_IF)
+}
+
+// Steps
+
+// compileExtract makes step, which matches column by regex (or grok pattern) and sets values of named groups.
+// Groups named as columns set them, other groups set fields
+func compileExtract(def *m.PipelineStep) (step, error) {
+	from, ok := parseColumn(tools.FirstNotEmpty(def.From, m.C_MESSAGE))
+
+	if !ok {
+		return nil, fmt.Errorf("incorrect column '%s' in 'from'", def.From)
+	}
+
+	if (def.Regex == "") == (def.Grok == "") {
+		return nil, fmt.Errorf("one of 'regex' and 'grok' must be specified")
+	}
+
+	pattern := def.Regex
+	var err error
+
+	if def.Grok != "" {
+		if pattern, err = grokToRegex(def.Grok); err != nil {
+			return nil, err
+		}
+	}
+
+	regex, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[int]column{}
+
+	for i, name := range regex.SubexpNames() {
+		if name == "" {
+			continue
+		}
+
+		target, ok := parseColumn(name)
+
+		if !ok {
+			target, ok = parseColumn(_FIELDS_PREFIX + name)
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("incorrect name of group '%s'", name)
+		}
+		targets[i] = target
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("regex must have named groups")
+	}
+
+	return func(trace *sl.Trace, l *m.Log) {
+		match := regex.FindStringSubmatch(from.get(l))
+
+		for i, target := range targets {
+			if i < len(match) && match[i] != "" {
+				target.set(l, match[i])
+			}
+		}
+	}, nil
+}
+
+// compileRename makes step, which moves value from one column to other
+func compileRename(def *m.PipelineStep) (step, error) {
+	from, ok := parseColumn(def.From)
+
+	if !ok {
+		return nil, fmt.Errorf("incorrect column '%s' in 'from'", def.From)
+	}
+
+	to, ok := parseColumn(def.To)
+
+	if !ok {
+		return nil, fmt.Errorf("incorrect column '%s' in 'to'", def.To)
+	}
+
+	if from == to {
+		return nil, fmt.Errorf("'from' and 'to' are the same column")
+	}
+
+	return func(trace *sl.Trace, l *m.Log) {
+		value := from.get(l)
+
+		if value == "" {
+			return
+		}
+		to.set(l, value)
+		from.set(l, "")
+	}, nil
+}
+
+// compileLabels makes step, which adds missing labels
+func compileLabels(def *m.PipelineStep) (step, error) {
+	if len(def.Labels) == 0 || len(def.Labels) > m.MAX_ITEMS {
+		return nil, fmt.Errorf("number of 'labels' must be from 1 to %d", m.MAX_ITEMS)
+	}
+
+	for _, label := range def.Labels {
+		if label == "" || len(label) > m.MAX_VALUE_LEN {
+			return nil, fmt.Errorf("number of characters in the all 'labels' must be from 1 to %d", m.MAX_VALUE_LEN)
+		}
+	}
+
+	return func(trace *sl.Trace, l *m.Log) {
+		for _, label := range def.Labels {
+			if !tools.Contains(label, l.Labels) {
+				l.Labels = append(l.Labels, label)
+			}
+		}
+	}, nil
+}
+
+// compileLevel makes step, which sets level by name (or number) from column. Names of 'levels'
+// are checked before known ones. Field of recognized level is removed
+func compileLevel(def *m.PipelineStep) (step, error) {
+	from, ok := parseColumn(tools.FirstNotEmpty(def.From, _LEVEL_FIELD))
+
+	if !ok {
+		return nil, fmt.Errorf("incorrect column '%s' in 'from'", def.From)
+	}
+
+	levels := make(map[string]byte, len(def.Levels))
+
+	for name, level := range def.Levels {
+		if level > 7 {
+			return nil, fmt.Errorf("level of '%s' must be in range 0-7", name)
+		}
+		levels[strings.ToLower(name)] = level
+	}
+
+	return func(trace *sl.Trace, l *m.Log) {
+		name := strings.TrimSpace(from.get(l))
+
+		if name == "" {
+			return
+		}
+
+		level, ok := levels[strings.ToLower(name)]
+
+		if !ok {
+			level, ok = m.GetLevel(name)
+		}
+
+		if num, err := strconv.ParseUint(name, 10, 8); !ok && err == nil && num <= 7 {
+			level, ok = byte(num), true
+		}
+
+		if !ok {
+			return
+		}
+		l.Level = level
+
+		if from.name == "" {
+			from.set(l, "")
+		}
+	}, nil
+}
+
+// compileDrop makes step, which removes fields by keys
+func compileDrop(def *m.PipelineStep) (step, error) {
+	if len(def.Fields) == 0 {
+		return nil, fmt.Errorf("'fields' not specified")
+	}
+
+	return func(trace *sl.Trace, l *m.Log) {
+		for _, key := range def.Fields {
+			delete(l.Fields, key)
+		}
+	}, nil
+}
+
+// compileIf makes step, which applies 'then' steps to logs matching condition and 'else' steps to others.
+// Condition is same as 'where' of search, log with error of checking doesn't match
+func (c *compiler) compileIf(def *m.PipelineStep, path string) (step, error) {
+	if def.Where == "" {
+		return nil, fmt.Errorf("'where' not specified")
+	}
+
+	if len(def.Then) == 0 && len(def.Else) == 0 {
+		return nil, fmt.Errorf("'then' or 'else' must be specified")
+	}
+
+	cond, err := conds.ParseCondition(c.trace, def.Where, def.WhereValues, nil, nil)
+
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+
+	then, err := c.compile(def.Then, path+".then.")
+
+	if err != nil {
+		return nil, err
+	}
+
+	otherwise, err := c.compile(def.Else, path+".else.")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(trace *sl.Trace, l *m.Log) {
+		steps := otherwise
+
+		if ok, err := cond.Check(trace, l); ok && err == nil {
+			steps = then
+		}
+
+		for _, s := range steps {
+			s(trace, l)
+		}
+	}, nil
+}
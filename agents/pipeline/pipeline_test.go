@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/stretchr/testify/assert"
+
+	m "main/models"
+	tt "main/test_tools"
+)
+
+func TestPipeline(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	p, err := Compile(trace, &m.Pipeline{Storage: "app", Steps: []*m.PipelineStep{
+		{Type: m.STEP_EXTRACT, Grok: `^%{IP:client} %{WORD:method} %{URIPATH:path} %{INT:status} %{GREEDYDATA:message}$`},
+		{Type: m.STEP_RENAME, From: "fields.svc", To: m.C_ENTITY},
+		{Type: m.STEP_LEVEL, From: "fields.severity", Levels: map[string]byte{"Sev3": 6}},
+		{Type: m.STEP_DROP, Fields: []string{"secret"}},
+		{Type: m.STEP_IF, Where: "entity == ?0", WhereValues: []any{"api"},
+			Then: []*m.PipelineStep{{Type: m.STEP_LABELS, Labels: []string{"http", "api"}}},
+			Else: []*m.PipelineStep{{Type: m.STEP_LABELS, Labels: []string{"other"}}},
+		},
+	}})
+	assert.NoError(t, err)
+
+	l1 := &m.Log{
+		Entity:  "unknown",
+		Message: "10.0.0.1 GET /users 500 Internal error",
+		Labels:  []string{"api"},
+		Fields:  map[string]string{"svc": "api", "severity": "SEV3", "secret": "x"},
+	}
+	l2 := &m.Log{
+		Entity:  "worker",
+		Message: "Job done",
+		Fields:  map[string]string{"severity": "warning"},
+	}
+	p.Apply(trace, l1, nil, l2)
+
+	assert.Equal(t, &m.Log{
+		Level:   6,
+		Entity:  "api",
+		Message: "Internal error",
+		Labels:  []string{"api", "http"},
+		Fields:  map[string]string{"client": "10.0.0.1", "method": "GET", "path": "/users", "status": "500"},
+	}, l1)
+
+	assert.Equal(t, &m.Log{
+		Level:   5,
+		Entity:  "worker",
+		Message: "Job done",
+		Labels:  []string{"other"},
+		Fields:  map[string]string{},
+	}, l2, "not matched regex and missing fields are skipped")
+
+	// Unknown level is kept in field, number is level
+
+	p, err = Compile(trace, &m.Pipeline{Steps: []*m.PipelineStep{
+		{Type: m.STEP_EXTRACT, From: "fields.raw", Regex: `^(?P<entity_id>\w+):(?P<long>.*)$`},
+		{Type: m.STEP_LEVEL},
+	}})
+	assert.NoError(t, err)
+
+	l1 = &m.Log{Fields: map[string]string{"level": "loud"}}
+	l2 = &m.Log{Fields: map[string]string{"level": "7", "raw": "host:" + strings.Repeat("x", 60)}}
+	p.Apply(trace, l1, l2)
+
+	assert.Equal(t, byte(0), l1.Level)
+	assert.Equal(t, "loud", l1.Fields["level"])
+	assert.Equal(t, byte(7), l2.Level)
+	assert.Equal(t, "host", l2.EntityID)
+	assert.Len(t, l2.Fields["long"], 50, "value is cut")
+
+	// Invalid steps
+
+	for _, step := range []*m.PipelineStep{
+		nil,
+		{Type: "upper"},
+		{Type: m.STEP_EXTRACT},
+		{Type: m.STEP_EXTRACT, Regex: `\w+`},
+		{Type: m.STEP_EXTRACT, Regex: `(?P<x>`},
+		{Type: m.STEP_EXTRACT, Grok: `%{NOPE:x}`},
+		{Type: m.STEP_EXTRACT, From: "level", Regex: `(?P<x>\w+)`},
+		{Type: m.STEP_RENAME, From: "fields.a", To: "fields.a"},
+		{Type: m.STEP_RENAME, From: "fields.", To: "message"},
+		{Type: m.STEP_LABELS},
+		{Type: m.STEP_LEVEL, Levels: map[string]byte{"x": 8}},
+		{Type: m.STEP_DROP},
+		{Type: m.STEP_IF, Where: "level > ?0", WhereValues: []any{3}},
+		{Type: m.STEP_IF, Where: "level >", Then: []*m.PipelineStep{{Type: m.STEP_DROP, Fields: []string{"a"}}}},
+		{Type: m.STEP_IF, Where: "level > ?0", WhereValues: []any{3}, Then: []*m.PipelineStep{{Type: m.STEP_DROP}}},
+	} {
+		_, err = Compile(trace, &m.Pipeline{Steps: []*m.PipelineStep{step}})
+		assert.Error(t, err, step)
+	}
+
+	steps := make([]*m.PipelineStep, _MAX_STEPS+1)
+
+	for i := range steps {
+		steps[i] = &m.PipelineStep{Type: m.STEP_DROP, Fields: []string{"a"}}
+	}
+	_, err = Compile(trace, &m.Pipeline{Steps: steps})
+	assert.Error(t, err)
+}
+
+func TestGrokToRegex(t *testing.T) {
+	regex, err := grokToRegex(`%{WORD:method} %{NUMBER:ms:float} %{NOTSPACE}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `(?P<method>\b\w+\b) (?P<ms>[+-]?(?:\d+(?:\.\d*)?|\.\d+)) (?:\S+)`, regex)
+}
@@ -0,0 +1,123 @@
+// Package protowire decodes protobuf wire format. Messages are decoded by handlers of fields,
+// unknown fields are skipped
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	VARINT  = 0
+	FIXED64 = 1
+	BYTES   = 2
+	FIXED32 = 5
+)
+
+var ErrTruncated = errors.New("message is truncated")
+
+// Reader reads fields of message
+type Reader struct {
+	data []byte
+	i    int
+}
+
+func (r *Reader) More() bool {
+	return r.i < len(r.data)
+}
+
+func (r *Reader) Varint() (uint64, error) {
+	num, n := binary.Uvarint(r.data[r.i:])
+
+	if n <= 0 {
+		return 0, ErrTruncated
+	}
+	r.i += n
+	return num, nil
+}
+
+func (r *Reader) Fixed64() (uint64, error) {
+	if r.i+8 > len(r.data) {
+		return 0, ErrTruncated
+	}
+	num := binary.LittleEndian.Uint64(r.data[r.i:])
+	r.i += 8
+	return num, nil
+}
+
+func (r *Reader) Bytes() ([]byte, error) {
+	length, err := r.Varint()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length > uint64(len(r.data)-r.i) {
+		return nil, ErrTruncated
+	}
+	data := r.data[r.i : r.i+int(length)]
+	r.i += int(length)
+	return data, nil
+}
+
+// Field returns number and wire type of next field
+func (r *Reader) Field() (int, int, error) {
+	key, err := r.Varint()
+	return int(key >> 3), int(key & 7), err
+}
+
+func (r *Reader) Skip(wireType int) (err error) {
+	switch wireType {
+	case VARINT:
+		_, err = r.Varint()
+	case FIXED64:
+		_, err = r.Fixed64()
+	case BYTES:
+		_, err = r.Bytes()
+	case FIXED32:
+		if r.i+4 > len(r.data) {
+			return ErrTruncated
+		}
+		r.i += 4
+	default:
+		return errors.New("unknown wire type")
+	}
+	return err
+}
+
+// ReadMessage calls handler for every field, handler returns false if field is unknown
+func ReadMessage(data []byte, handler func(r *Reader, field, wireType int) (bool, error)) error {
+	r := &Reader{data: data}
+
+	for r.More() {
+		field, wireType, err := r.Field()
+
+		if err != nil {
+			return err
+		}
+
+		known, err := handler(r, field, wireType)
+
+		if err != nil {
+			return err
+		}
+
+		if !known {
+			if err = r.Skip(wireType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SubMessage reads bytes of nested message and decodes it
+func SubMessage[T any](r *Reader, decode func([]byte) (T, error)) (T, error) {
+	data, err := r.Bytes()
+
+	if err != nil {
+		var empty T
+		return empty, err
+	}
+	return decode(data)
+}
@@ -0,0 +1,120 @@
+// Package sl_dump reads logs, which are dumped to files by the sherlog library
+package sl_dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	m "main/models"
+	"main/tools"
+)
+
+const _NAME_LAYOUT = "02.01.2006.log" // name of dump file of day
+
+// IsDumpFile reports whether name is name of dump file ("DD.MM.YYYY.log")
+func IsDumpFile(name string) bool {
+	_, err := time.Parse(_NAME_LAYOUT, name)
+	return err == nil
+}
+
+// DumpFiles returns names of dump files of dir, which are sorted by their days
+func DumpFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	days := map[string]time.Time{}
+	names := []string{}
+
+	for _, entry := range entries {
+		day, err := time.Parse(_NAME_LAYOUT, entry.Name())
+
+		if err == nil && entry.Type().IsRegular() {
+			days[entry.Name()] = day
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return days[names[i]].Before(days[names[j]])
+	})
+	return names, nil
+}
+
+// Parse parses JSON lines of dump till 'maxLogs' logs and returns number of read bytes.
+// Dump doesn't end with new line, so last line is read, if it's complete JSON or if 'atEOF'.
+// Empty lines are skipped, incorrect lines are counted as rejected
+func Parse(data []byte, maxLogs int, atEOF bool) (logs []*m.Log, read int, rejected int) {
+	for read < len(data) && len(logs) < maxLogs {
+		line := data[read:]
+		end := bytes.IndexByte(line, '\n')
+
+		if end >= 0 {
+			line = line[:end+1]
+		}
+
+		l := &m.Log{}
+		err := json.Unmarshal(line, l)
+
+		if err != nil && end < 0 && !atEOF {
+			break
+		}
+		read += len(line)
+
+		switch {
+		case err == nil:
+			logs = append(logs, normalize(l))
+		case len(bytes.TrimSpace(line)) > 0:
+			rejected++
+		}
+	}
+	return logs, read, rejected
+}
+
+// normalize sets default values of columns, which sherlog leaves empty, and cuts too long values
+func normalize(l *m.Log) *m.Log {
+	l.Entity = tools.Cut(tools.FirstNotEmpty(l.Entity, "unknown"), m.MAX_VALUE_LEN)
+	l.EntityID = tools.Cut(tools.FirstNotEmpty(l.EntityID, "unknown"), m.MAX_VALUE_LEN)
+	l.Message = tools.FirstNotEmpty(tools.Cut(l.Message, m.MAX_MESSAGE_LEN), "-")
+	l.Traces = cutStrings(l.Traces, m.MAX_ITEMS)
+	l.Modules = cutStrings(l.Modules, m.MAX_MODULES)
+	l.Labels = cutStrings(l.Labels, m.MAX_ITEMS)
+
+	if len(l.Traces) == 0 {
+		l.Traces = []string{"-"}
+	}
+
+	if len(l.Modules) == 0 {
+		l.Modules = []string{l.Entity}
+	}
+
+	// Fields are sorted, so the same ones are kept, if there are too many
+
+	keys := tools.KeysToSlice(l.Fields)
+	sort.Strings(keys)
+	fields := map[string]string{}
+
+	for _, key := range keys {
+		if key != "" && l.Fields[key] != "" && len(fields) < m.MAX_ITEMS {
+			fields[tools.Cut(key, m.MAX_VALUE_LEN)] = tools.Cut(l.Fields[key], m.MAX_VALUE_LEN)
+		}
+	}
+	l.Fields = fields
+	return l
+}
+
+func cutStrings(arr []string, max int) []string {
+	cut := make([]string, 0, len(arr))
+
+	for _, s := range arr {
+		if s != "" && len(cut) < max {
+			cut = append(cut, tools.Cut(s, m.MAX_VALUE_LEN))
+		}
+	}
+	return cut
+}
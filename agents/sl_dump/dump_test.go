@@ -0,0 +1,152 @@
+package sl_dump
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/stretchr/testify/assert"
+
+	m "main/models"
+	tt "main/test_tools"
+)
+
+const (
+	_LOG_1 = `{"timestamp":1700000000000,"level":4,"traces":["Init"],"modules":["_Service","Run"],"entity":"","entity_id":"","message":"Started","labels":[],"fields":{}}`
+	_LOG_2 = `{"timestamp":1700000000001,"level":6,"traces":["a1"],"modules":["_Service","postLogs"],"entity":"Request","entity_id":"PostLogsAPI","message":"Failed","labels":["api"],"fields":{"storage":"web","empty":""}}`
+)
+
+func TestParse(t *testing.T) {
+	// Dump starts with new line and doesn't end with it
+	data := []byte("\n" + _LOG_1 + "\nbroken\n" + _LOG_2)
+
+	logs, read, rejected := Parse(data, 10, false)
+	assert.Equal(t, len(data), read)
+	assert.Equal(t, 1, rejected)
+	assert.Len(t, logs, 2)
+
+	assert.Equal(t, "unknown", logs[0].Entity)
+	assert.Equal(t, "unknown", logs[0].EntityID)
+	assert.Equal(t, []string{"_Service", "Run"}, logs[0].Modules)
+	assert.Empty(t, logs[0].Errors())
+
+	assert.Equal(t, &m.Log{
+		Timestamp: 1700000000001,
+		Level:     6,
+		Traces:    []string{"a1"},
+		Entity:    "Request",
+		EntityID:  "PostLogsAPI",
+		Message:   "Failed",
+		Modules:   []string{"_Service", "postLogs"},
+		Labels:    []string{"api"},
+		Fields:    map[string]string{"storage": "web"},
+	}, logs[1])
+
+	// Incomplete last line is read only at EOF
+
+	half := data[:len(data)-10]
+	logs, read, rejected = Parse(half, 10, false)
+	assert.Equal(t, len(half)-len(_LOG_2)+10, read)
+	assert.Len(t, logs, 1)
+
+	logs, read, rejected = Parse(half, 10, true)
+	assert.Equal(t, len(half), read)
+	assert.Equal(t, 2, rejected)
+
+	// Limit of logs
+
+	logs, read, _ = Parse(data, 1, false)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, len(_LOG_1)+2, read)
+
+	long := strings.Repeat("x", 300)
+	logs, _, _ = Parse([]byte(`{"timestamp":1,"message":"`+long+`"}`), 1, false)
+	assert.Len(t, logs[0].Message, 255)
+	assert.Equal(t, []string{"-"}, logs[0].Traces)
+}
+
+func TestDumpFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"02.01.2024.log", "31.12.2023.log", "notes.txt", "10.01.2024.log"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	names, err := DumpFiles(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"31.12.2023.log", "02.01.2024.log", "10.01.2024.log"}, names)
+}
+
+func TestWatcher(t *testing.T) {
+	tt.SherlogInit()
+	dir := t.TempDir()
+	name := filepath.Join(dir, "02.01.2024.log")
+	assert.NoError(t, os.WriteFile(name, []byte("\n"+_LOG_1), 0644))
+
+	mx := sync.Mutex{}
+	batches := []*m.Logs{}
+	batchIDs := map[string]bool{}
+	fail := true
+
+	// Repeated batch is skipped as by writers
+	write := func(trace *sl.Trace, logs *m.Logs, next *m.Import) error {
+		mx.Lock()
+		defer mx.Unlock()
+
+		if fail {
+			fail = false
+			return os.ErrDeadlineExceeded
+		}
+
+		if !batchIDs[logs.BatchID] {
+			batchIDs[logs.BatchID] = true
+			batches = append(batches, logs)
+		}
+		return nil
+	}
+
+	waitBatches := func(n int) {
+		assert.Eventually(t, func() bool {
+			mx.Lock()
+			defer mx.Unlock()
+			return len(batches) == n
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	watcher := NewWatcher(&m.Import{ID: "imp", Storage: "app", Dir: dir}, 10*time.Millisecond, write)
+	watcher.Run()
+
+	assert.Eventually(t, func() bool {
+		return watcher.Import().Offsets["02.01.2024.log"] == int64(len(_LOG_1)+1)
+	}, time.Second, 10*time.Millisecond, "failed batch is read again")
+
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	file.WriteString("\n" + _LOG_2)
+	file.Close()
+
+	waitBatches(2)
+
+	// Truncated and rewritten file is read from start with new start of batch IDs
+
+	start := watcher.Import().Starts["02.01.2024.log"]
+	assert.NoError(t, os.WriteFile(name, []byte("\n"+_LOG_1), 0644))
+	waitBatches(3)
+	watcher.Stop()
+
+	prefix := "imp:02.01.2024.log:" + strconv.FormatInt(start, 10) + ":"
+	assert.Equal(t, "app", batches[0].Storage)
+	assert.Equal(t, prefix+"0", batches[0].BatchID)
+	assert.Equal(t, "Started", batches[0].Logs[0].Message)
+	assert.Equal(t, prefix+strconv.Itoa(len(_LOG_1)+1), batches[1].BatchID)
+	assert.Equal(t, "Failed", batches[1].Logs[0].Message)
+
+	assert.NotEqual(t, prefix+"0", batches[2].BatchID)
+	assert.Equal(t, "Started", batches[2].Logs[0].Message)
+	assert.Greater(t, watcher.Import().Starts["02.01.2024.log"], start)
+}
@@ -0,0 +1,209 @@
+package sl_dump
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	m "main/models"
+)
+
+const _MAX_READ = 1 << 20 // max bytes, which are read from file at once
+
+// Watcher polls dump files of dir of import and passes new logs to handler with offsets,
+// which are saved with logs. Offsets are moved only after successful handling,
+// so failed logs are read again. Truncated or recreated file is read from start with new start,
+// which is part of batch IDs, so its logs aren't taken for saved ones
+type Watcher struct {
+	imp    *m.Import
+	period time.Duration
+	write  func(trace *sl.Trace, logs *m.Logs, next *m.Import) error
+	mx     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewWatcher(imp *m.Import, period time.Duration, write func(trace *sl.Trace, logs *m.Logs, next *m.Import) error) *Watcher {
+	if imp.Offsets == nil {
+		imp.Offsets = map[string]int64{}
+	}
+
+	if imp.Starts == nil {
+		imp.Starts = map[string]int64{}
+	}
+
+	return &Watcher{
+		imp:    imp,
+		period: period,
+		write:  write,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (w *Watcher) Run() {
+	go w.watch()
+}
+
+// Stop stops polling and waits for handling of read logs
+func (w *Watcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Import returns copy of import with current offsets
+func (w *Watcher) Import() *m.Import {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.imp.Copy()
+}
+
+func (w *Watcher) watch() {
+	trace := sl.NewTrace("sherlog_import")
+	trace.SetEntity("importWatcher", w.imp.ID)
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.period)
+	defer ticker.Stop()
+
+	for {
+		w.poll(trace)
+
+		select {
+		case <-w.stop:
+			trace.INFO(nil, "Watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) poll(trace *sl.Trace) {
+	defer trace.AddModule("_Watcher", "poll")()
+
+	names, err := DumpFiles(w.imp.Dir)
+
+	if err != nil {
+		trace.NOTE(nil, "Reading dir of import error: ", err.Error())
+		return
+	}
+
+	// Offsets of removed files are forgotten
+
+	w.mx.Lock()
+	exists := map[string]bool{}
+
+	for _, name := range names {
+		exists[name] = true
+	}
+
+	for name := range w.imp.Offsets {
+		if !exists[name] {
+			delete(w.imp.Offsets, name)
+			delete(w.imp.Starts, name)
+		}
+	}
+	w.mx.Unlock()
+
+	for _, name := range names {
+		if err = w.readFile(trace, name); err != nil {
+			return
+		}
+	}
+}
+
+// readFile reads new logs of file by parts. Error is returned, if handling of logs failed
+func (w *Watcher) readFile(trace *sl.Trace, name string) error {
+	file, err := os.Open(filepath.Join(w.imp.Dir, name))
+
+	if err != nil {
+		trace.NOTE(nil, "Opening of dump file error: ", err.Error())
+		return nil
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		trace.NOTE(nil, "Getting stats of dump file error: ", err.Error())
+		return nil
+	}
+
+	size := info.Size()
+
+	w.mx.Lock()
+	offset := w.imp.Offsets[name]
+	start, ok := w.imp.Starts[name]
+
+	if size < offset {
+		trace.NOTE(nil, "Dump file '", name, "' is truncated, it's read from start")
+		offset, ok = 0, false
+		w.imp.Offsets[name] = 0
+	}
+
+	// Start is kept before saving, so retried batch has the same ID
+	if !ok {
+		start = time.Now().UnixNano()
+		w.imp.Starts[name] = start
+	}
+	w.mx.Unlock()
+
+	buf := make([]byte, min(size-offset, _MAX_READ))
+
+	for offset < size {
+		select {
+		case <-w.stop:
+			return errors.New("watcher is stopped")
+		default:
+		}
+
+		n, err := file.ReadAt(buf[:min(size-offset, _MAX_READ)], offset)
+
+		if err != nil && err != io.EOF {
+			trace.NOTE(nil, "Reading of dump file error: ", err.Error())
+			return nil
+		}
+
+		logs, read, rejected := Parse(buf[:n], m.MAX_LOGS_IN_CHUNK, false)
+
+		// Line, which is longer than buffer, is rejected
+		if read == 0 && n == _MAX_READ {
+			logs, read, rejected = Parse(buf[:n], m.MAX_LOGS_IN_CHUNK, true)
+		}
+
+		if read == 0 {
+			return nil
+		}
+
+		if rejected > 0 {
+			trace.NOTE(nil, rejected, " incorrect lines of dump file '", name, "' are skipped")
+		}
+
+		next := w.Import()
+		next.Offsets[name] = offset + int64(read)
+		next.Starts[name] = start
+		batch := &m.Logs{
+			Storage: w.imp.Storage,
+			BatchID: fmt.Sprint(w.imp.ID, ":", name, ":", start, ":", offset),
+			Partial: true,
+			Logs:    logs,
+		}
+
+		if err = w.write(trace, batch, next); err != nil {
+			trace.NOTE(nil, "Logs of dump file '", name, "' will be read again: ", err.Error())
+			return err
+		}
+
+		w.mx.Lock()
+		w.imp = next
+		w.mx.Unlock()
+		offset = next.Offsets[name]
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"sync"
+
+	sl "github.com/j-hitgate/sherlog"
+)
+
+type batchState struct {
+	done  chan struct{}
+	saved bool
+}
+
+type storageBatches struct {
+	states map[string]*batchState
+	saved  []string // saved IDs from the oldest
+}
+
+// BatchesMap keeps recent batch IDs of storages, so repeated batch (client retry) is not written again.
+// Batch in processing blocks its repeats until it is saved or failed
+type BatchesMap struct {
+	storages map[string]*storageBatches
+	limit    int // saved IDs per storage
+	mx       sync.Mutex
+}
+
+func NewBatchesMap(limit int) *BatchesMap {
+	return &BatchesMap{
+		storages: map[string]*storageBatches{},
+		limit:    limit,
+	}
+}
+
+func (bm *BatchesMap) storage(storage string) *storageBatches {
+	sb, ok := bm.storages[storage]
+
+	if !ok {
+		sb = &storageBatches{states: map[string]*batchState{}}
+		bm.storages[storage] = sb
+	}
+	return sb
+}
+
+func (bm *BatchesMap) addSaved(sb *storageBatches, id string) {
+	sb.saved = append(sb.saved, id)
+
+	if len(sb.saved) > bm.limit {
+		delete(sb.states, sb.saved[0])
+		sb.saved = sb.saved[1:]
+	}
+}
+
+// AddStorage adds saved IDs of storage (from the oldest), read at startup
+func (bm *BatchesMap) AddStorage(storage string, ids []string) {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	sb := bm.storage(storage)
+
+	for _, id := range ids {
+		if _, ok := sb.states[id]; !ok {
+			done := make(chan struct{})
+			close(done)
+			sb.states[id] = &batchState{done: done, saved: true}
+			bm.addSaved(sb, id)
+		}
+	}
+}
+
+func (bm *BatchesMap) DeleteStorage(storage string) {
+	bm.mx.Lock()
+	delete(bm.storages, storage)
+	bm.mx.Unlock()
+}
+
+// Begin returns true if batch is already saved. Otherwise batch is taken for processing
+// and finish must be called with the result
+func (bm *BatchesMap) Begin(trace *sl.Trace, storage, id string) (saved bool, finish func(saved bool)) {
+	defer trace.AddModule("_BatchesMap", "Begin")()
+
+	for {
+		bm.mx.Lock()
+		sb := bm.storage(storage)
+		state, ok := sb.states[id]
+
+		if !ok {
+			state = &batchState{done: make(chan struct{})}
+			sb.states[id] = state
+			bm.mx.Unlock()
+
+			return false, func(saved bool) {
+				bm.finish(storage, id, state, saved)
+			}
+		}
+		bm.mx.Unlock()
+
+		select {
+		case <-state.done:
+			if state.saved {
+				return true, nil
+			}
+			// Failed batch may be written again
+		default:
+			trace.DEBUG(nil, "Waiting for batch '", id, "' in processing...")
+			<-state.done
+		}
+	}
+}
+
+func (bm *BatchesMap) finish(storage, id string, state *batchState, saved bool) {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	sb := bm.storage(storage)
+
+	if saved {
+		state.saved = true
+		bm.addSaved(sb, id)
+	} else if sb.states[id] == state {
+		delete(sb.states, id)
+	}
+	close(state.done)
+}
@@ -19,6 +19,8 @@ type Deleter struct {
 	sr       *Reader
 	sw       *Writer
 	isRunned bool
+	stop     chan struct{}
+	done     chan struct{}
 	fileSys  *fsr.FileSys
 	selector *log_utils.Selector
 }
@@ -27,6 +29,8 @@ func NewDeleter(sr *Reader, sw *Writer) *Deleter {
 	return &Deleter{
 		sr:       sr,
 		sw:       sw,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
 		fileSys:  &fsr.FileSys{},
 		selector: &log_utils.Selector{},
 	}
@@ -42,10 +46,32 @@ func (d *Deleter) RunDeleter(queue <-chan *m.DeleteQuery, metasMap *MetasMap) {
 	d.isRunned = true
 }
 
+// Stop interrupts delete tasks after current chunk and waits until deleter stops.
+// Queue must be closed before. Interrupted tasks stay saved and will be continued after restart
+func (d *Deleter) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *Deleter) isStopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
 func (d *Deleter) queryReceiver(queue <-chan *m.DeleteQuery, taskQueue chan<- *m.DeleteLogsTask, metasMap *MetasMap) {
 	for query := range queue {
 		query.ErrCh <- func() (err error) {
 			defer query.Trace.AddModule("_Deleter", "queryReceiver")()
+
+			if err = query.Context().Err(); err != nil {
+				err = aerr.FromContext(err)
+				query.Trace.NOTE(nil, "Creating delete task canceled: ", err.Error())
+				return err
+			}
 			query.Trace.STAGE(nil, "Creating delete task...")
 
 			if !metasMap.Exists(query.Storage) {
@@ -82,7 +108,15 @@ func (d *Deleter) queryReceiver(queue <-chan *m.DeleteQuery, taskQueue chan<- *m
 			if query.TaskID == "" {
 				query.TaskID = uuid.New().String()
 				name := path.Join(m.DIR_DELETE_TASKS, query.TaskID)
-				d.fileSys.WriteFile(query.Trace, name, true, query)
+
+				if _, err = d.fileSys.WriteFile(query.Trace, name, true, query); err != nil {
+					return err
+				}
+
+				// Task is durable before response, so deletion is guaranteed
+				if err = d.fileSys.Sync(query.Trace); err != nil {
+					return err
+				}
 			}
 
 			// Send task to deleter
@@ -100,15 +134,20 @@ func (d *Deleter) queryReceiver(queue <-chan *m.DeleteQuery, taskQueue chan<- *m
 		}()
 		close(query.ErrCh)
 	}
+	close(taskQueue)
 }
 
 func (d *Deleter) deleter(queue <-chan *m.DeleteLogsTask, metasMap *MetasMap) {
 	trace := sl.NewTrace("deleter_" + uuid.New().String()[:13])
 
 	for task := range queue {
+		if d.isStopped() {
+			trace.STAGE(sl.Fields{"ID": task.ID}, "Delete task postponed until restart")
+			continue
+		}
 		popModule := trace.AddModule("_Deleter", "deleter")
 
-		func() {
+		isCompleted := func() bool {
 			trace.STAGE(sl.Fields{"ID": task.ID}, "Running delete task...")
 
 			defer metasMap.ReserveVersion(trace, d)(trace)
@@ -116,63 +155,98 @@ func (d *Deleter) deleter(queue <-chan *m.DeleteLogsTask, metasMap *MetasMap) {
 
 			if metas == nil {
 				trace.STAGE(nil, "Delete task is already compeled")
-				return
+				return true
 			}
 
 			if len(metas) == 0 {
 				trace.STAGE(nil, "No logs deleted")
-				return
+				return true
 			}
 
 			backuper := fsr.NewBackuper(trace, fmt.Sprint("del_"+task.ID))
 
 			for _, meta := range metas {
+				if d.isStopped() {
+					trace.STAGE(nil, "Delete task interrupted, it will be continued after restart")
+					return false
+				}
+				// Manifest is held before chunk as in scheduler, so checkpointer can't block them both
+				release := metasMap.HoldManifest()
 				meta.Mx.Lock()
 				meta = metasMap.Find(trace, task.Storage, meta.ID)
 				isDeleted := true
+				var err error
 
 				if task.Condition != nil {
-					isDeleted = d.DeleteByCondition(trace, task.Storage, meta, task.TimeRange, task.Condition, backuper)
+					isDeleted, err = d.DeleteByCondition(trace, task.Storage, meta, task.TimeRange, task.Condition, backuper)
 				} else {
-					d.DeleteByTimeRange(trace, task.Storage, meta, task.TimeRange, backuper)
+					err = d.DeleteByTimeRange(trace, task.Storage, meta, task.TimeRange, backuper)
+				}
+
+				// Chunk is rolled back, and task stays saved to be continued after restart
+				if err = backuper.BackupIfErr(err); err != nil {
+					meta.Mx.Unlock()
+					release()
+					trace.ERROR(nil, "Delete task interrupted by error: ", err.Error())
+					return false
 				}
-				backuper.Cancel()
 
 				if isDeleted {
 					metasMap.Update(&m.UpdateStateTask{
 						Storage:   task.Storage,
 						ForUpdate: []*m.Meta{meta},
 						Trace:     trace,
-						Callback:  func() { meta.Mx.Unlock() },
+						Callback: func() {
+							meta.Mx.Unlock()
+							release()
+						},
 					})
+				} else {
+					meta.Mx.Unlock()
+					release()
 				}
 				trace.DEBUG(nil, "Chunk ", meta.ID, " done")
 			}
+			return true
 		}()
 
-		name := path.Join(m.DIR_DELETE_TASKS, task.ID)
-		d.fileSys.Remove(trace, name)
+		if isCompleted {
+			name := path.Join(m.DIR_DELETE_TASKS, task.ID)
 
-		trace.STAGE(nil, "Delete task completed")
+			if _, err := d.fileSys.Remove(trace, name); err != nil {
+				trace.WARN(nil, "Completed delete task is not removed, it will be runned again after restart")
+			}
+
+			trace.STAGE(nil, "Delete task completed")
+		}
 		popModule()
 	}
+	close(d.done)
 }
 
-func (d *Deleter) MarkChunkAsDeleted(trace *sl.Trace, storage string, meta *m.Meta, backuper *fsr.Backuper) {
+func (d *Deleter) MarkChunkAsDeleted(trace *sl.Trace, storage string, meta *m.Meta, backuper *fsr.Backuper) error {
 	defer trace.AddModule("_Deleter", "MarkChunkAsDeleted")()
 
 	metaPath := path.Join(m.DIR_STORAGES, storage, meta.Name(), "meta.new")
 
 	backuper.AddForReplace(metaPath)
-	backuper.Commit()
+	dropManifest(storage, backuper)
+
+	if err := backuper.Commit(); err != nil {
+		return err
+	}
 
 	meta.IsDeleted = true
-	d.fileSys.WriteFile(trace, metaPath, false, meta)
+
+	if _, err := d.fileSys.WriteFile(trace, metaPath, false, meta); err != nil {
+		return err
+	}
 
 	trace.DEBUG(nil, "Chunk marked as deleted: ", storage, "/", meta.Name())
+	return nil
 }
 
-func (d *Deleter) DeleteByTimeRange(trace *sl.Trace, storage string, meta *m.Meta, tr m.TimeRange, backuper *fsr.Backuper) {
+func (d *Deleter) DeleteByTimeRange(trace *sl.Trace, storage string, meta *m.Meta, tr m.TimeRange, backuper *fsr.Backuper) error {
 	popModule := trace.AddModule("_Deleter", "DeleteByTimeRange")
 	defer func() {
 		trace.DEBUG(nil, "Logs from chunks deleted: ", storage, "/", meta.Name())
@@ -180,26 +254,33 @@ func (d *Deleter) DeleteByTimeRange(trace *sl.Trace, storage string, meta *m.Met
 	}()
 
 	if time_range.IsInside(tr, meta.TimeRange) {
-		d.MarkChunkAsDeleted(trace, storage, meta, backuper)
-		return
+		return d.MarkChunkAsDeleted(trace, storage, meta, backuper)
+	}
+	logs, err := d.sr.ReadChunk(trace, storage, meta, nil)
+
+	if err != nil {
+		return err
 	}
-	logs := d.sr.ReadChunk(trace, storage, meta, nil)
 	logs = d.selector.GetLogsOutOfRange(trace, logs, tr, meta.Offsets == nil)
-	d.sw.WriteNewVersionChunk(trace, storage, meta, logs, backuper)
+	_, err = d.sw.WriteNewVersionChunk(trace, storage, meta, logs, backuper)
+	return err
 }
 
-func (d *Deleter) DeleteByCondition(trace *sl.Trace, storage string, meta *m.Meta, tr m.TimeRange, cond m.ICondition, backuper *fsr.Backuper) bool {
+func (d *Deleter) DeleteByCondition(trace *sl.Trace, storage string, meta *m.Meta, tr m.TimeRange, cond m.ICondition, backuper *fsr.Backuper) (bool, error) {
 	defer trace.AddModule("_Deleter", "DeleteByCondition")()
 	chunk := fmt.Sprint(storage, "/", meta.Name())
 
 	// Read logs from chunk and get indices on time range
 
-	logs := d.sr.ReadChunk(trace, storage, meta, nil)
+	logs, err := d.sr.ReadChunk(trace, storage, meta, nil)
+
+	if err != nil {
+		return false, err
+	}
 	startInx, endInx := d.selector.GetIndicesOfRange(trace, logs, tr, meta.Offsets == nil)
 
 	// Filter logs
 
-	var err error
 	filteredLogs := make([]*m.Log, 0, len(logs))
 	ok := false
 
@@ -211,7 +292,7 @@ func (d *Deleter) DeleteByCondition(trace *sl.Trace, storage string, meta *m.Met
 
 			if err != nil {
 				trace.ERROR(nil, "Incorrect condition: ", err.Error())
-				return false
+				return false, nil
 			}
 		}
 
@@ -222,16 +303,20 @@ func (d *Deleter) DeleteByCondition(trace *sl.Trace, storage string, meta *m.Met
 
 	if len(filteredLogs) == len(logs) {
 		trace.DEBUG(nil, "No logs deleted: ", chunk)
-		return false
+		return false, nil
 	}
 
 	if len(filteredLogs) == 0 {
-		d.MarkChunkAsDeleted(trace, storage, meta, backuper)
+		if err = d.MarkChunkAsDeleted(trace, storage, meta, backuper); err != nil {
+			return false, err
+		}
 		trace.DEBUG(nil, "Chunk deleted: ", chunk)
-		return true
+		return true, nil
 	}
 
-	d.sw.WriteNewVersionChunk(trace, storage, meta, filteredLogs, backuper)
+	if _, err = d.sw.WriteNewVersionChunk(trace, storage, meta, filteredLogs, backuper); err != nil {
+		return false, err
+	}
 	trace.DEBUG(nil, len(logs)-len(filteredLogs), "logs deleted: ", chunk)
-	return true
+	return true, nil
 }
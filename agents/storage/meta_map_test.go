@@ -69,6 +69,29 @@ func TestGetExpired(t *testing.T) {
 	}
 }
 
+func TestGetOldest(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	mm := NewMetasMap(2)
+	mm.AddStorage(trace, "storage", []*m.Meta{
+		{ID: 1, TimeRange: m.TimeRange{Start: 5, End: 9}},
+		{ID: 2, TimeRange: m.TimeRange{Start: 1, End: 3}, IsDeleted: true},
+		{ID: 3, TimeRange: m.TimeRange{Start: 2, End: 4}},
+		{ID: 4, TimeRange: m.TimeRange{Start: 1, End: 2}, Offsets: &m.Offsets{}},
+		{ID: 5, TimeRange: m.TimeRange{Start: 3, End: 6}},
+	})
+
+	oldest := mm.GetOldest(trace, "storage", 2)
+
+	if assert.Len(t, oldest, 2) {
+		assert.Equal(t, uint64(3), oldest[0].ID)
+		assert.Equal(t, uint64(5), oldest[1].ID)
+	}
+
+	assert.Nil(t, mm.GetOldest(trace, "unknown", 2), "not existing storage")
+}
+
 func TestGetFulledCrossedMetas(t *testing.T) {
 	tt.SherlogInit()
 	trace := sl.NewTrace("Main")
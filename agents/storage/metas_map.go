@@ -5,16 +5,19 @@ import (
 	"math"
 	"path"
 	"sort"
+	"strings"
 	"sync"
 
 	sl "github.com/j-hitgate/sherlog"
 
 	"main/agents/time_range"
 	m "main/models"
+	fsr "main/relays/file_sys"
 )
 
 type stateManager struct {
 	metasMap map[string][][]*m.Meta
+	changes  map[string]uint64 // last versions of storages changes
 	version  uint64
 	mx       *sync.Mutex
 }
@@ -22,6 +25,7 @@ type stateManager struct {
 func newStateManager() *stateManager {
 	return &stateManager{
 		metasMap: map[string][][]*m.Meta{},
+		changes:  map[string]uint64{},
 		version:  1,
 		mx:       &sync.Mutex{},
 	}
@@ -45,6 +49,7 @@ func (sm *stateManager) Add(storage string, blocks [][]*m.Meta) (version uint64)
 		sm.metasMap[storage] = blocks
 		sm.version++
 		version = sm.version
+		sm.changes[storage] = version
 	}
 	sm.mx.Unlock()
 	return version
@@ -56,6 +61,7 @@ func (sm *stateManager) Set(storage string, blocks [][]*m.Meta) (version uint64)
 	if _, ok := sm.metasMap[storage]; ok {
 		sm.version++
 		sm.metasMap[storage], version = blocks, sm.version
+		sm.changes[storage] = version
 	}
 	sm.mx.Unlock()
 	return version
@@ -66,6 +72,7 @@ func (sm *stateManager) Delete(storage string) (version uint64) {
 
 	if _, ok := sm.metasMap[storage]; ok {
 		delete(sm.metasMap, storage)
+		delete(sm.changes, storage)
 		sm.version++
 		version = sm.version
 	}
@@ -73,6 +80,18 @@ func (sm *stateManager) Delete(storage string) (version uint64) {
 	return version
 }
 
+// GetWithChange returns also version of last change of storage
+func (sm *stateManager) GetWithChange(storage string) (blocks [][]*m.Meta, change uint64) {
+	sm.mx.Lock()
+
+	if ms, ok := sm.metasMap[storage]; ok {
+		blocks, change = ms, sm.changes[storage]
+	}
+	sm.mx.Unlock()
+
+	return blocks, change
+}
+
 func (sm *stateManager) Version() uint64 {
 	sm.mx.Lock()
 	version := sm.version
@@ -110,6 +129,10 @@ type MetasMap struct {
 	usesMx       *sync.Mutex
 	deletedCount int
 	blockMaxSize int
+
+	checkpoints map[string]uint64 // versions of storages changes saved in manifests
+	manifestMx  *sync.RWMutex
+	fileSys     *fsr.FileSys
 }
 
 func NewMetasMap(blockMaxSize int) *MetasMap {
@@ -120,6 +143,9 @@ func NewMetasMap(blockMaxSize int) *MetasMap {
 		uses:         map[any]uint64{},
 		usesMx:       &sync.Mutex{},
 		blockMaxSize: blockMaxSize,
+		checkpoints:  map[string]uint64{},
+		manifestMx:   &sync.RWMutex{},
+		fileSys:      &fsr.FileSys{},
 	}
 	go mm.updateHandler()
 	return mm
@@ -243,6 +269,31 @@ func (mm *MetasMap) GetForRemove() []string {
 	return forDelete
 }
 
+// ReturnForRemove returns names, which are not removed, so they are removed later
+func (mm *MetasMap) ReturnForRemove(names []string) {
+	mm.usesMx.Lock()
+
+	for _, name := range names {
+		mm.deleteList[name] = 0
+	}
+	mm.usesMx.Unlock()
+}
+
+// forRemoveOf returns names of not removed chunks of storage
+func (mm *MetasMap) forRemoveOf(storage string) []string {
+	prefix := path.Join(m.DIR_STORAGES, storage) + "/"
+	names := []string{}
+	mm.usesMx.Lock()
+
+	for name := range mm.deleteList {
+		if chunk, ok := strings.CutPrefix(name, prefix); ok {
+			names = append(names, chunk)
+		}
+	}
+	mm.usesMx.Unlock()
+	return names
+}
+
 // Storages
 
 func (mm *MetasMap) Storages() []string {
@@ -397,6 +448,13 @@ func (mm *MetasMap) update(newBlocks, blocks [][]*m.Meta, task *m.UpdateStateTas
 	return mm.metasLen(blocks), deleted
 }
 
+// callback is called in any case, because it releases locks
+func (*MetasMap) callback(task *m.UpdateStateTask) {
+	if task.Callback != nil {
+		task.Callback()
+	}
+}
+
 func (mm *MetasMap) updateHandler() {
 	for task := range mm.queue {
 		task.Trace.WithModule("_MetasMap", "updateHandler", func() {
@@ -410,11 +468,13 @@ func (mm *MetasMap) updateHandler() {
 
 			if version == 0 {
 				task.Trace.DEBUG(fields, "Storage '", task.Storage, "' not exists")
+				mm.callback(task)
 				return
 			}
 
 			if len(blocks) == 0 && len(task.ForAdd) == 0 {
 				task.Trace.DEBUG(fields, "No metas to update")
+				mm.callback(task)
 				return
 			}
 
@@ -484,14 +544,12 @@ func (mm *MetasMap) updateHandler() {
 
 			if version == 0 {
 				task.Trace.DEBUG(fields, "Storage '", task.Storage, "' not exists")
+				mm.callback(task)
 				return
 			}
 
-			if task.Callback != nil {
-				task.Callback()
-			}
-
-			// Add deleted metas
+			// Add deleted metas before callback, which releases manifest,
+			// so checkpoint has them in names for removing
 
 			if len(deleted) > 0 {
 				mm.usesMx.Lock()
@@ -504,6 +562,7 @@ func (mm *MetasMap) updateHandler() {
 				mm.usesMx.Unlock()
 				fields["deleted"] = fmt.Sprint(len(deleted))
 			}
+			mm.callback(task)
 
 			task.Trace.DEBUG(fields, "Metas updated")
 		})
@@ -612,6 +671,41 @@ func (mm *MetasMap) GetExpired(trace *sl.Trace, storage string, deadline int64)
 	return expired
 }
 
+// GetOldest returns no more than 'count' full chunks with the oldest logs
+func (mm *MetasMap) GetOldest(trace *sl.Trace, storage string, count int) []*m.Meta {
+	defer trace.AddModule("_MetasMap", "GetOldest")()
+	blocks, version := mm.state.Get(storage)
+
+	if version == 0 {
+		trace.DEBUG(nil, "Storage not exists: ", storage)
+		return nil
+	}
+	oldest := []*m.Meta{}
+
+	for i := range blocks {
+		for j := range blocks[i] {
+			if !blocks[i][j].IsDeleted && blocks[i][j].Offsets == nil {
+				oldest = append(oldest, blocks[i][j])
+			}
+		}
+	}
+
+	sort.Slice(oldest, func(i, j int) bool {
+		return oldest[i].TimeRange.End < oldest[j].TimeRange.End
+	})
+
+	if len(oldest) > count {
+		oldest = oldest[:count]
+	}
+
+	for i := range oldest {
+		oldest[i] = oldest[i].Copy()
+	}
+
+	trace.DEBUG(nil, len(oldest), " oldest chunks in storage: ", storage)
+	return oldest
+}
+
 func (mm *MetasMap) GetFulledCrossedMetas(trace *sl.Trace, storage string) []*m.Meta {
 	defer trace.AddModule("_MetasMap", "GetFulledCrossedMetas")()
 	blocks, version := mm.state.Get(storage)
@@ -667,3 +761,79 @@ func (mm *MetasMap) GetFulledCrossedMetas(trace *sl.Trace, storage string) []*m.
 	trace.DEBUG(nil, len(crossedMetas), " chunks crossed in storage: ", storage)
 	return crossedMetas
 }
+
+// Manifests
+
+// HoldManifest prevents checkpoints while chunks are added, changed in place or removed.
+// Release must be called after the changes are set in state
+func (mm *MetasMap) HoldManifest() (release func()) {
+	mm.manifestMx.RLock()
+	return mm.manifestMx.RUnlock
+}
+
+// dropManifest removes manifest of storage, when changes of backuper are accepted. It is called with
+// changes, which manifest doesn't know (new chunks and versions, marking as deleted), so existing
+// manifest has all chunks of storage. Manifest must be held until the changes are set in state
+func dropManifest(storage string, backuper *fsr.Backuper) {
+	backuper.AddForRemove(path.Join(m.DIR_STORAGES, storage, m.FILE_MANIFEST))
+}
+
+// Checkpoint writes manifests of storages changed since last checkpoint
+func (mm *MetasMap) Checkpoint(trace *sl.Trace) (written int) {
+	defer trace.AddModule("_MetasMap", "Checkpoint")()
+
+	mm.manifestMx.Lock()
+	defer mm.manifestMx.Unlock()
+
+	storages := mm.Storages()
+	exist := make(map[string]bool, len(storages))
+
+	for _, storage := range storages {
+		exist[storage] = true
+		blocks, change := mm.state.GetWithChange(storage)
+
+		// After startup manifests are written once, so storages without them are not scanned next time
+		if checkpoint, ok := mm.checkpoints[storage]; ok && checkpoint == change {
+			continue
+		}
+
+		manifest := m.NewManifest()
+		manifest.ForRemove = mm.forRemoveOf(storage)
+
+		for i := range blocks {
+			for _, meta := range blocks[i] {
+				manifest.Chunks[meta.Name()] = meta
+			}
+		}
+
+		// Manifest is written again on next checkpoint
+		if err := mm.writeManifest(trace, storage, manifest); err != nil {
+			continue
+		}
+		mm.checkpoints[storage] = change
+		written++
+	}
+
+	for storage := range mm.checkpoints {
+		if !exist[storage] {
+			delete(mm.checkpoints, storage)
+		}
+	}
+
+	trace.DEBUG(nil, written, " manifests written")
+	return written
+}
+
+// writeManifest replaces manifest under backuper, so it is written entirely or not at all
+func (mm *MetasMap) writeManifest(trace *sl.Trace, storage string, manifest *m.Manifest) error {
+	name := path.Join(m.DIR_STORAGES, storage, m.FILE_MANIFEST)
+	backuper := fsr.NewBackuper(trace, storage+m.FILE_MANIFEST)
+	backuper.AddForReplace(name + ".new")
+
+	if err := backuper.Commit(); err != nil {
+		return err
+	}
+
+	_, err := mm.fileSys.WriteFile(trace, name+".new", false, manifest)
+	return backuper.BackupIfErr(err)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 
 	"main/agents/log_utils"
+	"main/agents/time_range"
 	aerr "main/app_errors"
 	m "main/models"
 	"main/relays/file_sys"
@@ -18,6 +19,7 @@ import (
 type Reader struct {
 	columnQueues map[string]chan *m.ReadChunkTask
 	isRunned     bool
+	done         chan struct{}
 	fileSys      *file_sys.FileSys
 	selector     *log_utils.Selector
 }
@@ -25,6 +27,7 @@ type Reader struct {
 func NewReader() *Reader {
 	r := &Reader{
 		columnQueues: map[string]chan *m.ReadChunkTask{},
+		done:         make(chan struct{}),
 		fileSys:      &file_sys.FileSys{},
 		selector:     &log_utils.Selector{},
 	}
@@ -47,10 +50,15 @@ func (r *Reader) RunReader(queue <-chan *m.ReadLogsTask, metasMap *MetasMap) {
 	r.isRunned = true
 }
 
+// Wait waits until reader completes all tasks of the closed queue
+func (r *Reader) Wait() {
+	<-r.done
+}
+
 func (r *Reader) reader(queue <-chan *m.ReadLogsTask, metasMap *MetasMap) {
 	for task := range queue {
 		err := func() error {
-			lld, trace := task.Lld, task.Trace
+			lld, trace, ctx := task.Lld, task.Trace, task.Context()
 
 			defer trace.AddModule("_Reader", "reader")()
 			trace.STAGE(nil, "Reading logs from storage '", lld.Storage, "'...")
@@ -69,9 +77,28 @@ func (r *Reader) reader(queue <-chan *m.ReadLogsTask, metasMap *MetasMap) {
 			}
 
 			for _, meta := range metas {
-				logs := r.ReadChunk(trace, lld.Storage, meta, lld.Columns)
+				if ctx.Err() != nil {
+					err := aerr.FromContext(ctx.Err())
+					trace.NOTE(nil, "Reading stopped: ", err.Error())
+					return err
+				}
+
+				// Chunk is fully in range, so its meta is enough
+				if lld.UseMetas && time_range.IsInside(lld.TimeRange, meta.TimeRange) {
+					task.Metas = append(task.Metas, meta)
+					continue
+				}
+				logs, err := r.ReadChunk(trace, lld.Storage, meta, lld.Columns)
+
+				if err != nil {
+					return err
+				}
 				logs = r.selector.GetLogsInRange(trace, logs, lld.TimeRange, meta.Offsets == nil)
-				task.LogsCh <- logs
+
+				select {
+				case task.LogsCh <- logs:
+				case <-ctx.Done():
+				}
 			}
 
 			trace.STAGE(nil, "Logs readed")
@@ -81,9 +108,10 @@ func (r *Reader) reader(queue <-chan *m.ReadLogsTask, metasMap *MetasMap) {
 		task.ErrCh <- err
 		close(task.ErrCh)
 	}
+	close(r.done)
 }
 
-func (r *Reader) ReadChunk(trace *sl.Trace, storage string, meta *m.Meta, columns map[string]bool) []*m.Log {
+func (r *Reader) ReadChunk(trace *sl.Trace, storage string, meta *m.Meta, columns map[string]bool) ([]*m.Log, error) {
 	defer trace.AddModule("_Reader", "ReadChunk")()
 
 	name := path.Join(m.DIR_STORAGES, storage, meta.Name())
@@ -108,8 +136,13 @@ func (r *Reader) ReadChunk(trace *sl.Trace, storage string, meta *m.Meta, column
 	task.Wg.Wait()
 	sl.CloseTraces(task.Traces)
 
+	if err := task.Err(); err != nil {
+		trace.ERROR(nil, "Reading chunk ", storage, "/", meta.Name(), " failed: ", err.Error())
+		return nil, err
+	}
+
 	trace.DEBUG(nil, len(task.Logs), " logs readed from chunk: ", storage, "/", meta.Name())
-	return task.Logs
+	return task.Logs, nil
 }
 
 func (*Reader) getLine(data []byte, i int) ([]byte, int, error) {
@@ -133,9 +166,14 @@ func (r *Reader) columnReader(column string, queue <-chan *m.ReadChunkTask) {
 		trace := task.Traces[column]
 
 		name := path.Join(task.ChunkPath, column)
-		data := r.fileSys.ReadFile(trace, name)
+		data, err := r.fileSys.ReadFile(trace, name)
+
+		if err != nil {
+			task.SetErr(err)
+			task.Wg.Done()
+			continue
+		}
 
-		var err error
 		var line []byte
 		j := 0
 
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"path"
 	"sort"
 	"strings"
 	"sync"
@@ -16,6 +17,11 @@ import (
 	"main/tools"
 )
 
+const (
+	_PROBE_PERIOD = time.Second * 10
+	_SHED_CHUNKS  = 10 // max chunks deleted by disk watcher at once
+)
+
 type Scheduler struct {
 	sr       *Reader
 	sw       *Writer
@@ -27,6 +33,11 @@ type Scheduler struct {
 	isRunnedAligner        bool
 	isRunnedExpiredDeleter bool
 	isRunnedRemover        bool
+	isRunnedCheckpointer   bool
+	isRunnedProber         bool
+	isRunnedDiskWatcher    bool
+	stop                   chan struct{}
+	wg                     sync.WaitGroup
 }
 
 func NewScheduler(trace *sl.Trace, sr *Reader, sw *Writer, sd *Deleter, config m.SchedulerConfig) *Scheduler {
@@ -37,6 +48,35 @@ func NewScheduler(trace *sl.Trace, sr *Reader, sw *Writer, sd *Deleter, config m
 		config:   config,
 		fileSys:  &fsr.FileSys{},
 		selector: &log_utils.Selector{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Stop stops runned loops at safe points and waits for them
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) isStopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep returns false if scheduler is stopped while sleeping
+func (s *Scheduler) sleep(period time.Duration) bool {
+	timer := time.NewTimer(period)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
 	}
 }
 
@@ -44,6 +84,7 @@ func (s *Scheduler) RunAligner(metasMap *MetasMap) {
 	if s.isRunnedAligner {
 		return
 	}
+	s.wg.Add(1)
 	go s.aligner(metasMap)
 	s.isRunnedAligner = true
 }
@@ -51,6 +92,7 @@ func (s *Scheduler) RunAligner(metasMap *MetasMap) {
 func (s *Scheduler) aligner(metasMap *MetasMap) {
 	trace := sl.NewTrace("scheduler_aligner")
 	trace.SetEntity("aligner", uuid.New().String())
+	defer s.wg.Done()
 	id := &struct{}{}
 
 	for {
@@ -58,10 +100,21 @@ func (s *Scheduler) aligner(metasMap *MetasMap) {
 		storages := metasMap.Storages()
 		alignedCount := 0
 
+		// Aligning needs free space for new versions of chunks
+		if fsr.ReadOnlyErr() != nil {
+			trace.INFO(nil, "Server is read-only, aligning skipped")
+			storages = nil
+		}
+
 		for i := range storages {
+			if s.isStopped() {
+				break
+			}
+
 			// Get and lock chunks with crossed time ranges
 
 			unreserve := metasMap.ReserveVersion(trace, id)
+			release := metasMap.HoldManifest()
 			crossedMetas := metasMap.GetFulledCrossedMetas(trace, storages[i])
 			mxs := make([]*sync.Mutex, len(crossedMetas))
 
@@ -78,32 +131,27 @@ func (s *Scheduler) aligner(metasMap *MetasMap) {
 				for _, mx := range mxs {
 					mx.Unlock()
 				}
+				release()
 
 				trace.DEBUG(nil, "No chunks aligned in storage: ", storages[i])
 				continue
 			}
 
-			// Read and align chunks
-
-			logPacks := make([][]*m.Log, len(crossedMetas))
-
-			for j := range crossedMetas {
-				logPacks[j] = s.sr.ReadChunk(trace, storages[i], crossedMetas[j], nil)
-			}
-
-			s.AlignChunks(logPacks)
+			// Read and align chunks, on error chunks stay as is
 
-			// Write aligned chunks with new version
+			err := s.alignChunks(trace, storages[i], crossedMetas)
 
-			backuper := fsr.NewBackuper(trace, fmt.Sprintf("%s_%d", storages[i], crossedMetas[0].ID))
+			if err != nil {
+				unreserve(trace)
 
-			chunkNames := make([]string, len(crossedMetas))
+				for _, mx := range mxs {
+					mx.Unlock()
+				}
+				release()
 
-			for j, meta := range crossedMetas {
-				chunkNames[j] = meta.Name()
-				s.sw.WriteNewVersionChunk(trace, storages[i], meta, logPacks[j], backuper)
+				trace.ERROR(nil, "Aligning chunks in storage '", storages[i], "' failed: ", err.Error())
+				continue
 			}
-			backuper.Cancel()
 
 			// Set state
 
@@ -115,20 +163,55 @@ func (s *Scheduler) aligner(metasMap *MetasMap) {
 					for _, mx := range mxs {
 						mx.Unlock()
 					}
+					release()
 				},
 			})
 			unreserve(trace)
 			alignedCount += len(crossedMetas)
-
-			trace.DEBUG(
-				sl.Fields{"chunks": strings.Join(chunkNames, ", ")},
-				len(crossedMetas), " chunks aligned in storage: ", storages[i],
-			)
+			trace.DEBUG(nil, len(crossedMetas), " chunks aligned in storage: ", storages[i])
 		}
 
 		trace.INFO(nil, alignedCount, " chunks aligned")
-		time.Sleep(s.config.AligningPeriod)
+
+		if !s.sleep(s.config.AligningPeriod) {
+			trace.INFO(nil, "Aligner stopped")
+			return
+		}
+	}
+}
+
+// alignChunks writes aligned chunks with new version. On error written files are rolled back
+func (s *Scheduler) alignChunks(trace *sl.Trace, storage string, metas []*m.Meta) error {
+	logPacks := make([][]*m.Log, len(metas))
+	var err error
+
+	for j := range metas {
+		logPacks[j], err = s.sr.ReadChunk(trace, storage, metas[j], nil)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	s.AlignChunks(logPacks)
+
+	backuper := fsr.NewBackuper(trace, fmt.Sprintf("%s_%d", storage, metas[0].ID))
+	chunkNames := make([]string, len(metas))
+
+	for j, meta := range metas {
+		chunkNames[j] = meta.Name()
+
+		if _, err = s.sw.WriteNewVersionChunk(trace, storage, meta, logPacks[j], backuper); err != nil {
+			break
+		}
+	}
+
+	if err = backuper.BackupIfErr(err); err != nil {
+		return err
 	}
+
+	trace.DEBUG(sl.Fields{"chunks": strings.Join(chunkNames, ", ")}, "Chunks written with new version")
+	return nil
 }
 
 func (*Scheduler) AlignChunks(logPacks [][]*m.Log) {
@@ -152,6 +235,7 @@ func (s *Scheduler) RunExpiredDeleter(metasMap *MetasMap) {
 	if s.isRunnedExpiredDeleter {
 		return
 	}
+	s.wg.Add(1)
 	go s.expiredDeleter(metasMap)
 	s.isRunnedExpiredDeleter = true
 }
@@ -159,6 +243,7 @@ func (s *Scheduler) RunExpiredDeleter(metasMap *MetasMap) {
 func (s *Scheduler) expiredDeleter(metasMap *MetasMap) {
 	trace := sl.NewTrace("scheduler_expiredDeleter")
 	trace.SetEntity("expiredDeleter", uuid.New().String())
+	defer s.wg.Done()
 
 	for {
 		trace.INFO(nil, "Deleting expired chunks...")
@@ -166,6 +251,10 @@ func (s *Scheduler) expiredDeleter(metasMap *MetasMap) {
 		delCount := 0
 
 		for i := range storages {
+			if s.isStopped() {
+				break
+			}
+
 			unreserve := metasMap.ReserveVersion(trace, trace)
 
 			deadline := time.Now().Add(-s.config.LogsTTL).UnixMilli()
@@ -177,39 +266,70 @@ func (s *Scheduler) expiredDeleter(metasMap *MetasMap) {
 				continue
 			}
 
-			backuper := fsr.NewBackuper(trace, fmt.Sprintf("%s_%d", storages[i], expired[0].ID))
+			err := s.deleteChunks(trace, metasMap, storages[i], expired)
+			unreserve(trace)
 
-			for _, meta := range expired {
-				meta.Mx.Lock()
-				s.sd.MarkChunkAsDeleted(trace, storages[i], meta, backuper)
+			if err != nil {
+				trace.ERROR(nil, "Deleting expired chunks in storage '", storages[i], "' failed: ", err.Error())
+				continue
 			}
-			backuper.Cancel()
-
-			metasMap.Update(&m.UpdateStateTask{
-				Storage:   storages[i],
-				ForUpdate: expired,
-				Trace:     trace,
-				Callback: func() {
-					for _, meta := range expired {
-						meta.Mx.Unlock()
-					}
-				},
-			})
-			unreserve(trace)
 
 			delCount += len(expired)
 			trace.DEBUG(nil, len(expired), " chunks deleted from storage: ", storages[i])
 		}
 
 		trace.INFO(nil, delCount, " expired chunks deleted")
-		time.Sleep(s.config.DelExpiredPeriod)
+
+		if !s.sleep(s.config.DelExpiredPeriod) {
+			trace.INFO(nil, "Expired deleter stopped")
+			return
+		}
+	}
+}
+
+// deleteChunks virtually deletes chunks, so they are removed by remover. On error chunks are rolled back
+func (s *Scheduler) deleteChunks(trace *sl.Trace, metasMap *MetasMap, storage string, metas []*m.Meta) error {
+	backuper := fsr.NewBackuper(trace, fmt.Sprintf("%s_%d", storage, metas[0].ID))
+	release := metasMap.HoldManifest()
+	var err error
+
+	for _, meta := range metas {
+		meta.Mx.Lock()
+	}
+
+	for _, meta := range metas {
+		if err = s.sd.MarkChunkAsDeleted(trace, storage, meta, backuper); err != nil {
+			break
+		}
 	}
+
+	if err = backuper.BackupIfErr(err); err != nil {
+		for _, meta := range metas {
+			meta.Mx.Unlock()
+		}
+		release()
+		return err
+	}
+
+	metasMap.Update(&m.UpdateStateTask{
+		Storage:   storage,
+		ForUpdate: metas,
+		Trace:     trace,
+		Callback: func() {
+			for _, meta := range metas {
+				meta.Mx.Unlock()
+			}
+			release()
+		},
+	})
+	return nil
 }
 
 func (s *Scheduler) RunRemover(metasMap *MetasMap) {
 	if s.isRunnedRemover {
 		return
 	}
+	s.wg.Add(1)
 	go s.remover(metasMap)
 	s.isRunnedRemover = true
 }
@@ -217,19 +337,204 @@ func (s *Scheduler) RunRemover(metasMap *MetasMap) {
 func (s *Scheduler) remover(metasMap *MetasMap) {
 	trace := sl.NewTrace("scheduler_remover")
 	trace.SetEntity("remover", uuid.New().String())
+	defer s.wg.Done()
 
 	for {
-		time.Sleep(s.config.RmFilesPeriod)
+		if !s.sleep(s.config.RmFilesPeriod) {
+			trace.INFO(nil, "Remover stopped")
+			return
+		}
 		trace.INFO(nil, "Removing files/dirs...")
+		removed := s.removeFiles(trace, metasMap)
+		trace.INFO(nil, removed, " files/dirs removed")
+	}
+}
 
-		names := metasMap.GetForRemove()
+// removeFiles physically removes files/dirs, which are not used anymore
+func (s *Scheduler) removeFiles(trace *sl.Trace, metasMap *MetasMap) (removed int) {
+	// Names are taken under manifest, so checkpoint has them until they are removed
+	release := metasMap.HoldManifest()
+	defer release()
 
-		if len(names) == 0 {
-			trace.INFO(nil, "No files/dirs removed")
+	names := metasMap.GetForRemove()
+
+	if len(names) == 0 {
+		return 0
+	}
+
+	err := s.fileSys.AtomicRemove(trace, names...)
+
+	if err != nil {
+		metasMap.ReturnForRemove(names)
+		trace.ERROR(nil, "Removing files/dirs failed: ", err.Error())
+		return 0
+	}
+	return len(names)
+}
+
+func (s *Scheduler) RunProber() {
+	if s.isRunnedProber {
+		return
+	}
+	s.wg.Add(1)
+	go s.prober()
+	s.isRunnedProber = true
+}
+
+// prober switches off read-only mode, when disk is writable again
+func (s *Scheduler) prober() {
+	trace := sl.NewTrace("scheduler_prober")
+	trace.SetEntity("prober", uuid.New().String())
+	defer s.wg.Done()
+
+	for {
+		if !s.sleep(_PROBE_PERIOD) {
+			trace.INFO(nil, "Prober stopped")
+			return
+		}
+
+		if reason, _ := fsr.ReadOnlyStatus(); reason != "" {
+			s.fileSys.ProbeWrite(trace)
+		}
+	}
+}
+
+func (s *Scheduler) RunCheckpointer(metasMap *MetasMap) {
+	if s.isRunnedCheckpointer {
+		return
+	}
+	s.wg.Add(1)
+	go s.checkpointer(metasMap)
+	s.isRunnedCheckpointer = true
+}
+
+func (s *Scheduler) checkpointer(metasMap *MetasMap) {
+	trace := sl.NewTrace("scheduler_checkpointer")
+	trace.SetEntity("checkpointer", uuid.New().String())
+	defer s.wg.Done()
+
+	for {
+		trace.INFO(nil, "Writing manifests...")
+		written := metasMap.Checkpoint(trace)
+		trace.INFO(nil, written, " manifests written")
+
+		if !s.sleep(s.config.CheckpointPeriod) {
+			// Last checkpoint after stopping of writers and deleters
+			metasMap.Checkpoint(trace)
+			trace.INFO(nil, "Checkpointer stopped")
+			return
+		}
+	}
+}
+
+func (s *Scheduler) RunDiskWatcher(metasMap *MetasMap, config m.DiskConfig, dataDirs []string) {
+	if s.isRunnedDiskWatcher {
+		return
+	}
+	s.wg.Add(1)
+	go s.diskWatcher(metasMap, config, dataDirs)
+	s.isRunnedDiskWatcher = true
+}
+
+// diskWatcher checks free space of data volumes. Below soft limit it deletes the oldest chunks
+// of sheddable storages, below hard limit writing of logs is rejected
+func (s *Scheduler) diskWatcher(metasMap *MetasMap, config m.DiskConfig, dataDirs []string) {
+	trace := sl.NewTrace("scheduler_diskWatcher")
+	trace.SetEntity("diskWatcher", uuid.New().String())
+	defer s.wg.Done()
+
+	dirs := append([]string{""}, dataDirs...)
+	shed := []string{}
+
+	for {
+		free, ok := s.minFreeSpace(trace, dirs)
+
+		if ok {
+			fsr.SetLowSpace(trace, config.HardLimit > 0 && free < config.HardLimit)
+
+			if config.SoftLimit > 0 && free < config.SoftLimit && len(config.Sheddable) > 0 {
+				trace.WARN(nil, "Free space is below soft limit: ", free, " bytes")
+				shed = s.shed(trace, metasMap, config.Sheddable, shed)
+			}
+		}
+
+		if !s.sleep(config.CheckPeriod) {
+			trace.INFO(nil, "Disk watcher stopped")
+			return
+		}
+	}
+}
+
+func (s *Scheduler) minFreeSpace(trace *sl.Trace, dirs []string) (minFree int64, ok bool) {
+	for _, dir := range dirs {
+		free, err := s.fileSys.FreeSpace(trace, dir)
+
+		if err != nil {
+			continue
+		}
+
+		if !ok || int64(free) < minFree {
+			minFree, ok = int64(free), true
+		}
+	}
+	return minFree, ok
+}
+
+// shed deletes the oldest chunks of sheddable storages and removes them at once.
+// Chunks are not shed again, until previously shed chunks are removed
+func (s *Scheduler) shed(trace *sl.Trace, metasMap *MetasMap, storages []string, pending []string) (shed []string) {
+	defer trace.AddModule("_Scheduler", "shed")()
+
+	for _, name := range pending {
+		if ok, _ := s.fileSys.Exists(trace, name); ok {
+			s.removeFiles(trace, metasMap)
+			trace.DEBUG(nil, "Shed chunks are not removed yet")
+			return pending
+		}
+	}
+
+	type chunk struct {
+		storage string
+		meta    *m.Meta
+	}
+
+	unreserve := metasMap.ReserveVersion(trace, trace)
+	chunks := []chunk{}
+
+	for _, storage := range storages {
+		for _, meta := range metasMap.GetOldest(trace, storage, _SHED_CHUNKS) {
+			chunks = append(chunks, chunk{storage, meta})
+		}
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].meta.TimeRange.End < chunks[j].meta.TimeRange.End
+	})
+
+	if len(chunks) > _SHED_CHUNKS {
+		chunks = chunks[:_SHED_CHUNKS]
+	}
+
+	byStorage := map[string][]*m.Meta{}
+
+	for _, c := range chunks {
+		byStorage[c.storage] = append(byStorage[c.storage], c.meta)
+	}
+
+	for storage, metas := range byStorage {
+		if err := s.deleteChunks(trace, metasMap, storage, metas); err != nil {
+			trace.ERROR(nil, "Shedding chunks of storage '", storage, "' failed: ", err.Error())
 			continue
 		}
 
-		s.fileSys.AtomicRemove(trace, names...)
-		trace.INFO(nil, len(names), " files/dirs removed")
+		for _, meta := range metas {
+			shed = append(shed, path.Join(m.DIR_STORAGES, storage, meta.Name()))
+		}
 	}
+	unreserve(trace)
+
+	s.removeFiles(trace, metasMap)
+
+	trace.WARN(nil, len(shed), " oldest chunks of sheddable storages deleted")
+	return shed
 }
@@ -1,11 +1,13 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"sort"
 	"testing"
+	"time"
 
 	sl "github.com/j-hitgate/sherlog"
 	"github.com/stretchr/testify/assert"
@@ -51,7 +53,7 @@ func TestWriterAndReader(t *testing.T) {
 
 	sw := NewWriter(maxLogsInChunk)
 	writeQueue := make(chan *m.WriteLogsTask, 1)
-	sw.RunWriter(writeQueue, 0, map[string]uint64{"storage": 1}, 1, metasMap)
+	sw.RunWriter(writeQueue, 0, map[string]uint64{"storage": 1}, 1, metasMap, NewBatchesMap(m.MAX_BATCH_IDS))
 
 	writeTask := &m.WriteLogsTask{
 		Storage: "storage",
@@ -199,7 +201,7 @@ func TestDeleter(t *testing.T) {
 	sd.DeleteByTimeRange(trace, "storage", metas[1], tr, backuper)
 	backuper.Cancel()
 
-	logPack := sr.ReadChunk(trace, "storage", metas[1], nil)
+	logPack, _ := sr.ReadChunk(trace, "storage", metas[1], nil)
 
 	if metas[1].Version != 2 || len(logPack) != 2 || logPack[0].Level != 1 || logPack[1].Level != 4 {
 		assert.Fail(t, "Delete by time range -> Chunk: ", metas[1].Name(), ", Len: ", len(logPack))
@@ -221,7 +223,7 @@ func TestDeleter(t *testing.T) {
 	sd.DeleteByCondition(trace, "storage", metas[2], tr, cond, backuper)
 	backuper.Cancel()
 
-	logPack = sr.ReadChunk(trace, "storage", metas[2], nil)
+	logPack, _ = sr.ReadChunk(trace, "storage", metas[2], nil)
 
 	if metas[2].Version != 2 || len(logPack) != 3 || logPack[0].Level != 4 || logPack[1].Level != 5 || logPack[2].Level != 4 {
 		assert.Fail(t, "Delete by time range -> Chunk: ", metas[1].Name(), ", Len: ", len(logPack))
@@ -258,3 +260,184 @@ func TestAlignChunks(t *testing.T) {
 		return logs[i].Timestamp < logs[j].Timestamp
 	}))
 }
+
+func TestReaderCanceled(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	metasMap := NewMetasMap(100)
+	metasMap.AddStorage(trace, "storage", []*m.Meta{
+		{ID: 1, Version: 1, TimeRange: m.TimeRange{Start: 1, End: 4}, LogsLen: 4},
+	})
+
+	sr := NewReader()
+	readQueue := make(chan *m.ReadLogsTask, 1)
+	sr.RunReader(readQueue, metasMap)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	readTask := &m.ReadLogsTask{
+		Lld:    &m.LoadLogsData{Storage: "storage"},
+		LogsCh: make(chan []*m.Log, 1),
+		ErrCh:  make(chan error, 1),
+		Trace:  trace,
+		Ctx:    ctx,
+	}
+	readQueue <- readTask
+
+	for range readTask.LogsCh {
+		assert.Fail(t, "Logs readed after canceling")
+	}
+	assert.Error(t, <-readTask.ErrCh)
+}
+
+func TestStop(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	metasMap := NewMetasMap(100)
+	metasMap.AddStorage(trace, "storage", []*m.Meta{})
+
+	sw := NewWriter(3)
+	writeQueue := make(chan *m.WriteLogsTask, 1)
+	sw.RunWriter(writeQueue, 0, map[string]uint64{}, 1, metasMap, NewBatchesMap(m.MAX_BATCH_IDS))
+
+	sr := NewReader()
+	readQueue := make(chan *m.ReadLogsTask, 1)
+	sr.RunReader(readQueue, metasMap)
+
+	sd := NewDeleter(sr, sw)
+	deleteQueue := make(chan *m.DeleteQuery, 1)
+	sd.RunDeleter(deleteQueue, metasMap)
+
+	scheduler := NewScheduler(trace, sr, sw, NewDeleter(sr, sw), m.SchedulerConfig{
+		LogsTTL:          time.Hour,
+		AligningPeriod:   time.Hour,
+		DelExpiredPeriod: time.Hour,
+		RmFilesPeriod:    time.Hour,
+	})
+	scheduler.RunAligner(metasMap)
+	scheduler.RunExpiredDeleter(metasMap)
+	scheduler.RunRemover(metasMap)
+
+	stopped := make(chan struct{})
+
+	go func() {
+		close(writeQueue)
+		close(readQueue)
+		close(deleteQueue)
+
+		sw.Wait()
+		sr.Wait()
+		sd.Stop()
+		scheduler.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "Agents are not stopped")
+	}
+}
+
+func TestRepeatedBatch(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	storagePath := path.Join(m.DIR_STORAGES, "storage")
+	os.MkdirAll(storagePath, 0755)
+	defer os.RemoveAll(m.DIR_TRANSACTIONS)
+	defer os.RemoveAll(m.DIR_STORAGES)
+
+	metasMap := NewMetasMap(100)
+	metasMap.AddStorage(trace, "storage", []*m.Meta{})
+	batchesMap := NewBatchesMap(m.MAX_BATCH_IDS)
+
+	sw := NewWriter(10)
+	writeQueue := make(chan *m.WriteLogsTask, 1)
+	sw.RunWriter(writeQueue, 0, map[string]uint64{}, 1, metasMap, batchesMap)
+
+	write := func(batchID string) error {
+		task := &m.WriteLogsTask{
+			Storage: "storage",
+			BatchID: batchID,
+			Logs:    []*m.Log{tt.CreateLog()},
+			ErrCh:   make(chan error, 1),
+			Trace:   trace,
+		}
+		writeQueue <- task
+		return <-task.ErrCh
+	}
+
+	assert.NoError(t, write("b1"))
+	assert.NoError(t, write("b1"), "repeat is answered as saved")
+	assert.NoError(t, write("b2"))
+	close(writeQueue)
+	sw.Wait()
+
+	meta := metasMap.Find(trace, "storage", 1)
+
+	if assert.NotNil(t, meta) {
+		assert.Equal(t, 2, meta.LogsLen, "repeat is not written")
+	}
+
+	data, _ := os.ReadFile(path.Join(storagePath, m.FILE_BATCHES+"0"))
+	assert.Equal(t, "b1\nb2\n", string(data), "batch IDs are saved")
+
+	// Saved IDs are read at startup
+
+	batchesMap = NewBatchesMap(m.MAX_BATCH_IDS)
+	batchesMap.AddStorage("storage", (&fsr.FileSys{}).ReadBatches(trace, "storage"))
+
+	saved, _ := batchesMap.Begin(trace, "storage", "b2")
+	assert.True(t, saved)
+}
+
+func TestWriteSeveralStorages(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	defer os.RemoveAll(m.DIR_TRANSACTIONS)
+	defer os.RemoveAll(m.DIR_STORAGES)
+
+	metasMap := NewMetasMap(100)
+
+	for _, storage := range []string{"a", "b"} {
+		os.MkdirAll(path.Join(m.DIR_STORAGES, storage), 0755)
+		metasMap.AddStorage(trace, storage, []*m.Meta{})
+	}
+
+	sw := NewWriter(10)
+	writeQueue := make(chan *m.WriteLogsTask, 1)
+	sw.RunWriter(writeQueue, 0, map[string]uint64{}, 1, metasMap, NewBatchesMap(m.MAX_BATCH_IDS))
+
+	write := func(others ...*m.Logs) error {
+		task := &m.WriteLogsTask{
+			Storage: "b",
+			Logs:    []*m.Log{tt.CreateLog(), tt.CreateLog()},
+			Others:  others,
+			ErrCh:   make(chan error, 1),
+			Trace:   trace,
+		}
+		writeQueue <- task
+		return <-task.ErrCh
+	}
+
+	assert.NoError(t, write(&m.Logs{Storage: "a", Logs: []*m.Log{tt.CreateLog()}}))
+
+	// No storage, so nothing is written
+	assert.Error(t, write(&m.Logs{Storage: "c", Logs: []*m.Log{tt.CreateLog()}}))
+
+	close(writeQueue)
+	sw.Wait()
+
+	for storage, logsLen := range map[string]int{"a": 1, "b": 2} {
+		meta := metasMap.Find(trace, storage, 1)
+
+		if assert.NotNil(t, meta, storage) {
+			assert.Equal(t, logsLen, meta.LogsLen, storage)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"path"
@@ -16,10 +17,13 @@ import (
 	"main/tools"
 )
 
+const _BATCHES_FILE_SIZE = 1 << 20
+
 type Writer struct {
 	maxLogsInChunk int
 	columnQueues   []chan *m.WriteToChunkTask
 	isRunned       bool
+	done           chan struct{}
 	fileSys        *fsr.FileSys
 }
 
@@ -29,6 +33,7 @@ func NewWriter(maxLogsInChunk int) *Writer {
 	w := &Writer{
 		maxLogsInChunk: maxLogsInChunk,
 		columnQueues:   make([]chan *m.WriteToChunkTask, len(columns)),
+		done:           make(chan struct{}),
 		fileSys:        &fsr.FileSys{},
 	}
 
@@ -40,7 +45,7 @@ func NewWriter(maxLogsInChunk int) *Writer {
 	return w
 }
 
-func (w *Writer) RunWriter(queue <-chan *m.WriteLogsTask, instanceNum uint64, firstRawChunks map[string]uint64, step uint64, metasMap *MetasMap) {
+func (w *Writer) RunWriter(queue <-chan *m.WriteLogsTask, instanceNum uint64, firstRawChunks map[string]uint64, step uint64, metasMap *MetasMap, batchesMap *BatchesMap) {
 	if w.isRunned {
 		return
 	}
@@ -49,111 +54,251 @@ func (w *Writer) RunWriter(queue <-chan *m.WriteLogsTask, instanceNum uint64, fi
 	for storage, id := range firstRawChunks {
 		chunksForWrite[storage] = id + instanceNum
 	}
-	go w.writer(queue, instanceNum, chunksForWrite, step, metasMap)
+	go w.writer(queue, instanceNum, chunksForWrite, step, metasMap, batchesMap)
 	w.isRunned = true
 }
 
-func (w *Writer) writer(queue <-chan *m.WriteLogsTask, instanceNum uint64, chunksForWrite map[string]uint64, step uint64, metasMap *MetasMap) {
+// Wait waits until writer completes all tasks of the closed queue
+func (w *Writer) Wait() {
+	<-w.done
+}
+
+func (w *Writer) writer(queue <-chan *m.WriteLogsTask, instanceNum uint64, chunksForWrite map[string]uint64, step uint64, metasMap *MetasMap, batchesMap *BatchesMap) {
 	sr := NewReader()
 	waitUpdates := &sync.WaitGroup{}
 
 	for task := range queue {
 		waitUpdates.Wait()
 
-		task.ErrCh <- func() error {
+		task.ErrCh <- func() (err error) {
 			trace := task.Trace
 
 			defer trace.AddModule("_Writer", "writer")()
-			trace.STAGE(nil, "Writing ", len(task.Logs), " logs to storage '", task.Storage, "'...")
+
+			if err := task.Context().Err(); err != nil {
+				err = aerr.FromContext(err)
+				trace.NOTE(nil, "Writing canceled: ", err.Error())
+				return err
+			}
+
+			// Batches of other storages are written under the same backup, so all are saved or none.
+			// They are sorted, so writers wait for batches in processing in the same order
+
+			parts := []*m.Logs{{Storage: task.Storage, BatchID: task.BatchID, Logs: task.Logs}}
+			parts = append(parts, task.Others...)
+
+			sort.Slice(parts, func(i, j int) bool {
+				return parts[i].Storage < parts[j].Storage
+			})
+
+			// Repeated batch is answered as saved without writing
+
+			toWrite := make([]*m.Logs, 0, len(parts))
+
+			for _, part := range parts {
+				if part.BatchID != "" {
+					saved, finish := batchesMap.Begin(trace, part.Storage, part.BatchID)
+
+					if saved {
+						trace.NOTE(nil, "Batch '", part.BatchID, "' is already saved")
+						continue
+					}
+					defer func() { finish(err == nil) }()
+				}
+				toWrite = append(toWrite, part)
+			}
+
+			if len(toWrite) == 0 {
+				return nil
+			}
+
+			for _, part := range toWrite {
+				if !metasMap.Exists(part.Storage) {
+					delete(chunksForWrite, part.Storage)
+					err := aerr.NewAppErr(aerr.NotFound, "Storage '", part.Storage, "' not exists")
+					trace.NOTE(nil, err.Error())
+					return err
+				}
+			}
 
 			defer metasMap.ReserveVersion(trace, w)(trace)
-			forUpdate, forAdd := []*m.Meta{}, []*m.Meta{}
 
-			// Get chunk id
+			// New chunks drop manifest, so it is held before chunks until state is updated
+			release := metasMap.HoldManifest()
+			var backuper *fsr.Backuper
+			updates := []*m.UpdateStateTask{}
+			nextIDs := map[string]uint64{}
 
-			id, ok := chunksForWrite[task.Storage]
+			// Written files are rolled back and state is not changed
+			rollback := func(err error) error {
+				backuper.Backup()
 
-			if !metasMap.Exists(task.Storage) {
-				if ok {
-					delete(chunksForWrite, task.Storage)
+				for _, update := range updates {
+					for _, meta := range update.ForUpdate {
+						meta.Mx.Unlock()
+					}
 				}
-				err := aerr.NewAppErr(aerr.NotFound, "Storage '", task.Storage, "' not exists")
-				trace.NOTE(nil, err.Error())
+				release()
+				trace.ERROR(nil, "Writing failed, changes rolled back: ", err.Error())
 				return err
 			}
 
-			if !ok {
-				id = 1 + instanceNum
-				chunksForWrite[task.Storage] = id
-			}
+			for _, part := range toWrite {
+				trace.STAGE(nil, "Writing ", len(part.Logs), " logs to storage '", part.Storage, "'...")
+
+				// Get chunk id
 
-			// Write logs
+				id, ok := chunksForWrite[part.Storage]
+
+				if !ok {
+					id = 1 + instanceNum
+				}
 
-			backuper := fsr.NewBackuper(trace, fmt.Sprintf("%s_%d", task.Storage, id))
-			writed := 0
+				if backuper == nil {
+					backuper = fsr.NewBackuper(trace, fmt.Sprintf("%s_%d", part.Storage, id))
+				}
 
-			for writed < len(task.Logs) {
-				meta := metasMap.Find(trace, task.Storage, id)
+				// Write logs
 
-				if meta != nil {
-					meta.Mx.Lock()
-					meta = metasMap.Find(trace, task.Storage, id)
-					forUpdate = append(forUpdate, meta)
-				} else {
-					meta = m.NewMeta(id, task.Logs[0].Timestamp)
-					forAdd = append(forAdd, meta)
+				update := &m.UpdateStateTask{
+					Storage:   part.Storage,
+					ForUpdate: []*m.Meta{},
+					ForAdd:    []*m.Meta{},
+					Trace:     trace,
 				}
+				updates = append(updates, update)
+				writed := 0
+
+				for writed < len(part.Logs) {
+					meta := metasMap.Find(trace, part.Storage, id)
+
+					if meta != nil {
+						meta.Mx.Lock()
+						meta = metasMap.Find(trace, part.Storage, id)
+						update.ForUpdate = append(update.ForUpdate, meta)
+					} else {
+						meta = m.NewMeta(id, part.Logs[0].Timestamp)
+						update.ForAdd = append(update.ForAdd, meta)
+						dropManifest(part.Storage, backuper)
+					}
+
+					totalLogs := meta.LogsLen + len(part.Logs) - writed
+					var logs []*m.Log
+
+					if totalLogs < w.maxLogsInChunk {
+						logs = part.Logs[writed:]
 
-				totalLogs := meta.LogsLen + len(task.Logs) - writed
-				var logs []*m.Log
+					} else {
+						var err error
+						logs, err = sr.ReadChunk(trace, part.Storage, meta, nil)
 
-				if totalLogs < w.maxLogsInChunk {
-					logs = task.Logs[writed:]
+						if err != nil {
+							return rollback(err)
+						}
 
-				} else {
-					logs = sr.ReadChunk(trace, task.Storage, meta, nil)
+						willWritten := w.maxLogsInChunk - meta.LogsLen
+						logs = tools.JoinSlices(logs, part.Logs[writed:writed+willWritten])
 
-					willWritten := w.maxLogsInChunk - meta.LogsLen
-					logs = tools.JoinSlices(logs, task.Logs[writed:writed+willWritten])
+						sort.Slice(logs, func(i, j int) bool {
+							return logs[i].Timestamp < logs[j].Timestamp
+						})
 
-					sort.Slice(logs, func(i, j int) bool {
-						return logs[i].Timestamp < logs[j].Timestamp
-					})
+						meta.Version++
+						meta.LogsLen = 0
+						dropManifest(part.Storage, backuper)
 
-					meta.Version++
-					meta.LogsLen = 0
+						id += step
+					}
+
+					n, err := w.WriteToChunk(trace, part.Storage, meta, logs, backuper)
+
+					if err != nil {
+						return rollback(err)
+					}
+					writed += n
+				}
 
-					id += step
+				if part.BatchID != "" {
+					if err := w.saveBatch(trace, part.Storage, part.BatchID, instanceNum, backuper); err != nil {
+						return rollback(err)
+					}
 				}
+				nextIDs[part.Storage] = id
+			}
 
-				writed += w.WriteToChunk(trace, task.Storage, meta, logs, backuper)
+			if err := backuper.Cancel(); err != nil {
+				return rollback(err)
 			}
+			waitUpdates.Add(len(updates))
 
-			backuper.Cancel()
-			waitUpdates.Add(1)
+			// Updates are set in order, so manifest is released after the last one
+			for i, update := range updates {
+				isLast := i == len(updates)-1
 
-			metasMap.Update(&m.UpdateStateTask{
-				Storage:   task.Storage,
-				ForUpdate: forUpdate,
-				ForAdd:    forAdd,
-				Trace:     trace,
-				Callback: func() {
-					for _, meta := range forUpdate {
+				update.Callback = func() {
+					for _, meta := range update.ForUpdate {
 						meta.Mx.Unlock()
 					}
+
+					if isLast {
+						release()
+					}
 					waitUpdates.Done()
-				},
-			})
-			chunksForWrite[task.Storage] = id
+				}
+				metasMap.Update(update)
+			}
+
+			for storage, id := range nextIDs {
+				chunksForWrite[storage] = id
+			}
 
 			trace.STAGE(nil, "Logs writed")
 			return nil
 		}()
 		close(task.ErrCh)
 	}
+	waitUpdates.Wait()
+	close(w.done)
+}
+
+// saveBatch appends batch ID to batches file of writer under backuper, so ID is saved with logs.
+// Big file is compacted to the newest half of IDs and replaced, when changes are accepted
+func (w *Writer) saveBatch(trace *sl.Trace, storage, batchID string, instanceNum uint64, backuper *fsr.Backuper) error {
+	defer trace.AddModule("_Writer", "saveBatch")()
+
+	name := path.Join(m.DIR_STORAGES, storage, fmt.Sprint(m.FILE_BATCHES, instanceNum))
+	record := []byte(batchID + "\n")
+	size := backuper.AddForCut(name)
+
+	if size+int64(len(record)) <= _BATCHES_FILE_SIZE {
+		if err := backuper.Commit(); err != nil {
+			return err
+		}
+		_, err := w.fileSys.AppendFile(trace, name, record)
+		return err
+	}
+
+	data, err := w.fileSys.ReadFile(trace, name)
+
+	if err != nil {
+		return err
+	}
+
+	data = data[len(data)/2:]
+	data = data[bytes.IndexByte(data, '\n')+1:]
+
+	backuper.AddForReplace(name + ".new")
+
+	if err = backuper.Commit(); err != nil {
+		return err
+	}
+	_, err = w.fileSys.WriteFile(trace, name+".new", false, append(data, record...))
+	return err
 }
 
-func (w *Writer) WriteNewVersionChunk(trace *sl.Trace, storage string, meta *m.Meta, logs []*m.Log, backuper *fsr.Backuper) (writed int) {
+// WriteNewVersionChunk writes chunk with new version. Manifest must be held until state is updated
+func (w *Writer) WriteNewVersionChunk(trace *sl.Trace, storage string, meta *m.Meta, logs []*m.Log, backuper *fsr.Backuper) (writed int, err error) {
+	dropManifest(storage, backuper)
 	meta.Version++
 	meta.LogsLen = 0
 
@@ -169,14 +314,15 @@ func (w *Writer) WriteNewVersionChunk(trace *sl.Trace, storage string, meta *m.M
 	return w.WriteToChunk(trace, storage, meta, logs, backuper)
 }
 
-func (w *Writer) WriteToChunk(trace *sl.Trace, storage string, meta *m.Meta, logs []*m.Log, backuper *fsr.Backuper) (writed int) {
+// WriteToChunk changes files under backuper. On error the changes must be rolled back by backuper
+func (w *Writer) WriteToChunk(trace *sl.Trace, storage string, meta *m.Meta, logs []*m.Log, backuper *fsr.Backuper) (writed int, err error) {
 	defer trace.AddModule("_Writer", "WriteToChunk")()
 
 	// Calculate logs to append
 
 	if len(logs) == 0 {
 		trace.WARN(nil, "No logs to write")
-		return 0
+		return 0, nil
 	}
 
 	free := w.maxLogsInChunk - meta.LogsLen
@@ -184,7 +330,7 @@ func (w *Writer) WriteToChunk(trace *sl.Trace, storage string, meta *m.Meta, log
 
 	if willWritten == 0 {
 		trace.WARN(nil, "No logs written")
-		return 0
+		return 0, nil
 	}
 
 	meta.LogsLen += willWritten
@@ -198,7 +344,10 @@ func (w *Writer) WriteToChunk(trace *sl.Trace, storage string, meta *m.Meta, log
 	name := path.Join(m.DIR_STORAGES, storage, meta.Name())
 
 	backuper.AddChunk(name, meta.Offsets)
-	backuper.Commit()
+
+	if err = backuper.Commit(); err != nil {
+		return 0, err
+	}
 
 	task := m.NewWriteToChunkTask(trace, name, meta, logs[:willWritten])
 	task.Wg.Add(len(w.columnQueues))
@@ -209,13 +358,20 @@ func (w *Writer) WriteToChunk(trace *sl.Trace, storage string, meta *m.Meta, log
 	task.Wg.Wait()
 	sl.CloseTraces(task.Traces)
 
+	if err = task.Err(); err != nil {
+		return 0, err
+	}
+
 	// Save meta
 
 	name = path.Join(name, "meta.new")
-	w.fileSys.WriteFile(trace, name, false, meta)
+
+	if _, err = w.fileSys.WriteFile(trace, name, false, meta); err != nil {
+		return 0, err
+	}
 
 	trace.DEBUG(nil, willWritten, "/", len(logs), " logs written in chunk: ", storage, "/", meta.Name())
-	return willWritten
+	return willWritten, nil
 }
 
 func (*Writer) lenToBytes(data []byte) []byte {
@@ -255,7 +411,12 @@ func (w *Writer) columnWriter(column string, queue <-chan *m.WriteToChunkTask) {
 			}
 
 			name := path.Join(task.ChunkPath, column)
-			n := w.fileSys.AppendFile(trace, name, buffs)
+			n, err := w.fileSys.AppendFile(trace, name, buffs)
+
+			if err != nil {
+				task.SetErr(err)
+				return
+			}
 
 			if meta.Offsets != nil {
 				offset, _ := meta.Offsets.Get(column)
@@ -0,0 +1,224 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+
+	m "main/models"
+)
+
+const (
+	_MAX_FRAME    = 64 << 10 // max size of message
+	_MAX_LEN_SIZE = 7        // max digits of length of octet-counted frame
+)
+
+// Listener receives syslog messages over UDP and TCP and passes parsed logs to handler.
+// Frames of TCP are octet-counted ("LEN MSG") or separated by new lines (RFC 6587)
+type Listener struct {
+	handle func(l *m.Log)
+	udp    net.PacketConn
+	tcp    net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	mx     sync.Mutex
+	wg     sync.WaitGroup
+}
+
+func NewListener(handle func(l *m.Log)) *Listener {
+	return &Listener{
+		handle: handle,
+		conns:  map[net.Conn]struct{}{},
+	}
+}
+
+// Run listens addresses, empty address is not listened
+func (ln *Listener) Run(trace *sl.Trace, udpAddr, tcpAddr string) error {
+	defer trace.AddModule("_Listener", "Run")()
+
+	if udpAddr != "" {
+		udp, err := net.ListenPacket("udp", udpAddr)
+
+		if err != nil {
+			return err
+		}
+		ln.udp = udp
+
+		ln.wg.Add(1)
+		go ln.readUDP()
+		trace.INFO(nil, "Syslog is listened on UDP ", udp.LocalAddr().String())
+	}
+
+	if tcpAddr != "" {
+		tcp, err := net.Listen("tcp", tcpAddr)
+
+		if err != nil {
+			ln.Stop()
+			return err
+		}
+		ln.tcp = tcp
+
+		ln.wg.Add(1)
+		go ln.acceptTCP()
+		trace.INFO(nil, "Syslog is listened on TCP ", tcp.Addr().String())
+	}
+	return nil
+}
+
+// Stop closes sockets and connections and waits for handling of received messages
+func (ln *Listener) Stop() {
+	ln.mx.Lock()
+	ln.closed = true
+
+	if ln.udp != nil {
+		ln.udp.Close()
+	}
+
+	if ln.tcp != nil {
+		ln.tcp.Close()
+	}
+
+	for conn := range ln.conns {
+		conn.Close()
+	}
+	ln.mx.Unlock()
+
+	ln.wg.Wait()
+}
+
+func (ln *Listener) readUDP() {
+	trace := sl.NewTrace("syslog_udp")
+	trace.SetEntity("udpReader", uuid.New().String())
+	defer ln.wg.Done()
+
+	buf := make([]byte, _MAX_FRAME)
+
+	for {
+		n, _, err := ln.udp.ReadFrom(buf)
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				trace.INFO(nil, "UDP reader stopped")
+				return
+			}
+			trace.WARN(nil, "Reading of UDP error: ", err.Error())
+			continue
+		}
+		ln.parse(trace, buf[:n])
+	}
+}
+
+func (ln *Listener) acceptTCP() {
+	trace := sl.NewTrace("syslog_tcp")
+	trace.SetEntity("tcpAcceptor", uuid.New().String())
+	defer ln.wg.Done()
+
+	for {
+		conn, err := ln.tcp.Accept()
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				trace.INFO(nil, "TCP acceptor stopped")
+				return
+			}
+			trace.WARN(nil, "Accepting of TCP error: ", err.Error())
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+
+		ln.mx.Lock()
+
+		if ln.closed {
+			ln.mx.Unlock()
+			conn.Close()
+			return
+		}
+		ln.conns[conn] = struct{}{}
+		ln.wg.Add(1)
+		ln.mx.Unlock()
+
+		go ln.readTCP(conn)
+	}
+}
+
+func (ln *Listener) readTCP(conn net.Conn) {
+	trace := sl.NewTrace("syslog_tcp")
+	trace.SetEntity("tcpReader", conn.RemoteAddr().String())
+	defer ln.wg.Done()
+
+	defer func() {
+		ln.mx.Lock()
+		delete(ln.conns, conn)
+		ln.mx.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, _MAX_FRAME)
+
+	for {
+		frame, err := readFrame(r)
+
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				trace.NOTE(nil, "Reading of TCP error: ", err.Error())
+			}
+			return
+		}
+		ln.parse(trace, frame)
+	}
+}
+
+func (ln *Listener) parse(trace *sl.Trace, frame []byte) {
+	l, err := Parse(frame, time.Now())
+
+	if err != nil {
+		trace.NOTE(nil, "Incorrect syslog message: ", err.Error())
+		return
+	}
+	ln.handle(l)
+}
+
+// readFrame reads octet-counted frame, if it starts with digit, else frame till new line
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] < '0' || first[0] > '9' {
+		line, err := r.ReadSlice('\n')
+
+		if err == bufio.ErrBufferFull {
+			return nil, errors.New("message is larger than " + strconv.Itoa(_MAX_FRAME) + " bytes")
+		}
+
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		return line, err
+	}
+
+	lenStr, err := r.ReadSlice(' ')
+
+	if err != nil || len(lenStr) > _MAX_LEN_SIZE+1 {
+		return nil, errors.New("incorrect length of message")
+	}
+
+	size, err := strconv.Atoi(string(lenStr[:len(lenStr)-1]))
+
+	if err != nil || size > _MAX_FRAME {
+		return nil, errors.New("incorrect length of message: " + string(lenStr))
+	}
+
+	frame := make([]byte, size)
+	_, err = io.ReadFull(r, frame)
+	return frame, err
+}
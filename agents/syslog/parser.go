@@ -0,0 +1,313 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	m "main/models"
+	"main/tools"
+)
+
+const _NIL = "-" // nil value of RFC 5424
+
+var _facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Syslog severity (0 - emergency, 7 - debug) to level of log
+var _severityToLevel = [8]byte{7, 7, 7, 6, 5, 3, 4, 1}
+
+// Parse parses syslog message of RFC 5424 or RFC 3164 to log. Severity is level,
+// app name (tag) is entity, proc ID (or message ID) is entity ID, facility is module,
+// structured data and hostname are fields. Message without time gets 'now'
+func Parse(frame []byte, now time.Time) (*m.Log, error) {
+	frame = bytes.TrimRight(frame, "\r\n\x00")
+	p := &parser{data: string(frame)}
+
+	pri, err := p.priority()
+
+	if err != nil {
+		return nil, err
+	}
+
+	l := &m.Log{
+		Level:   _severityToLevel[pri%8],
+		Modules: []string{_facilities[pri/8]},
+		Traces:  []string{_NIL},
+	}
+
+	var msg *message
+
+	if p.startsWith("1 ") {
+		p.i += 2
+		msg, err = p.rfc5424()
+	} else {
+		msg, err = p.rfc3164(now), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.time.IsZero() {
+		msg.time = now
+	}
+	l.Timestamp = msg.time.UnixMilli()
+
+	l.Entity = tools.Cut(tools.FirstNotEmpty(msg.appName, "unknown"), m.MAX_VALUE_LEN)
+	l.EntityID = tools.Cut(tools.FirstNotEmpty(msg.procID, msg.msgID, _NIL), m.MAX_VALUE_LEN)
+
+	text := strings.TrimSpace(strings.TrimPrefix(msg.text, "\ufeff"))
+	l.Message = tools.FirstNotEmpty(tools.Cut(text, m.MAX_MESSAGE_LEN), _NIL)
+
+	// Fields
+
+	if msg.hostname != "" {
+		msg.fields = append([][2]string{{"host", msg.hostname}}, msg.fields...)
+	}
+
+	for _, kv := range msg.fields {
+		key, value := tools.Cut(kv[0], m.MAX_VALUE_LEN), tools.Cut(kv[1], m.MAX_VALUE_LEN)
+
+		if key == "" || value == "" || len(l.Fields) == m.MAX_ITEMS {
+			continue
+		}
+
+		if l.Fields == nil {
+			l.Fields = map[string]string{}
+		}
+		l.Fields[key] = value
+	}
+	return l, nil
+}
+
+type message struct {
+	time     time.Time
+	hostname string
+	appName  string
+	procID   string
+	msgID    string
+	fields   [][2]string // params of structured data as "SD-ID.NAME"
+	text     string
+}
+
+type parser struct {
+	data string
+	i    int
+}
+
+func (p *parser) startsWith(s string) bool {
+	return strings.HasPrefix(p.data[p.i:], s)
+}
+
+// word reads value till space and skips the space
+func (p *parser) word() (string, bool) {
+	rest := p.data[p.i:]
+	end := strings.IndexByte(rest, ' ')
+
+	if end == -1 {
+		p.i = len(p.data)
+		return rest, false
+	}
+	p.i += end + 1
+	return rest[:end], true
+}
+
+// priority reads "<PRI>", which is facility * 8 + severity
+func (p *parser) priority() (int, error) {
+	end := strings.IndexByte(p.data, '>')
+
+	if !p.startsWith("<") || end < 2 || end > 4 {
+		return 0, errors.New("priority not found")
+	}
+
+	pri, err := strconv.Atoi(p.data[1:end])
+
+	if err != nil || pri < 0 || pri >= len(_facilities)*8 {
+		return 0, errors.New("incorrect priority: " + p.data[1:end])
+	}
+	p.i = end + 1
+	return pri, nil
+}
+
+// rfc5424 reads "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]"
+func (p *parser) rfc5424() (*message, error) {
+	header := [5]string{}
+
+	for i := range header {
+		word, ok := p.word()
+
+		if !ok && i < len(header)-1 {
+			return nil, errors.New("header is not complete")
+		}
+
+		if word != _NIL {
+			header[i] = word
+		}
+	}
+
+	msg := &message{
+		hostname: header[1],
+		appName:  header[2],
+		procID:   header[3],
+		msgID:    header[4],
+	}
+
+	if header[0] != "" {
+		t, err := time.Parse(time.RFC3339Nano, header[0])
+
+		if err != nil {
+			return nil, errors.New("incorrect timestamp: " + header[0])
+		}
+		msg.time = t
+	}
+
+	err := p.structuredData(msg)
+
+	if err != nil {
+		return nil, err
+	}
+	msg.text = p.data[min(p.i, len(p.data)):]
+	return msg, nil
+}
+
+// structuredData reads "-" or elements "[SD-ID NAME="VALUE" ...]"
+func (p *parser) structuredData(msg *message) error {
+	if p.startsWith(_NIL) {
+		p.i += len(_NIL) + 1
+		return nil
+	}
+
+	for p.startsWith("[") {
+		p.i++
+		id, end := p.name()
+
+		for end == ' ' {
+			name, sep := p.name()
+
+			if sep != '=' || !p.startsWith(`"`) {
+				return errors.New("incorrect param of structured data '" + id + "'")
+			}
+			p.i++
+
+			value, ok := p.quoted()
+
+			if !ok {
+				return errors.New("value of structured data '" + id + "." + name + "' is not closed")
+			}
+			msg.fields = append(msg.fields, [2]string{id + "." + name, value})
+			end = 0
+
+			if p.startsWith(" ") {
+				end = ' '
+				p.i++
+			}
+		}
+
+		if !p.startsWith("]") {
+			return errors.New("structured data '" + id + "' is not closed")
+		}
+		p.i++
+	}
+
+	if p.startsWith(" ") {
+		p.i++
+	}
+	return nil
+}
+
+// name reads SD-ID or param name and returns the char after it (' ', '=' or ']')
+func (p *parser) name() (string, byte) {
+	start := p.i
+
+	for p.i < len(p.data) {
+		switch c := p.data[p.i]; c {
+		case ' ', '=':
+			p.i++
+			return p.data[start : p.i-1], c
+		case ']':
+			return p.data[start:p.i], c
+		}
+		p.i++
+	}
+	return p.data[start:], 0
+}
+
+// quoted reads value till closing quote, escaped '"', '\' and ']' are unescaped
+func (p *parser) quoted() (string, bool) {
+	sb := strings.Builder{}
+
+	for p.i < len(p.data) {
+		c := p.data[p.i]
+		p.i++
+
+		switch {
+		case c == '"':
+			return sb.String(), true
+		case c == '\\' && p.i < len(p.data) && strings.IndexByte(`"\]`, p.data[p.i]) != -1:
+			sb.WriteByte(p.data[p.i])
+			p.i++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// rfc3164 reads "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". Parts, which are not found,
+// stay empty. Year of time is the year of 'now' (or the previous one, if time is in future)
+func (p *parser) rfc3164(now time.Time) *message {
+	msg := &message{}
+	const layout = "Jan _2 15:04:05"
+
+	if len(p.data)-p.i > len(layout) {
+		t, err := time.ParseInLocation(layout, p.data[p.i:p.i+len(layout)], now.Location())
+
+		if err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+
+			if t.After(now.Add(time.Hour * 24)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			msg.time = t
+			p.i += len(layout) + 1
+
+			// Hostname may be skipped, then the word is tag
+
+			start := p.i
+			hostname, ok := p.word()
+
+			if ok && !strings.ContainsAny(hostname, "[:") {
+				msg.hostname = hostname
+			} else {
+				p.i = start
+			}
+		}
+	}
+
+	// Tag is letters and digits till '[', ':' or space
+
+	rest := p.data[min(p.i, len(p.data)):]
+	end := strings.IndexAny(rest, "[: ")
+
+	if end <= 0 || end > 32 {
+		msg.text = rest
+		return msg
+	}
+	msg.appName = rest[:end]
+	rest = rest[end:]
+
+	if strings.HasPrefix(rest, "[") {
+		if j := strings.IndexByte(rest, ']'); j != -1 {
+			msg.procID = rest[1:j]
+			rest = rest[j+1:]
+		}
+	}
+	msg.text = strings.TrimPrefix(rest, ":")
+	return msg
+}
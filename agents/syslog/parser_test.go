@@ -0,0 +1,82 @@
+package syslog
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	// RFC 5424
+
+	l, err := Parse([]byte(`<165>1 2025-01-03T10:20:30.123Z host1 app 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App\"x\]"][meta seq="1"] `+"\ufeff"+`Event happened`+"\n"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 3, 10, 20, 30, 123e6, time.UTC).UnixMilli(), l.Timestamp)
+	assert.Equal(t, byte(3), l.Level, "notice")
+	assert.Equal(t, []string{"local4"}, l.Modules)
+	assert.Equal(t, "app", l.Entity)
+	assert.Equal(t, "1234", l.EntityID)
+	assert.Equal(t, "Event happened", l.Message)
+	assert.Equal(t, map[string]string{
+		"host":                          "host1",
+		"exampleSDID@32473.iut":         "3",
+		"exampleSDID@32473.eventSource": `App"x]`,
+		"meta.seq":                      "1",
+	}, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	l, err = Parse([]byte(`<11>1 - - - - ID1 -`), now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.UnixMilli(), l.Timestamp)
+	assert.Equal(t, byte(6), l.Level)
+	assert.Equal(t, "unknown", l.Entity)
+	assert.Equal(t, "ID1", l.EntityID)
+	assert.Equal(t, "-", l.Message)
+	assert.Nil(t, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	// RFC 3164
+
+	l, err = Parse([]byte(`<34>Oct 11 22:14:15 mymachine su[99]: 'su root' failed`), now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 10, 11, 22, 14, 15, 0, time.UTC).UnixMilli(), l.Timestamp, "previous year")
+	assert.Equal(t, byte(7), l.Level)
+	assert.Equal(t, []string{"auth"}, l.Modules)
+	assert.Equal(t, "su", l.Entity)
+	assert.Equal(t, "99", l.EntityID)
+	assert.Equal(t, "'su root' failed", l.Message)
+	assert.Equal(t, map[string]string{"host": "mymachine"}, l.Fields)
+
+	l, err = Parse([]byte(`<13>Jan  5 11:00:00 cron: job done`), now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 5, 11, 0, 0, 0, time.UTC).UnixMilli(), l.Timestamp)
+	assert.Equal(t, "cron", l.Entity)
+	assert.Equal(t, "-", l.EntityID)
+	assert.Equal(t, "job done", l.Message)
+	assert.Nil(t, l.Fields)
+
+	// Errors
+
+	for _, frame := range []string{"hello", "<999>1 - - - - - -", "<13>1 - host", `<13>1 - - - - - [id k="v`} {
+		_, err = Parse([]byte(frame), now)
+		assert.Error(t, err, frame)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("5 <13>a<13>b\n11 <13>1 - - -<13>c"))
+
+	for _, expected := range []string{"<13>a", "<13>b\n", "<13>1 - - -", "<13>c"} {
+		frame, err := readFrame(r)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(frame))
+	}
+
+	_, err := readFrame(r)
+	assert.Error(t, err)
+}
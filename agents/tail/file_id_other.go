@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package tail
+
+import "os"
+
+// fileID returns 0, which means unknown file, so only truncation is detected after restart
+func fileID(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns inode of file, so renamed file is recognized after restart
+func fileID(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package tail
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	lm "main/agents/log_mapping"
+	m "main/models"
+)
+
+const (
+	FORMAT_JSON   = "json"
+	FORMAT_LOGFMT = "logfmt"
+	FORMAT_REGEX  = "regex"
+)
+
+// DefaultMapping maps common keys of structured logs
+func DefaultMapping() lm.Mapping {
+	return lm.Mapping{
+		m.C_TIMESTAMP: "time",
+		m.C_LEVEL:     "level",
+		m.C_TRACES:    "trace_id",
+		m.C_ENTITY:    "service",
+		m.C_ENTITY_ID: "host",
+		m.C_MESSAGE:   "msg",
+		m.C_MODULES:   "module",
+		m.C_LABELS:    "tags",
+	}
+}
+
+// Parser parses lines of tailed file to records (JSON objects, logfmt pairs or named groups of regex)
+// and maps them to logs. Line, which can't be parsed, is message of log
+type Parser struct {
+	format  string
+	regex   *regexp.Regexp
+	mapping lm.Mapping
+}
+
+func NewParser(tail *m.Tail) (*Parser, error) {
+	p := &Parser{format: tail.Format}
+	var err error
+
+	switch tail.Format {
+	case FORMAT_JSON, FORMAT_LOGFMT:
+	case FORMAT_REGEX:
+		if p.regex, err = regexp.Compile(tail.Regex); err != nil {
+			return nil, err
+		}
+
+		if p.regex.NumSubexp() == 0 {
+			return nil, errors.New("regex must have named groups")
+		}
+	default:
+		return nil, errors.New("format must be 'json', 'logfmt' or 'regex', not '" + tail.Format + "'")
+	}
+
+	if p.mapping, err = lm.ParseMapping(tail.Mapping, DefaultMapping()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Parse parses line to log, 'now' is timestamp of log without time
+func (p *Parser) Parse(line string, now time.Time) *m.Log {
+	line = strings.TrimRight(line, "\r\n")
+	var record map[string]any
+
+	switch p.format {
+	case FORMAT_JSON:
+		if json.Unmarshal([]byte(line), &record) != nil {
+			record = nil
+		}
+	case FORMAT_LOGFMT:
+		record = parseLogfmt(line)
+	case FORMAT_REGEX:
+		record = p.parseRegex(line)
+	}
+
+	if record == nil {
+		record = map[string]any{p.mapping[m.C_MESSAGE]: line}
+	}
+	return p.mapping.ToLog(record, now)
+}
+
+func (p *Parser) parseRegex(line string) map[string]any {
+	match := p.regex.FindStringSubmatch(line)
+
+	if match == nil {
+		return nil
+	}
+
+	record := map[string]any{}
+
+	for i, name := range p.regex.SubexpNames() {
+		if name != "" && match[i] != "" {
+			record[name] = match[i]
+		}
+	}
+	return record
+}
+
+// parseLogfmt parses pairs key=value, separated by spaces. Value may be quoted, key without value is "true".
+// Nil is returned, if line has no pairs
+func parseLogfmt(line string) map[string]any {
+	record := map[string]any{}
+	pairs := 0
+	isSpace := func(i int) bool { return line[i] == ' ' || line[i] == '\t' }
+
+	for i := 0; i < len(line); {
+		for i < len(line) && isSpace(i) {
+			i++
+		}
+
+		start := i
+
+		for i < len(line) && line[i] != '=' && !isSpace(i) {
+			i++
+		}
+		key := line[start:i]
+
+		if i >= len(line) || isSpace(i) {
+			if key != "" {
+				record[key] = "true"
+			}
+			continue
+		}
+		i++ // '='
+
+		value := ""
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end, len(line)-1)
+
+			var err error
+
+			if value, err = strconv.Unquote(line[i : end+1]); err != nil {
+				value = strings.Trim(line[i:end+1], `"`)
+			}
+			i = end + 1
+
+		} else {
+			start = i
+
+			for i < len(line) && !isSpace(i) {
+				i++
+			}
+			value = line[start:i]
+		}
+
+		if key != "" {
+			record[key] = value
+			pairs++
+		}
+	}
+
+	if pairs == 0 {
+		return nil
+	}
+	return record
+}
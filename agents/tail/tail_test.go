@@ -0,0 +1,222 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/stretchr/testify/assert"
+
+	m "main/models"
+	tt "main/test_tools"
+)
+
+func TestParser(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+
+	// JSON
+
+	p, err := NewParser(&m.Tail{Format: FORMAT_JSON, Mapping: "message:message"})
+	assert.NoError(t, err)
+
+	l := p.Parse(`{"time": "2024-01-02T03:04:05Z", "level": "error", "service": "api", "message": "Failed", "user": {"id": 7}}`+"\n", now)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli(), l.Timestamp)
+	assert.Equal(t, byte(6), l.Level)
+	assert.Equal(t, "api", l.Entity)
+	assert.Equal(t, "Failed", l.Message)
+	assert.Equal(t, map[string]string{"user.id": "7"}, l.Fields)
+	assert.Empty(t, l.Errors())
+
+	l = p.Parse("plain text", now)
+	assert.Equal(t, "plain text", l.Message, "not parsed line is message")
+	assert.Equal(t, now.UnixMilli(), l.Timestamp)
+
+	// Logfmt
+
+	p, err = NewParser(&m.Tail{Format: FORMAT_LOGFMT})
+	assert.NoError(t, err)
+
+	l = p.Parse(`level=warn msg="Slow \"query\"" host=db-1 ms=350 cached`, now)
+	assert.Equal(t, byte(5), l.Level)
+	assert.Equal(t, `Slow "query"`, l.Message)
+	assert.Equal(t, "db-1", l.EntityID)
+	assert.Equal(t, map[string]string{"ms": "350", "cached": "true"}, l.Fields)
+
+	assert.Nil(t, parseLogfmt("just words"))
+	assert.Equal(t, map[string]any{"a": "b c"}, parseLogfmt(`a="b c`), "unterminated quote")
+
+	// Regex
+
+	p, err = NewParser(&m.Tail{Format: FORMAT_REGEX, Regex: `^(?P<host>\S+) (?P<level>\w+) (?P<msg>.*)$`})
+	assert.NoError(t, err)
+
+	l = p.Parse("web-1 INFO Request served", now)
+	assert.Equal(t, byte(4), l.Level)
+	assert.Equal(t, "web-1", l.EntityID)
+	assert.Equal(t, "Request served", l.Message)
+
+	for _, tail := range []*m.Tail{
+		{Format: "xml"},
+		{Format: FORMAT_REGEX, Regex: `\w+`},
+		{Format: FORMAT_REGEX, Regex: `(?P<msg>`},
+		{Format: FORMAT_JSON, Mapping: "fields:x"},
+	} {
+		_, err = NewParser(tail)
+		assert.Error(t, err, tail)
+	}
+}
+
+func TestTailer(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	name := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(name, []byte("msg=first\n\nmsg=second\nmsg=part"), 0644))
+
+	mx := sync.Mutex{}
+	messages := []string{}
+	batchIDs := map[string]bool{}
+
+	write := func(trace *sl.Trace, logs *m.Logs) error {
+		mx.Lock()
+		defer mx.Unlock()
+
+		if batchIDs[logs.BatchID] {
+			return nil
+		}
+		batchIDs[logs.BatchID] = true
+
+		for _, l := range logs.Logs {
+			messages = append(messages, l.Message)
+		}
+		return nil
+	}
+
+	waitMessages := func(expected ...string) {
+		assert.Eventually(t, func() bool {
+			mx.Lock()
+			defer mx.Unlock()
+			return len(messages) == len(expected)
+		}, time.Second, 10*time.Millisecond)
+
+		mx.Lock()
+		assert.Equal(t, expected, messages)
+		messages = []string{}
+		mx.Unlock()
+	}
+
+	tails := []*m.Tail{{Path: filepath.Join(dir, "*.log"), Storage: "app", Format: FORMAT_LOGFMT}}
+	tailer, err := NewTailer(trace, tails, 10*time.Millisecond, write)
+	assert.NoError(t, err)
+	tailer.Run()
+
+	waitMessages("first", "second")
+
+	// Rotation: the rest of old file is read, new file is read from start
+
+	appendFile(t, name, "1\n")
+	assert.NoError(t, os.Rename(name, filepath.Join(dir, "app.log.1")))
+	assert.NoError(t, os.WriteFile(name, []byte("msg=new\n"), 0644))
+	waitMessages("part1", "new")
+
+	// Truncation
+
+	assert.NoError(t, os.WriteFile(name, []byte("msg=x\n"), 0644))
+	waitMessages("x")
+	tailer.Stop()
+
+	// Position is kept after restart
+
+	appendFile(t, name, "msg=after\n")
+	tailer, err = NewTailer(trace, tails, 10*time.Millisecond, write)
+	assert.NoError(t, err)
+	tailer.Run()
+
+	waitMessages("after")
+	tailer.Stop()
+}
+
+func TestTailerRename(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	name := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(name, []byte("msg=first\n"), 0644))
+
+	mx := sync.Mutex{}
+	messages := []string{}
+
+	write := func(trace *sl.Trace, logs *m.Logs) error {
+		mx.Lock()
+		defer mx.Unlock()
+
+		for _, l := range logs.Logs {
+			messages = append(messages, l.Message)
+		}
+		return nil
+	}
+
+	waitMessages := func(expected ...string) {
+		assert.Eventually(t, func() bool {
+			mx.Lock()
+			defer mx.Unlock()
+			return len(messages) == len(expected)
+		}, time.Second, 10*time.Millisecond)
+
+		mx.Lock()
+		assert.Equal(t, expected, messages)
+		messages = []string{}
+		mx.Unlock()
+	}
+
+	tails := []*m.Tail{{Path: filepath.Join(dir, "app.log*"), Storage: "app", Format: FORMAT_LOGFMT}}
+	tailer, err := NewTailer(trace, tails, 10*time.Millisecond, write)
+	assert.NoError(t, err)
+	tailer.Run()
+
+	waitMessages("first")
+
+	// Renamed file, which matches tail, is read further
+
+	assert.NoError(t, os.Rename(name, name+".1"))
+	appendFile(t, name+".1", "msg=second\n")
+	assert.NoError(t, os.WriteFile(name, []byte("msg=new\n"), 0644))
+	waitMessages("second", "new")
+	tailer.Stop()
+
+	// Position of file, which is renamed while tailer is stopped, is found by inode
+
+	if info, _ := os.Stat(name); fileID(info) == 0 {
+		return
+	}
+
+	assert.NoError(t, os.Rename(name+".1", name+".2"))
+	assert.NoError(t, os.Rename(name, name+".1"))
+	appendFile(t, name+".1", "msg=after\n")
+	tailer, err = NewTailer(trace, tails, 10*time.Millisecond, write)
+	assert.NoError(t, err)
+	tailer.Run()
+
+	waitMessages("after")
+	tailer.Stop()
+}
+
+func appendFile(t *testing.T, name, data string) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	file.WriteString(data)
+	file.Close()
+}
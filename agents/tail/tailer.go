@@ -0,0 +1,353 @@
+// Package tail tails local files and parses their lines to logs
+package tail
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	m "main/models"
+	"main/relays/file_sys"
+)
+
+const (
+	_MAX_READ  = 1 << 20     // max bytes, which are read from file at once
+	_POSITIONS = "positions" // file of positions in dir of tails
+)
+
+var errStopped = errors.New("tailer is stopped")
+
+// Position is read offset of file. Start is time of start of reading of file from beginning,
+// it's part of batch IDs, so lines of truncated or new file with reused inode aren't taken for saved ones.
+// Path is path of file at start of reading, so batch IDs of renamed file aren't changed
+type Position struct {
+	ID     uint64 // inode of file, 0 if it's unknown
+	Path   string
+	Start  int64
+	Offset int64
+}
+
+type tailedFile struct {
+	path    string
+	storage string
+	parser  *Parser
+	file    *os.File
+	info    os.FileInfo
+	pos     *Position
+}
+
+// Tailer polls files of tails and passes batches of parsed lines to handler. Offsets are saved
+// after successful handling, so failed lines are read again. When path refers to other file (rotation),
+// the old file is read to end and the new one is read from start. Renamed file, which matches tail,
+// is read further from its position. Truncated file is read from start
+type Tailer struct {
+	tails     []*m.Tail
+	parsers   []*Parser
+	period    time.Duration
+	write     func(trace *sl.Trace, logs *m.Logs) error
+	fileSys   *file_sys.FileSys
+	files     map[string]*tailedFile // by path
+	positions map[string]*Position   // saved positions by path
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func NewTailer(trace *sl.Trace, tails []*m.Tail, period time.Duration, write func(trace *sl.Trace, logs *m.Logs) error) (*Tailer, error) {
+	defer trace.AddModule("_Tailer", "NewTailer")()
+
+	t := &Tailer{
+		tails:     tails,
+		period:    period,
+		write:     write,
+		fileSys:   &file_sys.FileSys{},
+		files:     map[string]*tailedFile{},
+		positions: map[string]*Position{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for _, tail := range tails {
+		parser, err := NewParser(tail)
+
+		if err != nil {
+			return nil, err
+		}
+		t.parsers = append(t.parsers, parser)
+	}
+
+	name := path.Join(m.DIR_TAILS, _POSITIONS)
+	exists, err := t.fileSys.Exists(trace, name)
+
+	if err == nil && exists {
+		_, err = t.fileSys.ReadFileTo(trace, name, &t.positions)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Tailer) Run() {
+	go t.watch()
+}
+
+// Stop stops polling and waits for handling of read lines
+func (t *Tailer) Stop() {
+	close(t.stop)
+	<-t.done
+}
+
+func (t *Tailer) watch() {
+	trace := sl.NewTrace("tail")
+	trace.SetEntity("tailer", fmt.Sprint(len(t.tails), " tails"))
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.period)
+	defer ticker.Stop()
+
+	for {
+		t.poll(trace)
+
+		select {
+		case <-t.stop:
+			for _, f := range t.files {
+				f.file.Close()
+			}
+			trace.INFO(nil, "Tailer stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tailer) poll(trace *sl.Trace) {
+	defer trace.AddModule("_Tailer", "poll")()
+
+	for i, tail := range t.tails {
+		paths, _ := filepath.Glob(tail.Path)
+
+		for _, path := range paths {
+			if _, ok := t.files[path]; !ok {
+				t.open(trace, path, i)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(t.files))
+
+	for path := range t.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		f := t.files[path]
+
+		if err := t.read(trace, f, false); err != nil {
+			return
+		}
+
+		// Rotated or removed file is read to end including last line without new line
+
+		info, err := os.Stat(path)
+
+		if err == nil && os.SameFile(info, f.info) {
+			continue
+		}
+
+		if err := t.read(trace, f, true); err != nil {
+			return
+		}
+
+		f.file.Close()
+		delete(t.files, path)
+		t.save(trace)
+		trace.INFO(nil, "File '", path, "' is rotated or removed")
+	}
+}
+
+func (t *Tailer) open(trace *sl.Trace, path string, tail int) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		trace.NOTE(nil, "Opening of file error: ", err.Error())
+		return
+	}
+
+	info, err := file.Stat()
+
+	if err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return
+	}
+
+	// Renamed tailed file is read further by opened file
+
+	for old, f := range t.files {
+		if os.SameFile(info, f.info) {
+			file.Close()
+			delete(t.files, old)
+			f.path = path
+			t.files[path] = f
+			t.save(trace)
+			trace.INFO(nil, "File '", old, "' is renamed to '", path, "'")
+			return
+		}
+	}
+
+	pos := &Position{ID: fileID(info), Path: path, Start: time.Now().UnixNano()}
+	saved, ok := t.positions[path]
+
+	// File, which is renamed while tailer was stopped, is found by inode
+	if (!ok || saved.ID != pos.ID) && pos.ID != 0 {
+		saved, ok = t.findPosition(pos.ID)
+	}
+
+	if ok && saved.ID == pos.ID && saved.Offset <= info.Size() {
+		pos = saved
+	}
+
+	t.files[path] = &tailedFile{
+		path:    path,
+		storage: t.tails[tail].Storage,
+		parser:  t.parsers[tail],
+		file:    file,
+		info:    info,
+		pos:     pos,
+	}
+	trace.INFO(nil, "File '", path, "' is tailed from offset ", pos.Offset)
+}
+
+// read reads new lines of file by batches. Error is returned, if handling of lines failed
+func (t *Tailer) read(trace *sl.Trace, f *tailedFile, atEOF bool) error {
+	info, err := f.file.Stat()
+
+	if err != nil {
+		trace.NOTE(nil, "Getting stats of file error: ", err.Error())
+		return nil
+	}
+
+	size := info.Size()
+
+	if size < f.pos.Offset {
+		trace.NOTE(nil, "File '", f.path, "' is truncated, it's read from start")
+		f.pos.Start, f.pos.Offset = time.Now().UnixNano(), 0
+	}
+
+	if f.pos.Path == "" {
+		f.pos.Path = f.path
+	}
+
+	hash := sha1.Sum([]byte(f.pos.Path))
+	pathID := hex.EncodeToString(hash[:8])
+	buf := make([]byte, min(size-f.pos.Offset, _MAX_READ))
+
+	for f.pos.Offset < size {
+		select {
+		case <-t.stop:
+			return errStopped
+		default:
+		}
+
+		n, err := f.file.ReadAt(buf[:min(size-f.pos.Offset, _MAX_READ)], f.pos.Offset)
+
+		if err != nil && err != io.EOF {
+			trace.NOTE(nil, "Reading of file error: ", err.Error())
+			return nil
+		}
+
+		lines, read := splitLines(buf[:n], m.MAX_LOGS_IN_CHUNK, atEOF)
+
+		// Line, which is longer than buffer, is cut
+		if read == 0 && n == _MAX_READ {
+			lines, read = splitLines(buf[:n], m.MAX_LOGS_IN_CHUNK, true)
+		}
+
+		if read == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		batch := &m.Logs{
+			Storage: f.storage,
+			BatchID: fmt.Sprint("tail:", pathID, ":", f.pos.Start, ":", f.pos.Offset),
+			Partial: true,
+			Logs:    make([]*m.Log, len(lines)),
+		}
+
+		for i, line := range lines {
+			batch.Logs[i] = f.parser.Parse(line, now)
+		}
+
+		if len(batch.Logs) > 0 {
+			if err = t.write(trace, batch); err != nil {
+				trace.NOTE(nil, "Lines of file '", f.path, "' will be read again: ", err.Error())
+				return err
+			}
+		}
+
+		f.pos.Offset += int64(read)
+		t.save(trace)
+	}
+	return nil
+}
+
+// findPosition returns saved position of file with the inode
+func (t *Tailer) findPosition(id uint64) (*Position, bool) {
+	for _, pos := range t.positions {
+		if pos.ID == id {
+			return pos, true
+		}
+	}
+	return nil, false
+}
+
+// save saves positions of tailed files
+func (t *Tailer) save(trace *sl.Trace) {
+	t.positions = make(map[string]*Position, len(t.files))
+
+	for path, f := range t.files {
+		t.positions[path] = f.pos
+	}
+
+	_, err := t.fileSys.WriteFile(trace, path.Join(m.DIR_TAILS, _POSITIONS), true, t.positions)
+
+	if err != nil {
+		trace.NOTE(nil, "Saving of positions error: ", err.Error())
+	}
+}
+
+// splitLines returns no more than 'maxLines' not empty lines, which end with new line,
+// and number of read bytes. If 'atEOF', the rest of data is last line
+func splitLines(data []byte, maxLines int, atEOF bool) (lines []string, read int) {
+	for read < len(data) && len(lines) < maxLines {
+		end := bytes.IndexByte(data[read:], '\n')
+
+		if end < 0 && !atEOF {
+			break
+		}
+
+		if end < 0 {
+			end = len(data) - read - 1
+		}
+
+		line := bytes.TrimRight(data[read:read+end+1], "\r\n")
+		read += end + 1
+
+		if len(line) > 0 {
+			lines = append(lines, string(line))
+		}
+	}
+	return lines, read
+}
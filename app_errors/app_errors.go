@@ -1,7 +1,10 @@
 package app_errors
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 type ErrType byte
@@ -11,11 +14,17 @@ const (
 	NotFound
 	Forbidden
 	Conflict
+	LimitExceeded
+	TooManyReqs
+	Unavailable
+	Timeout
+	InsufficientStorage
 )
 
 type AppErr struct {
-	errType ErrType
-	message string
+	errType    ErrType
+	message    string
+	retryAfter time.Duration
 }
 
 func NewAppErr(errType ErrType, message ...any) error {
@@ -25,6 +34,15 @@ func NewAppErr(errType ErrType, message ...any) error {
 	}
 }
 
+// NewRetryAppErr creates error, after which client may repeat request in 'retryAfter'
+func NewRetryAppErr(errType ErrType, retryAfter time.Duration, message ...any) error {
+	return &AppErr{
+		errType:    errType,
+		message:    fmt.Sprint(message...),
+		retryAfter: retryAfter,
+	}
+}
+
 func (e *AppErr) Type() ErrType {
 	return e.errType
 }
@@ -33,11 +51,28 @@ func (e *AppErr) Error() string {
 	return e.message
 }
 
+func (e *AppErr) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// FromContext converts error of done context to app error
+func FromContext(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewAppErr(Timeout, "Timeout exceeded")
+	}
+	return NewAppErr(Timeout, "Request canceled")
+}
+
 var _errTypeToStatus = map[ErrType]int{
-	BadReq:    400,
-	Forbidden: 403,
-	NotFound:  404,
-	Conflict:  409,
+	BadReq:              400,
+	Forbidden:           403,
+	NotFound:            404,
+	Conflict:            409,
+	LimitExceeded:       422,
+	TooManyReqs:         429,
+	Unavailable:         503,
+	Timeout:             504,
+	InsufficientStorage: 507,
 }
 
 func GetStatus(errType ErrType) int {
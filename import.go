@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"main/agents/client"
+	"main/agents/sl_dump"
+	m "main/models"
+)
+
+const _IMPORT_ATTEMPTS = 10 // of sending of batch, which failed because of overload
+
+// importDumps is command "import <storage> <path>...", which sends logs of dump files of sherlog
+// (files or logs dirs) to running server. Batch ID is hash of file with offset of batch,
+// so repeated import doesn't save the same logs twice
+func importDumps(config *m.Config, args []string) {
+	if len(args) < 2 {
+		log.Fatalln("Usage: sherlogdb import <storage> <dump file or logs dir>...")
+	}
+
+	storage := args[0]
+	files := []string{}
+
+	for _, name := range args[1:] {
+		info, err := os.Stat(name)
+
+		if err != nil {
+			log.Fatalln("Import error: ", err.Error())
+		}
+
+		if !info.IsDir() {
+			files = append(files, name)
+			continue
+		}
+
+		dumps, err := sl_dump.DumpFiles(name)
+
+		if err != nil {
+			log.Fatalln("Import error: ", err.Error())
+		}
+
+		for _, dump := range dumps {
+			files = append(files, filepath.Join(name, dump))
+		}
+	}
+
+	url := "http://" + net.JoinHostPort(config.Host, config.Port)
+
+	if config.Socket != "" {
+		url = "http://unix"
+	}
+
+	cl := client.New(url, config.Socket)
+	saved, rejected := 0, 0
+
+	for _, name := range files {
+		s, r := importDump(cl, storage, name)
+		saved, rejected = saved+s, rejected+r
+		log.Print("Imported '", name, "': ", s, " logs saved, ", r, " rejected")
+	}
+	log.Print("Import completed: ", saved, " logs saved, ", rejected, " rejected")
+}
+
+func importDump(cl *client.Client, storage, name string) (saved, rejected int) {
+	data, err := os.ReadFile(name)
+
+	if err != nil {
+		log.Fatalln("Import error: ", err.Error())
+	}
+
+	abs, err := filepath.Abs(name)
+
+	if err != nil {
+		log.Fatalln("Import error: ", err.Error())
+	}
+
+	hash := sha1.Sum([]byte(abs))
+	fileID := hex.EncodeToString(hash[:8])
+
+	for offset := 0; offset < len(data); {
+		logs, read, r := sl_dump.Parse(data[offset:], m.MAX_LOGS_IN_CHUNK, true)
+		rejected += r
+
+		if len(logs) > 0 {
+			batch := &m.Logs{
+				Storage: storage,
+				BatchID: fmt.Sprint("sherlog:", fileID, ":", offset),
+				Partial: true,
+				Logs:    logs,
+			}
+			report, err := sendImported(cl, batch)
+
+			if statusErr, ok := err.(*client.StatusErr); ok && statusErr.Status == 400 {
+				rejected += len(logs)
+			} else if err != nil {
+				log.Fatalln("Import of '", name, "' error: ", err.Error())
+			} else {
+				saved += report.Accepted
+				rejected += len(report.Rejected)
+			}
+		}
+		offset += read
+	}
+	return saved, rejected
+}
+
+// sendImported sends batch, retrying it while server is overloaded
+func sendImported(cl *client.Client, batch *m.Logs) (*m.ValidationReport, error) {
+	for attempt := 1; ; attempt++ {
+		report, err := cl.WriteLogs(context.Background(), batch)
+		statusErr, ok := err.(*client.StatusErr)
+
+		if !ok || !statusErr.Temporary() || attempt == _IMPORT_ATTEMPTS {
+			return report, err
+		}
+		time.Sleep(max(statusErr.RetryAfter, time.Second))
+	}
+}
@@ -1,27 +1,62 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	sl "github.com/j-hitgate/sherlog"
 	"github.com/joho/godotenv"
 
+	"main/agents/elastic"
+	"main/agents/fluent"
+	lm "main/agents/log_mapping"
+	"main/agents/tail"
 	"main/agents/time_range"
 	m "main/models"
 	"main/service"
+	"main/tools"
 )
 
 func main() {
 	config := getConfig()
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importDumps(config, os.Args[2:])
+		return
+	}
+
+	// All data dirs are relative to data root
+
+	if config.DataDir != "" {
+		err := os.MkdirAll(config.DataDir, 0755)
+
+		if err == nil {
+			err = os.Chdir(config.DataDir)
+		}
+
+		if err != nil {
+			log.Fatalln("Change dir to DATA_DIR error: ", err.Error())
+		}
+	}
+
 	sl.Init(sl.Config{
 		LogsDir:       config.LogsDir,
 		AutodumpAfter: 20,
 		Level:         config.LogLevel,
 	}, nil)
 
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		runAgent(config)
+		sl.Close()
+		return
+	}
+
 	service.New(config).Run()
 	sl.Close()
 }
@@ -35,7 +70,11 @@ func getConfig() *m.Config {
 
 	// Get vars
 
+	host := os.Getenv("HOST")
 	port := os.Getenv("PORT")
+	socket := os.Getenv("SOCKET")
+	dataDir := os.Getenv("DATA_DIR")
+	dataDirsStr := os.Getenv("DATA_DIRS")
 	writersStr := os.Getenv("WRITERS")
 	readersStr := os.Getenv("READERS")
 	deletersStr := os.Getenv("DELETERS")
@@ -43,10 +82,55 @@ func getConfig() *m.Config {
 	logLevelStr := os.Getenv("DB_LOG_LEVEL")
 	logsDir := os.Getenv("DB_LOGS_DIR")
 
+	queryMemoryLimitStr := os.Getenv("QUERY_MEMORY_LIMIT")
+	querySpillLimitStr := os.Getenv("QUERY_SPILL_LIMIT")
+	queryMaxRowsStr := os.Getenv("QUERY_MAX_ROWS")
+	queryTimeoutStr := os.Getenv("QUERY_TIMEOUT")
+	queueWaitStr := os.Getenv("QUEUE_WAIT_TIMEOUT")
+	queueSizeStr := os.Getenv("QUEUE_SIZE")
+
+	storageRateStr := os.Getenv("STORAGE_RATE_LIMIT")
+	storageBurstStr := os.Getenv("STORAGE_RATE_BURST")
+	clientRateStr := os.Getenv("CLIENT_RATE_LIMIT")
+	clientBurstStr := os.Getenv("CLIENT_RATE_BURST")
+
 	logsTTLStr := os.Getenv("LOGS_TTL")
 	aligningPeriodStr := os.Getenv("ALIGNING_CHUNKS_PERIOD")
 	delExpiredPeriodStr := os.Getenv("DELETING_EXPIRED_CHUNKS_PERIOD")
 	rmFilesPeriodStr := os.Getenv("REMOVING_FILES_PERIOD")
+	checkpointPeriodStr := os.Getenv("CHECKPOINT_PERIOD")
+
+	diskSoftLimitStr := os.Getenv("DISK_SOFT_LIMIT")
+	diskHardLimitStr := os.Getenv("DISK_HARD_LIMIT")
+	sheddableStr := os.Getenv("SHEDDABLE_STORAGES")
+	diskCheckPeriodStr := os.Getenv("DISK_CHECK_PERIOD")
+
+	durability := os.Getenv("DURABILITY")
+	groupCommitPeriodStr := os.Getenv("GROUP_COMMIT_PERIOD")
+	walStr := os.Getenv("WAL")
+
+	otlpStorageAttr := os.Getenv("OTLP_STORAGE_ATTRIBUTE")
+	otlpDefaultStorage := os.Getenv("OTLP_DEFAULT_STORAGE")
+
+	lokiStorageLabel := os.Getenv("LOKI_STORAGE_LABEL")
+	lokiDefaultStorage := os.Getenv("LOKI_DEFAULT_STORAGE")
+
+	esFieldMapping := os.Getenv("ES_FIELD_MAPPING")
+
+	importPollPeriodStr := os.Getenv("IMPORT_POLL_PERIOD")
+
+	tailConfig := os.Getenv("TAIL_CONFIG")
+	tailRemote := os.Getenv("TAIL_REMOTE")
+	tailPollPeriodStr := os.Getenv("TAIL_POLL_PERIOD")
+
+	fluentForward := os.Getenv("FLUENT_FORWARD")
+	fluentFieldMapping := os.Getenv("FLUENT_FIELD_MAPPING")
+
+	syslogUDP := os.Getenv("SYSLOG_UDP")
+	syslogTCP := os.Getenv("SYSLOG_TCP")
+	syslogStorage := os.Getenv("SYSLOG_STORAGE")
+	syslogBatchSizeStr := os.Getenv("SYSLOG_BATCH_SIZE")
+	syslogFlushPeriodStr := os.Getenv("SYSLOG_FLUSH_PERIOD")
 
 	// Parse vars
 
@@ -84,9 +168,124 @@ func getConfig() *m.Config {
 		log.Fatalln("DB_LOG_LEVEL must be an integer from 0 to 255: ", logLevelStr)
 	}
 
-	// For scheduler
+	// For data dirs (paths are resolved before changing working dir to data root)
+
+	dataDirs := []string{}
+
+	if dataDir != "" {
+		dataDir = absPath(dataDir)
+	}
+
+	if dataDirsStr != "" {
+		for _, dir := range strings.Split(dataDirsStr, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dataDirs = append(dataDirs, absPath(dir))
+			}
+		}
+	}
+
+	if logsDir != "" {
+		logsDir = absPath(logsDir)
+	}
+
+	if socket != "" {
+		socket = absPath(socket)
+	}
+
+	// For queries
+
+	var queryMemoryLimit, querySpillLimit int64
+	var queryMaxRows uint64
+
+	if queryMemoryLimitStr != "" {
+		queryMemoryLimit, err = tools.ParseSize(queryMemoryLimitStr)
+
+		if err != nil {
+			log.Fatalln("QUERY_MEMORY_LIMIT must be a size (e.g. 64MB): ", err.Error())
+		}
+	}
+
+	if querySpillLimitStr != "" {
+		querySpillLimit, err = tools.ParseSize(querySpillLimitStr)
+
+		if err != nil {
+			log.Fatalln("QUERY_SPILL_LIMIT must be a size (e.g. 1GB): ", err.Error())
+		}
+	}
+
+	if queryMaxRowsStr != "" {
+		queryMaxRows, err = strconv.ParseUint(queryMaxRowsStr, 10, 32)
+
+		if err != nil {
+			log.Fatalln("QUERY_MAX_ROWS must be a positive integer: ", queryMaxRowsStr)
+		}
+	}
 
 	trp := time_range.NewParser(nil)
+	var queryTimeout, queueWait time.Duration
+
+	if queryTimeoutStr != "" {
+		queryTimeout, err = trp.ParseDuration(queryTimeoutStr)
+
+		if err != nil {
+			log.Fatalln("QUERY_TIMEOUT must be a period: ", err.Error())
+		}
+	}
+
+	if queueWaitStr != "" {
+		queueWait, err = trp.ParseDuration(queueWaitStr)
+
+		if err != nil {
+			log.Fatalln("QUEUE_WAIT_TIMEOUT must be a period: ", err.Error())
+		}
+	}
+
+	// For queues and rate limits
+
+	var queueSize, storageBurst, clientBurst uint64
+	var storageRate, clientRate float64
+
+	if queueSizeStr != "" {
+		queueSize, err = strconv.ParseUint(queueSizeStr, 10, 16)
+
+		if err != nil {
+			log.Fatalln("QUEUE_SIZE must be an integer from 0 to 65 535: ", queueSizeStr)
+		}
+	}
+
+	if storageRateStr != "" {
+		storageRate, err = strconv.ParseFloat(storageRateStr, 64)
+
+		if err != nil || storageRate < 0 {
+			log.Fatalln("STORAGE_RATE_LIMIT must be a positive number: ", storageRateStr)
+		}
+	}
+
+	if storageBurstStr != "" {
+		storageBurst, err = strconv.ParseUint(storageBurstStr, 10, 32)
+
+		if err != nil {
+			log.Fatalln("STORAGE_RATE_BURST must be a positive integer: ", storageBurstStr)
+		}
+	}
+
+	if clientRateStr != "" {
+		clientRate, err = strconv.ParseFloat(clientRateStr, 64)
+
+		if err != nil || clientRate < 0 {
+			log.Fatalln("CLIENT_RATE_LIMIT must be a positive number: ", clientRateStr)
+		}
+	}
+
+	if clientBurstStr != "" {
+		clientBurst, err = strconv.ParseUint(clientBurstStr, 10, 32)
+
+		if err != nil {
+			log.Fatalln("CLIENT_RATE_BURST must be a positive integer: ", clientBurstStr)
+		}
+	}
+
+	// For scheduler
 
 	logsTTL, err := trp.ParseDuration(logsTTLStr)
 
@@ -112,23 +311,262 @@ func getConfig() *m.Config {
 		log.Fatalln("REMOVING_FILES_PERIOD must be a period: ", err.Error())
 	}
 
+	var checkpointPeriod time.Duration
+
+	if checkpointPeriodStr != "" {
+		checkpointPeriod, err = trp.ParseDuration(checkpointPeriodStr)
+
+		if err != nil {
+			log.Fatalln("CHECKPOINT_PERIOD must be a period: ", err.Error())
+		}
+	}
+
+	// For disk watcher
+
+	var diskSoftLimit, diskHardLimit int64
+	var diskCheckPeriod time.Duration
+	sheddable := []string{}
+
+	if diskSoftLimitStr != "" {
+		diskSoftLimit, err = tools.ParseSize(diskSoftLimitStr)
+
+		if err != nil {
+			log.Fatalln("DISK_SOFT_LIMIT must be a size (e.g. 10GB): ", err.Error())
+		}
+	}
+
+	if diskHardLimitStr != "" {
+		diskHardLimit, err = tools.ParseSize(diskHardLimitStr)
+
+		if err != nil {
+			log.Fatalln("DISK_HARD_LIMIT must be a size (e.g. 1GB): ", err.Error())
+		}
+	}
+
+	if sheddableStr != "" {
+		for _, storage := range strings.Split(sheddableStr, ",") {
+			if storage = strings.TrimSpace(storage); storage != "" {
+				sheddable = append(sheddable, storage)
+			}
+		}
+	}
+
+	if diskCheckPeriodStr != "" {
+		diskCheckPeriod, err = trp.ParseDuration(diskCheckPeriodStr)
+
+		if err != nil {
+			log.Fatalln("DISK_CHECK_PERIOD must be a period: ", err.Error())
+		}
+	}
+
+	// For durability
+
+	var groupCommitPeriod time.Duration
+
+	switch durability {
+	case "", m.DURABILITY_NONE, m.DURABILITY_FSYNC, m.DURABILITY_GROUP:
+	default:
+		log.Fatalln("DURABILITY must be 'none', 'fsync' or 'group': ", durability)
+	}
+
+	if groupCommitPeriodStr != "" {
+		groupCommitPeriod, err = time.ParseDuration(groupCommitPeriodStr)
+
+		if err != nil {
+			log.Fatalln("GROUP_COMMIT_PERIOD must be a duration (e.g. 10ms): ", err.Error())
+		}
+	}
+
+	var wal bool
+
+	if walStr != "" {
+		wal, err = strconv.ParseBool(walStr)
+
+		if err != nil {
+			log.Fatalln("WAL must be 'true' or 'false': ", err.Error())
+		}
+	}
+
+	// WAL, which is not synced, loses acknowledged logs on crash
+	if wal && (durability == "" || durability == m.DURABILITY_NONE) {
+		log.Fatalln("WAL requires DURABILITY 'fsync' or 'group'")
+	}
+
+	// For ingest APIs of other formats
+
+	esMapping, err := lm.ParseMapping(esFieldMapping, elastic.DefaultMapping())
+
+	if err != nil {
+		log.Fatalln("ES_FIELD_MAPPING must be pairs 'column:path', separated by commas: ", err.Error())
+	}
+
+	var importPollPeriod time.Duration
+
+	if importPollPeriodStr != "" {
+		importPollPeriod, err = trp.ParseDuration(importPollPeriodStr)
+
+		if err != nil {
+			log.Fatalln("IMPORT_POLL_PERIOD must be a period: ", err.Error())
+		}
+	}
+
+	// For tailing of files
+
+	tails := []*m.Tail{}
+	var tailPollPeriod time.Duration
+
+	if tailConfig != "" {
+		data, err := os.ReadFile(tailConfig)
+
+		if err == nil {
+			err = json.Unmarshal(data, &tails)
+		}
+
+		if err != nil {
+			log.Fatalln("Read TAIL_CONFIG error: ", err.Error())
+		}
+	}
+
+	for i, t := range tails {
+		_, err = tail.NewParser(t)
+
+		if err == nil && (t.Path == "" || t.Storage == "") {
+			err = errors.New("'path' and 'storage' must be specified")
+		}
+
+		if err == nil {
+			_, err = filepath.Match(t.Path, "")
+		}
+
+		if err != nil {
+			log.Fatalln("Tail ", i, " of TAIL_CONFIG is incorrect: ", err.Error())
+		}
+
+		// Data root is changed before running
+		t.Path = absPath(t.Path)
+	}
+
+	if tailPollPeriodStr != "" {
+		tailPollPeriod, err = trp.ParseDuration(tailPollPeriodStr)
+
+		if err != nil {
+			log.Fatalln("TAIL_POLL_PERIOD must be a period: ", err.Error())
+		}
+	}
+
+	fluentMapping, err := lm.ParseMapping(fluentFieldMapping, fluent.DefaultMapping())
+
+	if err != nil {
+		log.Fatalln("FLUENT_FIELD_MAPPING must be pairs 'column:path', separated by commas: ", err.Error())
+	}
+
+	// For syslog
+
+	var syslogBatchSize uint64
+	var syslogFlushPeriod time.Duration
+
+	if syslogBatchSizeStr != "" {
+		syslogBatchSize, err = strconv.ParseUint(syslogBatchSizeStr, 10, 32)
+
+		if err != nil || syslogBatchSize == 0 {
+			log.Fatalln("SYSLOG_BATCH_SIZE must be a positive integer: ", syslogBatchSizeStr)
+		}
+	}
+
+	if syslogFlushPeriodStr != "" {
+		syslogFlushPeriod, err = trp.ParseDuration(syslogFlushPeriodStr)
+
+		if err != nil {
+			log.Fatalln("SYSLOG_FLUSH_PERIOD must be a period: ", err.Error())
+		}
+	}
+
 	// Create config model
 
 	config := &m.Config{
-		Port:     port,
-		Writers:  byte(writers),
-		Readers:  byte(readers),
-		Deleters: byte(deleters),
-		Password: password,
-		LogLevel: byte(logLevel),
-		LogsDir:  logsDir,
+		Host:      host,
+		Port:      port,
+		Socket:    socket,
+		DataDir:   dataDir,
+		DataDirs:  dataDirs,
+		Writers:   byte(writers),
+		Readers:   byte(readers),
+		Deleters:  byte(deleters),
+		Password:  password,
+		LogLevel:  byte(logLevel),
+		LogsDir:   logsDir,
+		QueueSize: int(queueSize),
+		QueueWait: queueWait,
+		RateLimit: m.RateLimitConfig{
+			StorageRate:  storageRate,
+			StorageBurst: int(storageBurst),
+			ClientRate:   clientRate,
+			ClientBurst:  int(clientBurst),
+		},
+		Query: m.QueryConfig{
+			MemoryLimit: queryMemoryLimit,
+			SpillLimit:  querySpillLimit,
+			MaxRows:     int(queryMaxRows),
+			Timeout:     queryTimeout,
+		},
 		Scheduler: m.SchedulerConfig{
 			LogsTTL:          logsTTL,
 			AligningPeriod:   aligningPeriod,
 			DelExpiredPeriod: delExpiredPeriod,
 			RmFilesPeriod:    rmFilesPeriod,
+			CheckpointPeriod: checkpointPeriod,
+		},
+		Disk: m.DiskConfig{
+			SoftLimit:   diskSoftLimit,
+			HardLimit:   diskHardLimit,
+			Sheddable:   sheddable,
+			CheckPeriod: diskCheckPeriod,
+		},
+		Durability: m.DurabilityConfig{
+			Mode:        durability,
+			GroupPeriod: groupCommitPeriod,
+		},
+		WAL: wal,
+		OTLP: m.OTLPConfig{
+			StorageAttr:    otlpStorageAttr,
+			DefaultStorage: otlpDefaultStorage,
+		},
+		Loki: m.LokiConfig{
+			StorageLabel:   lokiStorageLabel,
+			DefaultStorage: lokiDefaultStorage,
+		},
+		Elastic: m.ElasticConfig{
+			Mapping: esMapping,
+		},
+		Tail: m.TailConfig{
+			Tails:      tails,
+			Remote:     strings.TrimSuffix(tailRemote, "/"),
+			PollPeriod: tailPollPeriod,
+		},
+		Import: m.ImportConfig{
+			PollPeriod: importPollPeriod,
+		},
+		Fluent: m.FluentConfig{
+			Addr:    fluentForward,
+			Mapping: fluentMapping,
+		},
+		Syslog: m.SyslogConfig{
+			UDPAddr:     syslogUDP,
+			TCPAddr:     syslogTCP,
+			Storage:     syslogStorage,
+			BatchSize:   int(syslogBatchSize),
+			FlushPeriod: syslogFlushPeriod,
 		},
 	}
 	config.EmptyToDefault()
 	return config
 }
+
+func absPath(name string) string {
+	abs, err := filepath.Abs(name)
+
+	if err != nil {
+		log.Fatalln("Get absolute path of '", name, "' error: ", err.Error())
+	}
+	return abs
+}
@@ -3,17 +3,39 @@ package models
 import "time"
 
 type Config struct {
-	Port      string
-	Writers   byte
-	Readers   byte
-	Deleters  byte
-	Password  string
-	LogLevel  byte
-	LogsDir   string
-	Scheduler SchedulerConfig
+	Host       string
+	Port       string
+	Socket     string   // unix socket, which is listened instead of host and port
+	DataDir    string   // data root, which is working dir
+	DataDirs   []string // other data dirs for storages
+	Writers    byte
+	Readers    byte
+	Deleters   byte
+	Password   string
+	LogLevel   byte
+	LogsDir    string
+	QueueSize  int
+	QueueWait  time.Duration
+	RateLimit  RateLimitConfig
+	Query      QueryConfig
+	Scheduler  SchedulerConfig
+	Disk       DiskConfig
+	Durability DurabilityConfig
+	WAL        bool // logs are acknowledged after writing to WAL and applied to chunks in background
+	OTLP       OTLPConfig
+	Syslog     SyslogConfig
+	Loki       LokiConfig
+	Elastic    ElasticConfig
+	Fluent     FluentConfig
+	Import     ImportConfig
+	Tail       TailConfig
 }
 
 func (c *Config) EmptyToDefault() {
+	if c.Host == "" {
+		c.Host = "127.0.0.1"
+	}
+
 	if c.Port == "" {
 		c.Port = "8070"
 	}
@@ -30,7 +52,56 @@ func (c *Config) EmptyToDefault() {
 		c.Deleters = 1
 	}
 
+	if c.QueueSize == 0 {
+		c.QueueSize = 100
+	}
+
+	if c.QueueWait == 0 {
+		c.QueueWait = time.Second * 10
+	}
+
+	c.Query.EmptyToDefault()
 	c.Scheduler.EmptyToDefault()
+	c.Disk.EmptyToDefault()
+	c.Durability.EmptyToDefault()
+	c.OTLP.EmptyToDefault()
+	c.Syslog.EmptyToDefault()
+	c.Loki.EmptyToDefault()
+	c.Import.EmptyToDefault()
+	c.Tail.EmptyToDefault()
+}
+
+// Token bucket rate limits of requests to storage and from client. Zero rate means no limit
+type RateLimitConfig struct {
+	StorageRate  float64 // requests per second
+	StorageBurst int
+	ClientRate   float64 // requests per second
+	ClientBurst  int
+}
+
+type QueryConfig struct {
+	MemoryLimit int64 // bytes of logs/groups in memory, after which they are spilled to disk
+	SpillLimit  int64 // bytes of spilled logs/groups on disk
+	MaxRows     int
+	Timeout     time.Duration
+}
+
+func (c *QueryConfig) EmptyToDefault() {
+	if c.MemoryLimit == 0 {
+		c.MemoryLimit = 64 << 20
+	}
+
+	if c.SpillLimit == 0 {
+		c.SpillLimit = 1 << 30
+	}
+
+	if c.MaxRows == 0 {
+		c.MaxRows = 100_000
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = time.Minute
+	}
 }
 
 type SchedulerConfig struct {
@@ -38,6 +109,7 @@ type SchedulerConfig struct {
 	AligningPeriod   time.Duration
 	DelExpiredPeriod time.Duration
 	RmFilesPeriod    time.Duration
+	CheckpointPeriod time.Duration
 }
 
 func (c *SchedulerConfig) EmptyToDefault() {
@@ -56,4 +128,130 @@ func (c *SchedulerConfig) EmptyToDefault() {
 	if c.RmFilesPeriod == 0 {
 		c.RmFilesPeriod = time.Minute
 	}
+
+	if c.CheckpointPeriod == 0 {
+		c.CheckpointPeriod = time.Minute
+	}
+}
+
+// Thresholds of free space on data volumes. Zero threshold is switched off
+type DiskConfig struct {
+	SoftLimit   int64    // free bytes, below which the oldest chunks of sheddable storages are deleted
+	HardLimit   int64    // free bytes, below which writing of logs is rejected
+	Sheddable   []string // storages, which may lose the oldest logs before TTL
+	CheckPeriod time.Duration
+}
+
+func (c *DiskConfig) EmptyToDefault() {
+	if c.CheckPeriod == 0 {
+		c.CheckPeriod = time.Second * 10
+	}
+}
+
+// Durability defines when changed files reach stable storage before response
+type DurabilityConfig struct {
+	Mode        string        // DURABILITY_* constant
+	GroupPeriod time.Duration // period of group commit
+}
+
+func (c *DurabilityConfig) EmptyToDefault() {
+	if c.Mode == "" {
+		c.Mode = DURABILITY_NONE
+	}
+
+	if c.GroupPeriod == 0 {
+		c.GroupPeriod = time.Millisecond * 10
+	}
+}
+
+// Mapping of OTLP logs to storages
+type OTLPConfig struct {
+	StorageAttr    string // resource attribute, which value is name of storage
+	DefaultStorage string // storage of resources without the attribute, if empty they are rejected
+}
+
+func (c *OTLPConfig) EmptyToDefault() {
+	if c.StorageAttr == "" {
+		c.StorageAttr = "service.name"
+	}
+}
+
+// Mapping of streams of Loki push API to storages
+type LokiConfig struct {
+	StorageLabel   string // label of stream, which value is name of storage
+	DefaultStorage string // storage of streams without the label, if empty they are rejected
+}
+
+func (c *LokiConfig) EmptyToDefault() {
+	if c.StorageLabel == "" {
+		c.StorageLabel = "job"
+	}
+}
+
+// Ingest of bulks of Elasticsearch, index is storage
+type ElasticConfig struct {
+	Mapping map[string]string // path of document field by column of log
+}
+
+// Imports of dump files of sherlog, which are watched
+type ImportConfig struct {
+	PollPeriod time.Duration // period of reading of new logs of dump files
+}
+
+func (c *ImportConfig) EmptyToDefault() {
+	if c.PollPeriod == 0 {
+		c.PollPeriod = time.Second
+	}
+}
+
+// Tailing of local files. Logs are written in-process or sent to remote server in agent mode
+type TailConfig struct {
+	Tails      []*Tail
+	Remote     string        // URL of server, which receives logs in agent mode
+	PollPeriod time.Duration // period of reading of new lines
+}
+
+func (c *TailConfig) EmptyToDefault() {
+	if c.PollPeriod == 0 {
+		c.PollPeriod = time.Second
+	}
+}
+
+// Tail is files of glob pattern, which lines are parsed to logs of storage
+type Tail struct {
+	Path    string `json:"path"`
+	Storage string `json:"storage"`
+	Format  string `json:"format"`  // json, logfmt or regex
+	Regex   string `json:"regex"`   // with named groups, only for regex format
+	Mapping string `json:"mapping"` // pairs "column:path", which replace default mapping
+}
+
+// Listener of forward protocol of Fluentd and Fluent Bit, tag of message is storage.
+// Empty address switches listener off
+type FluentConfig struct {
+	Addr    string
+	Mapping map[string]string // path of record field by column of log
+}
+
+// Listeners of syslog (RFC 5424 and RFC 3164). Empty address switches listener off
+type SyslogConfig struct {
+	UDPAddr     string
+	TCPAddr     string
+	Storage     string        // storage of received logs
+	BatchSize   int           // max logs in a batch of writing
+	FlushPeriod time.Duration // period, after which not full batch is written
+}
+
+func (c *SyslogConfig) EmptyToDefault() {
+	if c.Storage == "" {
+		c.Storage = "syslog"
+	}
+
+	if c.BatchSize == 0 {
+		c.BatchSize = MAX_LOGS_IN_CHUNK
+	}
+
+	if c.FlushPeriod == 0 {
+		c.FlushPeriod = time.Second
+	}
 }
@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 // Chunks
 
 const (
@@ -13,6 +15,41 @@ const (
 	DIR_STORAGES     string = "storages"
 	DIR_TRANSACTIONS string = "transactions"
 	DIR_DELETE_TASKS string = "delete_tasks"
+	DIR_TMP          string = "tmp"
+	DIR_WAL          string = "wal"
+	DIR_IMPORTS      string = "imports"
+	DIR_TAILS        string = "tails"
+	DIR_PIPELINES    string = "pipelines"
+)
+
+// Files
+
+const (
+	FILE_MANIFEST string = "_manifest_"
+	FILE_LOCK     string = "_lock_"
+	FILE_PROBE    string = "_probe_"
+	FILE_BATCHES  string = "_batches_" // prefix of files with batch IDs of writers
+)
+
+// Logs, limits of columns are checked by Log.Errors and kept by mappers of other formats
+
+const (
+	MAX_VALUE_LEN   int = 50  // of entity, entity_id, traces, modules, labels, keys and values of fields
+	MAX_MESSAGE_LEN int = 255 // of message
+	MAX_ITEMS       int = 20  // of traces, labels and fields
+	MAX_MODULES     int = 40
+)
+
+// Batches
+
+const MAX_BATCH_IDS int = 10000 // recent batch IDs per storage, which are checked for repeats
+
+// Durability modes
+
+const (
+	DURABILITY_NONE  string = "none"  // files are synced by OS
+	DURABILITY_FSYNC string = "fsync" // files are synced by every request
+	DURABILITY_GROUP string = "group" // files of concurrent requests are synced together
 )
 
 // Columns
@@ -43,6 +80,25 @@ func GetLogColumns() []string {
 	}
 }
 
+// Levels
+
+var _levelNames = map[string]byte{
+	"trace": 0, "micro": 0,
+	"debug": 1,
+	"stage": 2,
+	"note":  3, "notice": 3,
+	"info": 4, "information": 4,
+	"warn": 5, "warning": 5,
+	"error": 6, "err": 6,
+	"fatal": 7, "critical": 7, "crit": 7, "panic": 7, "alert": 7, "emerg": 7, "emergency": 7,
+}
+
+// GetLevel returns level by its name in other logging systems (e.g. "warning", "ERROR")
+func GetLevel(name string) (byte, bool) {
+	level, ok := _levelNames[strings.ToLower(name)]
+	return level, ok
+}
+
 // Types
 
 type ValueType byte
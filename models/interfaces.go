@@ -21,6 +21,13 @@ type ICondition interface {
 type IAggregator interface {
 	Update(*sl.Trace, *Log) error
 	GetResult() any
+	GetState() []int64
+	MergeState([]int64)
 	CopyDefault() IAggregator
 	Equals(IAggregator) bool
 }
+
+type IMetaAggregator interface {
+	IsMetaUpdatable() bool
+	UpdateByMeta(*Meta)
+}
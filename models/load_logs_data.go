@@ -8,6 +8,7 @@ type LoadLogsData struct {
 	Storage   string
 	Columns   map[string]bool
 	TimeRange TimeRange
+	UseMetas  bool
 }
 
 func NewLoadLogsData() *LoadLogsData {
@@ -19,5 +20,6 @@ func NewLoadLogsData() *LoadLogsData {
 func (lld *LoadLogsData) Equals(other *LoadLogsData) bool {
 	return lld.Storage == other.Storage &&
 		tools.EqualMaps(lld.Columns, other.Columns) &&
-		lld.TimeRange == other.TimeRange
+		lld.TimeRange == other.TimeRange &&
+		lld.UseMetas == other.UseMetas
 }
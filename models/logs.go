@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"strings"
+
 	sl "github.com/j-hitgate/sherlog"
 
 	aerr "main/app_errors"
@@ -19,99 +22,93 @@ type Log struct {
 	Fields    map[string]string `json:"fields"`
 }
 
-func (l *Log) Validate(trace *sl.Trace) (err error) {
-	popModule := trace.AddModule("_Log", "Validate")
-	defer func() {
-		if err != nil {
-			trace.NOTE(nil, err.Error())
-		}
-		popModule()
-	}()
+// FieldError is reason, why value of log column is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Errors returns reasons of all invalid columns of log
+func (l *Log) Errors() []*FieldError {
+	errs := []*FieldError{}
+
+	add := func(field, reason string) {
+		errs = append(errs, &FieldError{Field: field, Reason: reason})
+	}
 
 	// Integers
 
 	if l.Timestamp == 0 {
-		err = aerr.NewAppErr(aerr.BadReq, "'timestamp' a required column")
-		return err
+		add(C_TIMESTAMP, "'timestamp' a required column")
 	}
 
 	if l.Level > 7 {
-		err = aerr.NewAppErr(aerr.BadReq, "'level' must be in range 0-7")
-		return err
+		add(C_LEVEL, "'level' must be in range 0-7")
 	}
 
 	// Strings
 
-	if l.Entity == "" || len(l.Entity) > 50 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of characters in 'entity' must be from 1 to 50")
-		return err
+	if l.Entity == "" || len(l.Entity) > MAX_VALUE_LEN {
+		add(C_ENTITY, fmt.Sprint("Number of characters in 'entity' must be from 1 to ", MAX_VALUE_LEN))
 	}
 
-	if l.EntityID == "" || len(l.EntityID) > 50 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of characters in 'entity_id' must be from 1 to 50")
-		return err
+	if l.EntityID == "" || len(l.EntityID) > MAX_VALUE_LEN {
+		add(C_ENTITY_ID, fmt.Sprint("Number of characters in 'entity_id' must be from 1 to ", MAX_VALUE_LEN))
 	}
 
-	if l.Message == "" || len(l.Message) > 255 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of characters in 'message' must be from 1 to 255")
-		return err
+	if l.Message == "" || len(l.Message) > MAX_MESSAGE_LEN {
+		add(C_MESSAGE, fmt.Sprint("Number of characters in 'message' must be from 1 to ", MAX_MESSAGE_LEN))
 	}
 
 	// Arrays
 
-	if len(l.Traces) == 0 || len(l.Traces) > 20 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of 'traces' must be from 1 to 20")
-		return err
+	if len(l.Traces) == 0 || len(l.Traces) > MAX_ITEMS {
+		add(C_TRACES, fmt.Sprint("Number of 'traces' must be from 1 to ", MAX_ITEMS))
 	}
 
 	for _, trace := range l.Traces {
-		if trace == "" || len(trace) > 50 {
-			err = aerr.NewAppErr(aerr.BadReq, "Number of characters in the all 'traces' must be from 1 to 50")
-			return err
+		if trace == "" || len(trace) > MAX_VALUE_LEN {
+			add(C_TRACES, fmt.Sprint("Number of characters in the all 'traces' must be from 1 to ", MAX_VALUE_LEN))
+			break
 		}
 	}
 
-	if len(l.Modules) == 0 || len(l.Modules) > 40 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of 'modules' must be from 1 to 40")
-		return err
+	if len(l.Modules) == 0 || len(l.Modules) > MAX_MODULES {
+		add(C_MODULES, fmt.Sprint("Number of 'modules' must be from 1 to ", MAX_MODULES))
 	}
 
 	for _, module := range l.Modules {
-		if module == "" || len(module) > 50 {
-			err = aerr.NewAppErr(aerr.BadReq, "Number of characters in the all 'modules' must be from 1 to 50")
-			return err
+		if module == "" || len(module) > MAX_VALUE_LEN {
+			add(C_MODULES, fmt.Sprint("Number of characters in the all 'modules' must be from 1 to ", MAX_VALUE_LEN))
+			break
 		}
 	}
 
-	if len(l.Labels) > 20 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of 'labels' is more than 20")
-		return err
+	if len(l.Labels) > MAX_ITEMS {
+		add(C_LABELS, fmt.Sprint("Number of 'labels' is more than ", MAX_ITEMS))
 	}
 
 	for _, label := range l.Labels {
-		if label == "" || len(label) > 50 {
-			err = aerr.NewAppErr(aerr.BadReq, "Number of characters in the all 'labels' must be from 1 to 50")
-			return err
+		if label == "" || len(label) > MAX_VALUE_LEN {
+			add(C_LABELS, fmt.Sprint("Number of characters in the all 'labels' must be from 1 to ", MAX_VALUE_LEN))
+			break
 		}
 	}
 
 	// Map
 
-	if len(l.Fields) > 20 {
-		err = aerr.NewAppErr(aerr.BadReq, "Number of parameters in 'fields' is more than 20 records")
-		return err
+	if len(l.Fields) > MAX_ITEMS {
+		add(C_FIELDS, fmt.Sprint("Number of parameters in 'fields' is more than ", MAX_ITEMS, " records"))
 	}
 
 	for key, val := range l.Fields {
-		if key == "" || len(key) > 50 || val == "" || len(val) > 50 {
-			err = aerr.NewAppErr(aerr.BadReq,
-				"Number of characters in the all keys and values in 'fields' must be from 1 to 50",
-			)
-			return err
+		if key == "" || len(key) > MAX_VALUE_LEN || val == "" || len(val) > MAX_VALUE_LEN {
+			add(C_FIELDS, fmt.Sprint("Number of characters in the all keys and values in 'fields' must be from 1 to ", MAX_VALUE_LEN))
+			break
 		}
 	}
 
-	return nil
+	return errs
 }
 
 func (l *Log) GetValue(column string) (any, bool) {
@@ -162,6 +159,22 @@ func (l *Log) Get(column string) (any, bool) {
 	return nil, false
 }
 
+// Approximate size of log in memory
+func (l *Log) Size() int64 {
+	size := 160 + len(l.Entity) + len(l.EntityID) + len(l.Message)
+
+	for _, arr := range [][]string{l.Traces, l.Modules, l.Labels} {
+		for i := range arr {
+			size += 16 + len(arr[i])
+		}
+	}
+
+	for key, val := range l.Fields {
+		size += 32 + len(key) + len(val)
+	}
+	return int64(size)
+}
+
 func (l *Log) Equals(other *Log) bool {
 	return l.Timestamp == other.Timestamp &&
 		l.Level == other.Level &&
@@ -178,31 +191,127 @@ func (l *Log) Equals(other *Log) bool {
 
 type Logs struct {
 	Storage string `json:"storage"`
+	BatchID string `json:"batch_id"`
+	Partial bool   `json:"partial"` // invalid logs are skipped and reported
 	Logs    []*Log `json:"logs"`
 }
 
-func (ls *Logs) Validate(trace *sl.Trace) error {
+// Validate checks all logs. In partial mode invalid logs are removed from batch and reported,
+// otherwise batch with any invalid log is rejected. Report is nil if batch itself is invalid
+func (ls *Logs) Validate(trace *sl.Trace) (*ValidationReport, error) {
 	defer trace.AddModule("_Logs", "Validate")()
 
 	if ls.Storage == "" || len(ls.Storage) > 200 {
 		err := aerr.NewAppErr(aerr.BadReq, "Number of characters in 'storage' must be from 1 to 200")
 		trace.NOTE(nil, err.Error())
-		return err
+		return nil, err
+	}
+
+	if len(ls.BatchID) > 100 || strings.ContainsAny(ls.BatchID, "\r\n") {
+		err := aerr.NewAppErr(aerr.BadReq, "'batch_id' must be no longer than 100 characters and without line breaks")
+		trace.NOTE(nil, err.Error())
+		return nil, err
 	}
 
 	if len(ls.Logs) == 0 {
 		err := aerr.NewAppErr(aerr.BadReq, "'logs' not specified")
 		trace.NOTE(nil, err.Error())
+		return nil, err
+	}
+
+	// Invalid logs are collected to report
+
+	report := &ValidationReport{Rejected: []*RejectedLog{}}
+	valid := make([]*Log, 0, len(ls.Logs))
+
+	for i, l := range ls.Logs {
+		if errs := l.Errors(); len(errs) > 0 {
+			report.Rejected = append(report.Rejected, &RejectedLog{Index: i, Errors: errs})
+		} else {
+			valid = append(valid, l)
+		}
+	}
+	report.Accepted = len(valid)
+
+	if len(report.Rejected) == 0 {
+		return report, nil
+	}
+
+	first := report.Rejected[0]
+	msg := fmt.Sprint(len(report.Rejected), " of ", len(ls.Logs), " logs are invalid, log ", first.Index, ": ", first.Errors[0].Reason)
+
+	// In strict mode batch is rejected entirely
+	if !ls.Partial || len(valid) == 0 {
+		report.Accepted = 0
+		err := aerr.NewAppErr(aerr.BadReq, msg)
+		trace.NOTE(nil, err.Error())
+		return report, err
+	}
+
+	trace.NOTE(nil, msg)
+	ls.Logs = valid
+	return report, nil
+}
+
+// RejectedLog is index of invalid log in batch with reasons
+type RejectedLog struct {
+	Index  int           `json:"index"`
+	Errors []*FieldError `json:"errors"`
+}
+
+type ValidationReport struct {
+	Accepted int            `json:"accepted"`
+	Rejected []*RejectedLog `json:"rejected"`
+}
+
+// MultiLogs is batches of logs for several storages
+type MultiLogs struct {
+	Batches []*Logs `json:"batches"`
+	Atomic  bool    `json:"atomic"` // all batches are saved or none
+}
+
+func (ml *MultiLogs) Validate(trace *sl.Trace) error {
+	defer trace.AddModule("_MultiLogs", "Validate")()
+
+	if len(ml.Batches) == 0 || len(ml.Batches) > 100 {
+		err := aerr.NewAppErr(aerr.BadReq, "Number of 'batches' must be from 1 to 100")
+		trace.NOTE(nil, err.Error())
 		return err
 	}
 
-	for _, l := range ls.Logs {
-		err := l.Validate(trace)
+	storages := make(map[string]bool, len(ml.Batches))
 
-		if err != nil {
+	for _, batch := range ml.Batches {
+		if batch == nil {
+			err := aerr.NewAppErr(aerr.BadReq, "Batch is null")
+			trace.NOTE(nil, err.Error())
 			return err
 		}
-	}
 
+		if storages[batch.Storage] {
+			err := aerr.NewAppErr(aerr.BadReq, "Storage '", batch.Storage, "' is repeated in 'batches'")
+			trace.NOTE(nil, err.Error())
+			return err
+		}
+		storages[batch.Storage] = true
+	}
 	return nil
 }
+
+func (ml *MultiLogs) Storages() []string {
+	storages := make([]string, len(ml.Batches))
+
+	for i := range ml.Batches {
+		storages[i] = ml.Batches[i].Storage
+	}
+	return storages
+}
+
+// StorageResult is result of saving batch of storage
+type StorageResult struct {
+	Storage  string         `json:"storage"`
+	Status   int            `json:"status"`
+	Error    string         `json:"error"`
+	Accepted int            `json:"accepted"`
+	Rejected []*RejectedLog `json:"rejected,omitempty"`
+}
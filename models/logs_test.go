@@ -0,0 +1,177 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/stretchr/testify/assert"
+
+	aerr "main/app_errors"
+	m "main/models"
+	tt "main/test_tools"
+)
+
+func TestLogErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		change func(l *m.Log)
+		fields []string
+	}{
+		{
+			name:   "valid log",
+			change: func(l *m.Log) {},
+			fields: []string{},
+		},
+		{
+			name: "invalid integers",
+			change: func(l *m.Log) {
+				l.Timestamp = 0
+				l.Level = 8
+			},
+			fields: []string{m.C_TIMESTAMP, m.C_LEVEL},
+		},
+		{
+			name: "invalid strings",
+			change: func(l *m.Log) {
+				l.Entity = ""
+				l.Message = strings.Repeat("a", 256)
+			},
+			fields: []string{m.C_ENTITY, m.C_MESSAGE},
+		},
+		{
+			name: "invalid items of arrays",
+			change: func(l *m.Log) {
+				l.Traces = []string{"trace", ""}
+				l.Labels = []string{strings.Repeat("a", 51)}
+			},
+			fields: []string{m.C_TRACES, m.C_LABELS},
+		},
+		{
+			name: "too many modules and fields",
+			change: func(l *m.Log) {
+				l.Modules = make([]string, 41)
+				l.Fields = map[string]string{}
+
+				for i := 0; i < 21; i++ {
+					l.Fields[strings.Repeat("k", i+1)] = "val"
+				}
+			},
+			// Modules are empty, so their length is reported too
+			fields: []string{m.C_MODULES, m.C_MODULES, m.C_FIELDS},
+		},
+	}
+
+	for _, tc := range testCases {
+		l := tt.CreateLog()
+		tc.change(l)
+
+		fields := []string{}
+
+		for _, err := range l.Errors() {
+			fields = append(fields, err.Field)
+			assert.NotEmpty(t, err.Reason, tc.name)
+		}
+		assert.Equal(t, tc.fields, fields, tc.name)
+	}
+}
+
+func TestLogsValidate(t *testing.T) {
+	tt.SherlogInit()
+
+	invalid := tt.CreateLog()
+	invalid.Level = 8
+
+	testCases := []struct {
+		name     string
+		logs     *m.Logs
+		accepted int
+		rejected []int // indexes of rejected logs
+		left     int   // logs in batch after validation
+		hasError bool
+		noReport bool
+	}{
+		{
+			name:     "valid logs",
+			logs:     &m.Logs{Storage: "storage", Logs: []*m.Log{tt.CreateLog(), tt.CreateLog()}},
+			accepted: 2,
+			rejected: []int{},
+			left:     2,
+		},
+		{
+			name:     "strict batch with invalid log",
+			logs:     &m.Logs{Storage: "storage", Logs: []*m.Log{tt.CreateLog(), invalid}},
+			accepted: 0,
+			rejected: []int{1},
+			left:     2,
+			hasError: true,
+		},
+		{
+			name:     "partial batch with invalid log",
+			logs:     &m.Logs{Storage: "storage", Partial: true, Logs: []*m.Log{invalid, tt.CreateLog(), tt.CreateLog()}},
+			accepted: 2,
+			rejected: []int{0},
+			left:     2,
+		},
+		{
+			name:     "partial batch with all invalid logs",
+			logs:     &m.Logs{Storage: "storage", Partial: true, Logs: []*m.Log{invalid, invalid}},
+			accepted: 0,
+			rejected: []int{0, 1},
+			left:     2,
+			hasError: true,
+		},
+		{
+			name:     "no storage",
+			logs:     &m.Logs{Logs: []*m.Log{tt.CreateLog()}},
+			hasError: true,
+			noReport: true,
+		},
+		{
+			name:     "batch ID with line break",
+			logs:     &m.Logs{Storage: "storage", BatchID: "id\n", Logs: []*m.Log{tt.CreateLog()}},
+			hasError: true,
+			noReport: true,
+		},
+		{
+			name:     "no logs",
+			logs:     &m.Logs{Storage: "storage", Partial: true},
+			hasError: true,
+			noReport: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		report, err := tc.logs.Validate(sl.NewTrace("Main"))
+
+		if tc.hasError {
+			if assert.IsType(t, &aerr.AppErr{}, err, tc.name) {
+				assert.Equal(t, aerr.BadReq, err.(*aerr.AppErr).Type(), tc.name)
+			}
+		} else {
+			assert.NoError(t, err, tc.name)
+		}
+
+		if tc.noReport {
+			assert.Nil(t, report, tc.name)
+			continue
+		}
+
+		if !assert.NotNil(t, report, tc.name) {
+			continue
+		}
+		assert.Equal(t, tc.accepted, report.Accepted, tc.name)
+
+		rejected := []int{}
+
+		for _, rl := range report.Rejected {
+			rejected = append(rejected, rl.Index)
+
+			if assert.NotEmpty(t, rl.Errors, tc.name) {
+				assert.Equal(t, m.C_LEVEL, rl.Errors[0].Field, tc.name)
+			}
+		}
+		assert.Equal(t, tc.rejected, rejected, tc.name)
+		assert.Len(t, tc.logs.Logs, tc.left, tc.name)
+	}
+}
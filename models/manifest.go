@@ -0,0 +1,13 @@
+package models
+
+// Manifest is a checkpoint of chunk metas of storage, so chunks are not listed and metas are not readed
+// one by one at startup. It is removed with changes of chunks, which it doesn't know, so existing manifest
+// has all chunks of storage
+type Manifest struct {
+	Chunks    map[string]*Meta // by chunk names, metas of raw chunks are readed from disk
+	ForRemove []string         // names of chunks, which are not used, but not removed yet
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{Chunks: map[string]*Meta{}}
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"context"
+	"path/filepath"
+
 	sl "github.com/j-hitgate/sherlog"
 
 	aerr "main/app_errors"
@@ -41,13 +44,21 @@ func (q *SearchQuery) Equals(other *SearchQuery) bool {
 // Delete logs
 
 type DeleteQuery struct {
-	Storage     string     `json:"storage"`
-	TimeRange   string     `json:"time_range"`
-	Where       string     `json:"where"`
-	WhereValues []any      `json:"where_values"`
-	TaskID      string     `json:"-" msgpack:"-"`
-	ErrCh       chan error `json:"-" msgpack:"-"`
-	Trace       *sl.Trace  `json:"-" msgpack:"-"`
+	Storage     string          `json:"storage"`
+	TimeRange   string          `json:"time_range"`
+	Where       string          `json:"where"`
+	WhereValues []any           `json:"where_values"`
+	TaskID      string          `json:"-" msgpack:"-"`
+	ErrCh       chan error      `json:"-" msgpack:"-"`
+	Trace       *sl.Trace       `json:"-" msgpack:"-"`
+	Ctx         context.Context `json:"-" msgpack:"-"`
+}
+
+func (dl *DeleteQuery) Context() context.Context {
+	if dl.Ctx == nil {
+		return context.Background()
+	}
+	return dl.Ctx
 }
 
 func (dl *DeleteQuery) Validate(trace *sl.Trace) error {
@@ -58,6 +69,9 @@ func (dl *DeleteQuery) Validate(trace *sl.Trace) error {
 		trace.NOTE(nil, err.Error())
 		return err
 	}
+
+	// Query is saved as task
+	tools.ToNumbers(dl.WhereValues)
 	return nil
 }
 
@@ -65,6 +79,7 @@ func (dl *DeleteQuery) Validate(trace *sl.Trace) error {
 
 type Storage struct {
 	Storage string `json:"storage"`
+	DataDir string `json:"data_dir"` // optional, only for creating
 }
 
 func (s *Storage) Validate(trace *sl.Trace) error {
@@ -79,6 +94,113 @@ func (s *Storage) Validate(trace *sl.Trace) error {
 	return nil
 }
 
+// Import of dump files of sherlog
+
+type Import struct {
+	ID      string           `json:"id"`
+	Storage string           `json:"storage"`
+	Dir     string           `json:"dir"`     // absolute path of logs dir of sherlog
+	Offsets map[string]int64 `json:"offsets"` // read bytes by name of dump file
+	Starts  map[string]int64 `json:"starts"`  // time of start of reading of dump file from beginning
+}
+
+func (imp *Import) Validate(trace *sl.Trace) error {
+	defer trace.AddModule("_Import", "Validate")()
+
+	if imp.Storage == "" || len(imp.Storage) > 200 {
+		err := aerr.NewAppErr(aerr.BadReq, "Number of characters in 'storage' must be from 1 to 200")
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+
+	if !filepath.IsAbs(imp.Dir) {
+		err := aerr.NewAppErr(aerr.BadReq, "'dir' must be an absolute path")
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Copy returns import with copy of offsets and starts
+func (imp *Import) Copy() *Import {
+	cp := *imp
+	cp.Offsets = make(map[string]int64, len(imp.Offsets))
+	cp.Starts = make(map[string]int64, len(imp.Starts))
+
+	for name, offset := range imp.Offsets {
+		cp.Offsets[name] = offset
+	}
+
+	for name, start := range imp.Starts {
+		cp.Starts[name] = start
+	}
+	return &cp
+}
+
+// Pipeline of storage, its steps transform received logs before validation
+
+const (
+	STEP_EXTRACT string = "extract" // regex or grok groups of column to fields
+	STEP_RENAME  string = "rename"  // moving of value between columns
+	STEP_LABELS  string = "labels"  // adding of static labels
+	STEP_LEVEL   string = "level"   // level by name
+	STEP_DROP    string = "drop"    // removing of fields
+	STEP_IF      string = "if"      // steps by condition
+)
+
+type Pipeline struct {
+	Storage string          `json:"storage"`
+	Steps   []*PipelineStep `json:"steps"`
+}
+
+// PipelineStep is one transformation, its options depend on type. Source and target columns are
+// 'message', 'entity', 'entity_id' or 'fields.<key>'
+type PipelineStep struct {
+	Type        string          `json:"type"`
+	From        string          `json:"from,omitempty"`         // source column of extract, rename and level
+	To          string          `json:"to,omitempty"`           // target column of rename
+	Regex       string          `json:"regex,omitempty"`        // regex with named groups for extract
+	Grok        string          `json:"grok,omitempty"`         // grok pattern for extract
+	Labels      []string        `json:"labels,omitempty"`       // added labels
+	Levels      map[string]byte `json:"levels,omitempty"`       // levels by names, they extend known names
+	Fields      []string        `json:"fields,omitempty"`       // removed keys of fields
+	Where       string          `json:"where,omitempty"`        // condition of if
+	WhereValues []any           `json:"where_values,omitempty"` // values of condition
+	Then        []*PipelineStep `json:"then,omitempty"`         // steps if condition is true
+	Else        []*PipelineStep `json:"else,omitempty"`         // steps if condition is false
+}
+
+func (p *Pipeline) Validate(trace *sl.Trace) error {
+	defer trace.AddModule("_Pipeline", "Validate")()
+
+	if p.Storage == "" || len(p.Storage) > 200 {
+		err := aerr.NewAppErr(aerr.BadReq, "Number of characters in 'storage' must be from 1 to 200")
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+
+	if len(p.Steps) == 0 {
+		err := aerr.NewAppErr(aerr.BadReq, "'steps' not specified")
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+
+	// Definition is saved
+	toNumbersOfSteps(p.Steps)
+	return nil
+}
+
+func toNumbersOfSteps(steps []*PipelineStep) {
+	for _, step := range steps {
+		if step == nil {
+			continue
+		}
+		tools.ToNumbers(step.WhereValues)
+		toNumbersOfSteps(step.Then)
+		toNumbersOfSteps(step.Else)
+	}
+}
+
 // Shutdown
 
 type Shutdown struct {
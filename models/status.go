@@ -0,0 +1,13 @@
+package models
+
+const (
+	MODE_READ_WRITE string = "read-write"
+	MODE_READ_ONLY  string = "read-only"
+)
+
+type Status struct {
+	Mode     string `json:"mode"`
+	Reason   string `json:"reason,omitempty"`
+	Since    int64  `json:"since,omitempty"` // start of read-only mode in ms
+	LowSpace bool   `json:"low_space"`       // writing of logs is rejected
+}
@@ -1,18 +1,50 @@
 package models
 
 import (
+	"context"
 	"sync"
 
 	sl "github.com/j-hitgate/sherlog"
 )
 
+// columnsErr keeps first error of column workers of chunk task
+type columnsErr struct {
+	err error
+	mx  sync.Mutex
+}
+
+func (e *columnsErr) SetErr(err error) {
+	e.mx.Lock()
+
+	if e.err == nil {
+		e.err = err
+	}
+	e.mx.Unlock()
+}
+
+func (e *columnsErr) Err() error {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	return e.err
+}
+
 // Write
 
 type WriteLogsTask struct {
 	Storage string
+	BatchID string // optional, repeated batch is not written again
 	Logs    []*Log
+	Others  []*Logs // batches of other storages, which are saved together with logs
 	ErrCh   chan error
 	Trace   *sl.Trace
+	Ctx     context.Context
+}
+
+func (t *WriteLogsTask) Context() context.Context {
+	if t.Ctx == nil {
+		return context.Background()
+	}
+	return t.Ctx
 }
 
 type WriteToChunkTask struct {
@@ -21,6 +53,7 @@ type WriteToChunkTask struct {
 	Logs      []*Log
 	Wg        *sync.WaitGroup
 	Traces    map[string]*sl.Trace
+	columnsErr
 }
 
 func NewWriteToChunkTask(trace *sl.Trace, chunkPath string, meta *Meta, logs []*Log) *WriteToChunkTask {
@@ -38,8 +71,17 @@ func NewWriteToChunkTask(trace *sl.Trace, chunkPath string, meta *Meta, logs []*
 type ReadLogsTask struct {
 	Lld    *LoadLogsData
 	LogsCh chan []*Log
+	Metas  []*Meta // chunks fully in time range, which are not readed (if Lld.UseMetas). Set before closing LogsCh
 	ErrCh  chan error
 	Trace  *sl.Trace
+	Ctx    context.Context
+}
+
+func (t *ReadLogsTask) Context() context.Context {
+	if t.Ctx == nil {
+		return context.Background()
+	}
+	return t.Ctx
 }
 
 type ReadChunkTask struct {
@@ -47,6 +89,7 @@ type ReadChunkTask struct {
 	ChunkPath string
 	Wg        *sync.WaitGroup
 	Traces    map[string]*sl.Trace
+	columnsErr
 }
 
 func NewReadChunkTask(trace *sl.Trace, chunkPath string, logsLen int) *ReadChunkTask {
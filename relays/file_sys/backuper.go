@@ -16,6 +16,7 @@ type Backuper struct {
 	cancelTx *Transaction
 	fileSys  *FileSys
 	trace    *sl.Trace
+	accepted bool // cancel is committed, so changes can't be rolled back
 }
 
 func NewBackuper(trace *sl.Trace, name string) *Backuper {
@@ -67,6 +68,17 @@ func (b *Backuper) AddForReplace(name string) {
 	b.cancelTx.Add(RenameAction(name, name[:len(name)-4]))
 }
 
+// AddForRemove adds file, which will be removed when changes are accepted (Cancel)
+func (b *Backuper) AddForRemove(name string) {
+	popModule := b.trace.AddModule("_Backuper", "AddForRemove")
+
+	if b.cancelTx == nil {
+		b.cancelTx = NewTransaction(b.trace, b.name)
+	}
+	b.cancelTx.Add(RemoveAction(name))
+	popModule()
+}
+
 func (b *Backuper) AddChunk(chunkPath string, offsets *m.Offsets) {
 	defer b.trace.AddModule("_Transaction", "AddChunk")()
 	var name string
@@ -87,27 +99,51 @@ func (b *Backuper) AddChunk(chunkPath string, offsets *m.Offsets) {
 	b.AddForReplace(name)
 }
 
-func (b *Backuper) Commit() {
-	b.backupTx.Commit()
+func (b *Backuper) Commit() error {
+	return b.backupTx.Commit()
 }
 
-func (b *Backuper) Cancel() {
-	if b.cancelTx != nil {
-		b.cancelTx.Commit()
-		b.cancelTx.Apply()
-	} else {
-		b.backupTx.Cancel()
+// Cancel accepts changes. On error changes must be rolled back by Backup.
+// If cancel is committed, changes stay accepted even on error of syncing
+func (b *Backuper) Cancel() error {
+	if b.cancelTx == nil {
+		return b.backupTx.Cancel()
+	}
+
+	// Changes are durable before cancel replaces their backup
+	if err := b.fileSys.Sync(b.trace); err != nil {
+		return err
 	}
+
+	if err := b.cancelTx.Commit(); err != nil {
+		return err
+	}
+	b.accepted = true
+	return b.cancelTx.Apply()
 }
 
+// Backup rolls back changes. Accepted changes are kept, committed cancel replaced
+// their backup and is applied again after restart
 func (b *Backuper) Backup() {
-	b.backupTx.Apply()
+	defer b.trace.AddModule("_Backuper", "Backup")()
+
+	if b.accepted {
+		return
+	}
+
+	if err := b.backupTx.Apply(); err != nil {
+		b.trace.NOTE(nil, "Rollback will be applied again after restart: ", err.Error())
+	}
 }
 
-func (b *Backuper) BackupIfErr(err error) {
+// BackupIfErr rolls back changes on error, otherwise accepts them
+func (b *Backuper) BackupIfErr(err error) error {
+	if err == nil {
+		err = b.Cancel()
+	}
+
 	if err != nil {
 		b.Backup()
-	} else {
-		b.Cancel()
 	}
+	return err
 }
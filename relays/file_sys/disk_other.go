@@ -0,0 +1,24 @@
+//go:build !(linux || darwin || freebsd)
+
+package file_sys
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("getting free space is not supported on this OS")
+}
+
+// Dirs can't be synced on this OS, their entries are synced by OS
+func syncDir(dir string) error {
+	return nil
+}
+
+// Errors of disk can't be recognized on this OS, so only errors of one file or dir are excluded
+func isDiskErr(err error) bool {
+	return !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrPermission) &&
+		!errors.Is(err, fs.ErrExist) && !errors.Is(err, syscall.ENOTDIR)
+}
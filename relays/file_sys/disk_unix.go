@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd
+
+package file_sys
+
+import (
+	"errors"
+	"syscall"
+)
+
+// freeSpace returns bytes available for unprivileged user on disk of dir
+func freeSpace(dir string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(dir, &stat)
+
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// syncDir makes entries of dir (created, renamed and removed files) durable
+func syncDir(dir string) error {
+	return syncFile(dir)
+}
+
+// isDiskErr checks that error is caused by disk (no space, quota, I/O error, read-only file system),
+// not by one file or dir, so writes to other files fail too
+func isDiskErr(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) ||
+		errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EROFS)
+}
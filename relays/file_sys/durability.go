@@ -0,0 +1,231 @@
+package file_sys
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	m "main/models"
+)
+
+// Changed files and dirs are marked as dirty and synced by Sync, which is called once per write
+// by transactions: changes are synced before their backup is canceled. So when Backuper.Cancel returns,
+// changes reached stable storage in the chosen durability mode. Order of transactions (commit
+// of backup before changing of files, applied actions before removing of transaction) is kept
+// by syncPaths, which syncs only files of transaction at once, so group commit is waited only once
+var _syncer = struct {
+	mode       string
+	period     time.Duration
+	files      map[string]bool
+	dirs       map[string]bool
+	waiters    []chan error
+	committing bool
+	mx         sync.Mutex
+	syncMx     sync.Mutex // only one sync at a time, so synced files are not taken by other sync before syncing
+}{
+	mode:  m.DURABILITY_NONE,
+	files: map[string]bool{},
+	dirs:  map[string]bool{},
+}
+
+// SetDurability sets durability mode. It is called at startup before any writes
+func SetDurability(mode string, groupPeriod time.Duration) {
+	_syncer.mx.Lock()
+	_syncer.mode = mode
+	_syncer.period = groupPeriod
+	_syncer.mx.Unlock()
+}
+
+func isDurable() bool {
+	_syncer.mx.Lock()
+	defer _syncer.mx.Unlock()
+	return _syncer.mode != m.DURABILITY_NONE
+}
+
+// markDirty marks changed files and their dirs (entries of files are changed)
+func markDirty(files ...string) {
+	_syncer.mx.Lock()
+	defer _syncer.mx.Unlock()
+
+	if _syncer.mode == m.DURABILITY_NONE {
+		return
+	}
+
+	for _, name := range files {
+		_syncer.files[name] = true
+		_syncer.dirs[filepath.Dir(name)] = true
+	}
+}
+
+// markDirtyDirs marks dirs, where files are created, renamed or removed
+func markDirtyDirs(dirs ...string) {
+	_syncer.mx.Lock()
+	defer _syncer.mx.Unlock()
+
+	if _syncer.mode == m.DURABILITY_NONE {
+		return
+	}
+
+	for _, dir := range dirs {
+		_syncer.dirs[dir] = true
+	}
+}
+
+// makeDirAll makes dir with parents. Made dirs and parent of the first one are marked
+// as dirty, so entries of new dirs and files in them are durable
+func makeDirAll(dir string) error {
+	made := []string{}
+
+	if isDurable() {
+		for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+			if _, err := os.Stat(d); !os.IsNotExist(err) {
+				break
+			}
+			made = append(made, d)
+
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if len(made) > 0 {
+		markDirtyDirs(append(made, filepath.Dir(made[len(made)-1]))...)
+	}
+	return nil
+}
+
+// Sync makes dirty files durable. In group mode it waits for the next group commit,
+// which syncs files of all concurrent requests at once
+func (fsr *FileSys) Sync(trace *sl.Trace) error {
+	defer trace.AddModule("_FileSys", "Sync")()
+
+	_syncer.mx.Lock()
+
+	switch _syncer.mode {
+	case m.DURABILITY_FSYNC:
+		_syncer.mx.Unlock()
+		return fsr.syncDirty(trace)
+
+	case m.DURABILITY_GROUP:
+		ch := make(chan error, 1)
+		_syncer.waiters = append(_syncer.waiters, ch)
+		isLeader := !_syncer.committing
+		_syncer.committing = true
+		period := _syncer.period
+		_syncer.mx.Unlock()
+
+		// First waiter commits the group after period, the others wait for it
+		if isLeader {
+			time.Sleep(period)
+
+			_syncer.mx.Lock()
+			waiters := _syncer.waiters
+			_syncer.waiters = nil
+			_syncer.committing = false
+			_syncer.mx.Unlock()
+
+			err := fsr.syncDirty(trace)
+
+			for _, waiter := range waiters {
+				waiter <- err
+			}
+		}
+		return <-ch
+
+	default:
+		_syncer.mx.Unlock()
+		return nil
+	}
+}
+
+func (fsr *FileSys) syncDirty(trace *sl.Trace) error {
+	_syncer.syncMx.Lock()
+	defer _syncer.syncMx.Unlock()
+
+	_syncer.mx.Lock()
+	files, dirs := _syncer.files, _syncer.dirs
+	_syncer.files, _syncer.dirs = map[string]bool{}, map[string]bool{}
+	_syncer.mx.Unlock()
+
+	filesCount, dirsCount := len(files), len(dirs)
+
+	// Files are synced before dirs, so synced entries point to synced content.
+	// On error not synced files and dirs stay dirty, so next sync retries them
+	for name := range files {
+		if err := syncFile(name); err != nil {
+			remarkDirty(files, dirs)
+			return fsr.writeErr(trace, sl.Fields{"name": name}, err, "Sync file error: ")
+		}
+		delete(files, name)
+	}
+
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			remarkDirty(files, dirs)
+			return fsr.writeErr(trace, sl.Fields{"dir": dir}, err, "Sync dir error: ")
+		}
+		delete(dirs, dir)
+	}
+
+	trace.DEBUG(nil, filesCount, " files and ", dirsCount, " dirs synced")
+	return nil
+}
+
+// syncPaths syncs files and dirs at once without waiting for group commit.
+// It keeps order of changes, which must be durable before next ones
+func (fsr *FileSys) syncPaths(trace *sl.Trace, files, dirs []string) error {
+	if !isDurable() {
+		return nil
+	}
+
+	for _, name := range files {
+		if err := syncFile(name); err != nil {
+			return fsr.writeErr(trace, sl.Fields{"name": name}, err, "Sync file error: ")
+		}
+	}
+
+	for _, dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return fsr.writeErr(trace, sl.Fields{"dir": dir}, err, "Sync dir error: ")
+		}
+	}
+	return nil
+}
+
+// remarkDirty returns not synced files and dirs to dirty ones
+func remarkDirty(files, dirs map[string]bool) {
+	_syncer.mx.Lock()
+	defer _syncer.mx.Unlock()
+
+	for name := range files {
+		_syncer.files[name] = true
+	}
+
+	for dir := range dirs {
+		_syncer.dirs[dir] = true
+	}
+}
+
+// syncFile syncs file, which may be already removed
+func syncFile(name string) error {
+	file, err := os.Open(name)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
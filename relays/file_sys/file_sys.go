@@ -3,6 +3,7 @@ package file_sys
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 
 	m "main/models"
+	"main/tools"
 )
 
 type FileSys struct{}
@@ -35,9 +37,20 @@ func (*FileSys) toBytes(v any) ([]byte, error) {
 	}
 }
 
+// writeErr logs error of writing. Errors of disk switch on read-only mode,
+// errors of one file (e.g. storage is removed concurrently) are returned to request
+func (*FileSys) writeErr(trace *sl.Trace, fields sl.Fields, err error, msg ...any) error {
+	trace.ERROR(fields, append(msg, err.Error())...)
+
+	if isDiskErr(err) {
+		return setReadOnly(trace, err)
+	}
+	return err
+}
+
 // Write
 
-func (fsr *FileSys) WriteFile(trace *sl.Trace, name string, atomic bool, v any) (writedBytes int) {
+func (fsr *FileSys) WriteFile(trace *sl.Trace, name string, atomic bool, v any) (writedBytes int, err error) {
 	defer trace.AddModule("_FileSys", "WriteFile")()
 	fields := sl.Fields{"name": name}
 
@@ -48,18 +61,19 @@ func (fsr *FileSys) WriteFile(trace *sl.Trace, name string, atomic bool, v any)
 	}
 
 	dir := filepath.Dir(name)
-	err = os.MkdirAll(dir, 0755)
+	err = makeDirAll(dir)
 
 	if err != nil {
-		trace.FATAL(fields, "Make dir error: ", err.Error())
+		return 0, fsr.writeErr(trace, fields, err, "Make dir error: ")
 	}
 
 	if !atomic {
 		err = os.WriteFile(name, data, 0644)
 
 		if err != nil {
-			trace.FATAL(fields, "Writing to file err: ", err.Error())
+			return 0, fsr.writeErr(trace, fields, err, "Writing to file err: ")
 		}
+		markDirty(name)
 
 	} else {
 		newName := name + ".new"
@@ -68,24 +82,33 @@ func (fsr *FileSys) WriteFile(trace *sl.Trace, name string, atomic bool, v any)
 		if err != nil {
 			os.Remove(newName)
 			fields["name"] = newName
-			trace.FATAL(fields, "Writing to file error: ", err.Error())
+			return 0, fsr.writeErr(trace, fields, err, "Writing to file error: ")
+		}
+
+		// Content is synced before renaming, otherwise file may be empty after crash
+		if isDurable() {
+			if err = syncFile(newName); err != nil {
+				os.Remove(newName)
+				return 0, fsr.writeErr(trace, fields, err, "Sync file error: ")
+			}
 		}
 
 		err = os.Rename(newName, name)
 
 		if err != nil {
 			os.Remove(newName)
-			trace.FATAL(fields, "Renameing error: ", err.Error())
+			return 0, fsr.writeErr(trace, fields, err, "Renameing error: ")
 		}
+		markDirtyDirs(dir)
 	}
 
 	fields["bytes"] = fmt.Sprint(len(data))
 	trace.DEBUG(fields, "File written")
 
-	return len(data)
+	return len(data), nil
 }
 
-func (fsr *FileSys) WriteFileAt(trace *sl.Trace, name string, offset int64, v any) (writedBytes int) {
+func (fsr *FileSys) WriteFileAt(trace *sl.Trace, name string, offset int64, v any) (writedBytes int, err error) {
 	defer trace.AddModule("_FileSys", "WriteFileAt")()
 	fields := sl.WithFields("name", name, "offset", offset)
 
@@ -96,52 +119,53 @@ func (fsr *FileSys) WriteFileAt(trace *sl.Trace, name string, offset int64, v an
 	}
 
 	dir := filepath.Dir(name)
-	err = os.MkdirAll(dir, 0755)
+	err = makeDirAll(dir)
 
 	if err != nil {
-		trace.FATAL(fields, "Make dir error: ", err.Error())
+		return 0, fsr.writeErr(trace, fields, err, "Make dir error: ")
 	}
 
 	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
 
 	if err != nil {
-		trace.FATAL(fields, "Open file error: ", err.Error())
+		return 0, fsr.writeErr(trace, fields, err, "Open file error: ")
 	}
 	defer file.Close()
 
 	_, err = file.Seek(offset, io.SeekStart)
 
 	if err != nil {
-		trace.FATAL(fields, "Set offset on file error: ", err.Error())
+		return 0, fsr.writeErr(trace, fields, err, "Set offset on file error: ")
 	}
 
 	writedBytes, err = file.Write(data)
 
 	if err != nil {
-		trace.FATAL(fields, "Write to file error: ", err.Error())
+		return writedBytes, fsr.writeErr(trace, fields, err, "Write to file error: ")
 	}
+	markDirty(name)
 
 	fields["bytes"] = fmt.Sprint(writedBytes)
 	trace.DEBUG(fields, "File written")
 
-	return writedBytes
+	return writedBytes, nil
 }
 
-func (fsr *FileSys) AppendFile(trace *sl.Trace, name string, v any) (writedBytes int) {
+func (fsr *FileSys) AppendFile(trace *sl.Trace, name string, v any) (writedBytes int, err error) {
 	defer trace.AddModule("_FileSys", "AppendFile")()
 	fields := sl.Fields{"name": name}
 
 	dir := filepath.Dir(name)
-	err := os.MkdirAll(dir, 0755)
+	err = makeDirAll(dir)
 
 	if err != nil {
-		trace.FATAL(fields, "Make dir error: ", err.Error())
+		return 0, fsr.writeErr(trace, fields, err, "Make dir error: ")
 	}
 
 	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 
 	if err != nil {
-		trace.FATAL(fields, "Open file error: ", err.Error())
+		return 0, fsr.writeErr(trace, fields, err, "Open file error: ")
 	}
 	defer file.Close()
 
@@ -154,18 +178,19 @@ func (fsr *FileSys) AppendFile(trace *sl.Trace, name string, v any) (writedBytes
 	writedBytes, err = file.Write(data)
 
 	if err != nil {
-		trace.FATAL(fields, "Write to file error: ", err.Error())
+		return writedBytes, fsr.writeErr(trace, fields, err, "Write to file error: ")
 	}
+	markDirty(name)
 
 	fields["bytes"] = fmt.Sprint(len(data))
 	trace.DEBUG(fields, "Appended to file")
 
-	return writedBytes
+	return writedBytes, nil
 }
 
 // Read
 
-func (fsr *FileSys) ReadFile(trace *sl.Trace, name string) []byte {
+func (fsr *FileSys) ReadFile(trace *sl.Trace, name string) ([]byte, error) {
 	defer trace.AddModule("_FileSys", "ReadFile")()
 	fields := sl.Fields{"name": name}
 
@@ -173,72 +198,82 @@ func (fsr *FileSys) ReadFile(trace *sl.Trace, name string) []byte {
 	err := os.MkdirAll(dir, 0755)
 
 	if err != nil {
-		trace.FATAL(fields, "Make dir error: ", err.Error())
+		trace.ERROR(fields, "Make dir error: ", err.Error())
+		return nil, err
 	}
 
 	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDONLY, 0644)
 
 	if err != nil {
-		trace.FATAL(fields, "Open file error: ", err.Error())
+		trace.ERROR(fields, "Open file error: ", err.Error())
+		return nil, err
 	}
 	defer file.Close()
 
 	info, err := file.Stat()
 
 	if err != nil {
-		trace.FATAL(fields, "Get stats from file error: ", err.Error())
+		trace.ERROR(fields, "Get stats from file error: ", err.Error())
+		return nil, err
 	}
 
 	buff := make([]byte, info.Size())
 	_, err = file.Read(buff)
 
 	if err != nil {
-		trace.FATAL(fields, "Read file error: ", err.Error())
+		trace.ERROR(fields, "Read file error: ", err.Error())
+		return nil, err
 	}
 
 	fields["bytes"] = fmt.Sprint(len(buff))
 	trace.DEBUG(fields, "File readed")
 
-	return buff
+	return buff, nil
 }
 
-func (fsr *FileSys) ReadFileTo(trace *sl.Trace, name string, v any) (readedBytes int) {
+func (fsr *FileSys) ReadFileTo(trace *sl.Trace, name string, v any) (readedBytes int, err error) {
 	defer trace.AddModule("_FileSys", "ReadFileTo")()
 
-	data := fsr.ReadFile(trace, name)
+	data, err := fsr.ReadFile(trace, name)
+
+	if err != nil {
+		return 0, err
+	}
 
 	if len(data) == 0 {
-		trace.FATAL(sl.Fields{"name": name}, "File empty")
+		trace.ERROR(sl.Fields{"name": name}, "File empty")
+		return 0, errors.New(fmt.Sprint("File '", name, "' is empty"))
 	}
 
-	err := msgpack.Unmarshal(data, v)
+	err = msgpack.Unmarshal(data, v)
 
 	if err != nil {
-		trace.FATAL(sl.Fields{"name": name}, "Convert from bytes error: ", err.Error())
+		trace.ERROR(sl.Fields{"name": name}, "Convert from bytes error: ", err.Error())
+		return 0, err
 	}
-	return len(data)
+	return len(data), nil
 }
 
-func (fsr *FileSys) Exists(trace *sl.Trace, name string) bool {
+func (fsr *FileSys) Exists(trace *sl.Trace, name string) (bool, error) {
 	defer trace.AddModule("_FileSys", "Exists")()
 
 	_, err := os.Stat(name)
 
 	if err == nil {
-		return true
+		return true, nil
 	}
 
 	if os.IsNotExist(err) {
-		return false
+		return false, nil
 	}
 
-	trace.FATAL(sl.Fields{"name": name}, "Get stats from file error", err.Error())
-	return false
+	trace.ERROR(sl.Fields{"name": name}, "Get stats from file error: ", err.Error())
+	return false, err
 }
 
 // Remove
 
-func (fsr *FileSys) AtomicRemove(trace *sl.Trace, names ...string) {
+func (fsr *FileSys) AtomicRemove(trace *sl.Trace, names ...string) error {
 	defer trace.AddModule("_FileSys", "AtomicRemove")()
 
 	tx := NewTransaction(trace, "rm_"+uuid.New().String())
@@ -246,47 +281,152 @@ func (fsr *FileSys) AtomicRemove(trace *sl.Trace, names ...string) {
 	for i := range names {
 		tx.Add(RemoveAction(names[i]))
 	}
-	tx.Commit()
-	tx.Apply()
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return tx.Apply()
 }
 
-func (fsr *FileSys) Remove(trace *sl.Trace, name string) bool {
+func (fsr *FileSys) Remove(trace *sl.Trace, name string) (bool, error) {
 	defer trace.AddModule("_FileSys", "Remove")()
 
 	err := os.Remove(name)
 
 	if err == nil {
-		return true
+		return true, nil
 	}
 	if os.IsNotExist(err) {
-		return false
+		return false, nil
 	}
 
-	trace.FATAL(sl.Fields{"name": name}, "Remove file error: ", err.Error())
-	return false
+	trace.ERROR(sl.Fields{"name": name}, "Remove file error: ", err.Error())
+	return false, err
 }
 
 // Dirs
 
-func (fsr *FileSys) MakeDirAll(trace *sl.Trace, dirPath ...string) {
+func (fsr *FileSys) MakeDirAll(trace *sl.Trace, dirPath ...string) error {
 	defer trace.AddModule("_FileSys", "MakeDirAll")()
 
 	dir := path.Join(dirPath...)
-	err := os.MkdirAll(dir, 0755)
+	err := makeDirAll(dir)
 	fields := sl.Fields{"dir": dir}
 
 	if err != nil {
-		trace.FATAL(fields, "Make dir error: ", err.Error())
+		return fsr.writeErr(trace, fields, err, "Make dir error: ")
 	}
 
 	trace.DEBUG(fields, "Dir maked")
+	return nil
+}
+
+// Storages
+
+// MakeStorageDir makes dir of storage. If data dir is not data root,
+// storage dir is made in it and linked to storages dir of data root
+func (fsr *FileSys) MakeStorageDir(trace *sl.Trace, storage string, dataDir string) error {
+	defer trace.AddModule("_FileSys", "MakeStorageDir")()
+
+	name := path.Join(m.DIR_STORAGES, storage)
+
+	if dataDir == "" {
+		return fsr.MakeDirAll(trace, name)
+	}
+
+	target := filepath.Join(dataDir, m.DIR_STORAGES, storage)
+
+	if err := fsr.MakeDirAll(trace, target); err != nil {
+		return err
+	}
+
+	if err := fsr.MakeDirAll(trace, m.DIR_STORAGES); err != nil {
+		return err
+	}
+
+	err := os.Symlink(target, name)
+
+	if err != nil && !os.IsExist(err) {
+		return fsr.writeErr(trace, sl.Fields{"name": name}, err, "Make symlink to '", target, "' error: ")
+	}
+	markDirtyDirs(m.DIR_STORAGES)
+
+	trace.DEBUG(sl.Fields{"name": name}, "Storage dir linked to: ", target)
+	return nil
+}
+
+// FreeSpace returns free bytes on disk of dir. Empty dir is data root
+func (fsr *FileSys) FreeSpace(trace *sl.Trace, dir string) (uint64, error) {
+	defer trace.AddModule("_FileSys", "FreeSpace")()
+
+	if dir == "" {
+		dir = "."
+	}
+
+	free, err := freeSpace(dir)
+
+	if err != nil {
+		trace.WARN(nil, "Get free space of '", dir, "' error: ", err.Error())
+		return 0, err
+	}
+	return free, nil
+}
+
+// PickDataDir returns data dir with the most free space. Empty dir is data root
+func (fsr *FileSys) PickDataDir(trace *sl.Trace, dataDirs []string) string {
+	defer trace.AddModule("_FileSys", "PickDataDir")()
+
+	picked, found := "", false
+	var maxFree uint64
+
+	for _, dir := range dataDirs {
+		free, err := fsr.FreeSpace(trace, dir)
+
+		if err != nil {
+			continue
+		}
+
+		if !found || free > maxFree {
+			picked, maxFree, found = dir, free, true
+		}
+	}
+
+	trace.DEBUG(nil, "Picked data dir '", picked, "' with ", maxFree, " free bytes")
+	return picked
+}
+
+// isStorageDir checks dir entry, which may be symlink to storage in other data dir.
+// Symlink is never removed here: interrupted removing of storage is finished by transactions,
+// so missing target means data dir is not available (e.g. disk is not mounted)
+func (fsr *FileSys) isStorageDir(trace *sl.Trace, entry os.DirEntry) bool {
+	if entry.IsDir() {
+		return true
+	}
+
+	if entry.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+
+	name := path.Join(m.DIR_STORAGES, entry.Name())
+	info, err := os.Stat(name)
+
+	if os.IsNotExist(err) {
+		target, _ := os.Readlink(name)
+		trace.FATAL(sl.Fields{"name": name}, "Storage '", entry.Name(), "' is not found in data dir '", target,
+			"', mount data dir or remove symlink: ", err.Error())
+	}
+
+	if err != nil {
+		trace.FATAL(sl.Fields{"name": name}, "Get stats from file error: ", err.Error())
+	}
+	return info.IsDir()
 }
 
 func (fsr *FileSys) ReadAndSendDeleteQueries(trace *sl.Trace, queue chan<- *m.DeleteQuery) {
 	defer trace.AddModule("_FileSys", "ReadAndSendDeleteQueries")()
 
 	dir := m.DIR_DELETE_TASKS
-	err := os.MkdirAll(dir, 0755)
+	err := makeDirAll(dir)
 
 	if err != nil {
 		trace.FATAL(nil, "Creating dir '", dir, "' error: ", err.Error())
@@ -315,7 +455,11 @@ func (fsr *FileSys) ReadAndSendDeleteQueries(trace *sl.Trace, queue chan<- *m.De
 				ErrCh:  make(chan error, 1),
 				Trace:  trace,
 			}
-			fsr.ReadFileTo(trace, name, query)
+			_, err = fsr.ReadFileTo(trace, name, query)
+
+			if err != nil {
+				trace.FATAL(sl.Fields{"name": name}, "Read delete task error: ", err.Error())
+			}
 			queue <- query
 		}
 	}
@@ -323,31 +467,170 @@ func (fsr *FileSys) ReadAndSendDeleteQueries(trace *sl.Trace, queue chan<- *m.De
 	trace.DEBUG(nil, "Delete queries readed and sent")
 }
 
-func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Meta, bool) {
-	defer trace.AddModule("_FileSys", "filterAndReadMetas")()
+// ReadImports reads saved imports of dump files of sherlog
+func (fsr *FileSys) ReadImports(trace *sl.Trace) []*m.Import {
+	defer trace.AddModule("_FileSys", "ReadImports")()
 
-	storagePath := path.Join(m.DIR_STORAGES, storage)
-	entries, err := os.ReadDir(storagePath)
+	dir := m.DIR_IMPORTS
+	err := makeDirAll(dir)
 
 	if err != nil {
-		trace.FATAL(nil, "Make dir '", m.DIR_STORAGES, "/'", storage, "' error: ", err.Error())
+		trace.FATAL(nil, "Creating dir '", dir, "' error: ", err.Error())
 	}
 
-	metas := make([]*m.Meta, 0, len(entries))
+	entries, err := os.ReadDir(dir)
 
-	// Find chunks from storage
+	if err != nil {
+		trace.FATAL(nil, "Reading dir '", dir, "' error: ", err.Error())
+	}
+
+	imports := []*m.Import{}
 
 	for i := range entries {
-		if !entries[i].IsDir() {
-			if entries[i].Name() == "_deleted_" {
-				fsr.AtomicRemove(trace, storagePath)
-				trace.DEBUG(nil, "Storage '", storage, "' removed")
-				return nil, false
+		name := path.Join(dir, entries[i].Name())
+
+		if strings.HasSuffix(name, ".new") {
+			err = os.Remove(name)
+
+			if err != nil {
+				trace.FATAL(nil, "Remove file '", name, "' error: ", err.Error())
 			}
 			continue
 		}
 
+		imp := &m.Import{}
+		_, err = fsr.ReadFileTo(trace, name, imp)
+
+		if err != nil {
+			trace.FATAL(sl.Fields{"name": name}, "Read import error: ", err.Error())
+		}
+		imports = append(imports, imp)
+	}
+
+	trace.DEBUG(nil, len(imports), " imports readed")
+	return imports
+}
+
+// readManifest returns nil if manifest is missing or inconsistent
+func (fsr *FileSys) readManifest(trace *sl.Trace, storagePath string) *m.Manifest {
+	defer trace.AddModule("_FileSys", "readManifest")()
+
+	name := path.Join(storagePath, m.FILE_MANIFEST)
+
+	if ok, _ := fsr.Exists(trace, name); !ok {
+		trace.DEBUG(nil, "Manifest not found: ", name)
+		return nil
+	}
+
+	data, err := fsr.ReadFile(trace, name)
+
+	if err != nil {
+		trace.WARN(sl.Fields{"name": name}, "Manifest is not readed, chunks will be scanned")
+		return nil
+	}
+
+	manifest := m.NewManifest()
+	err = msgpack.Unmarshal(data, manifest)
+
+	if err != nil || manifest.Chunks == nil {
+		trace.WARN(sl.Fields{"name": name}, "Manifest is inconsistent, chunks will be scanned")
+		return nil
+	}
+
+	for chunk, meta := range manifest.Chunks {
+		if meta == nil {
+			trace.WARN(sl.Fields{"name": name, "chunk": chunk}, "Manifest is inconsistent, chunks will be scanned")
+			return nil
+		}
+	}
+	return manifest
+}
+
+// listChunks returns names of chunk dirs of storage
+func (fsr *FileSys) listChunks(trace *sl.Trace, storagePath string) []string {
+	entries, err := os.ReadDir(storagePath)
+
+	if err != nil {
+		trace.FATAL(nil, "Read dir '", storagePath, "' error: ", err.Error())
+	}
+
+	names := make([]string, 0, len(entries))
+
+	for i := range entries {
+		if entries[i].IsDir() {
+			names = append(names, entries[i].Name())
+		}
+	}
+	return names
+}
+
+// ReadBatches returns saved batch IDs from batches files of writers
+func (fsr *FileSys) ReadBatches(trace *sl.Trace, storage string) []string {
+	defer trace.AddModule("_FileSys", "ReadBatches")()
+
+	storagePath := path.Join(m.DIR_STORAGES, storage)
+	entries, err := os.ReadDir(storagePath)
+
+	if err != nil {
+		trace.FATAL(nil, "Read dir '", storagePath, "' error: ", err.Error())
+	}
+
+	ids := []string{}
+
+	for i := range entries {
 		name := entries[i].Name()
+
+		if entries[i].IsDir() || !strings.HasPrefix(name, m.FILE_BATCHES) || strings.HasSuffix(name, ".new") {
+			continue
+		}
+
+		data, err := fsr.ReadFile(trace, path.Join(storagePath, name))
+
+		if err != nil {
+			trace.FATAL(sl.Fields{"name": name}, "Read batches file error: ", err.Error())
+		}
+
+		for _, id := range strings.Split(string(data), "\n") {
+			if id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Meta, bool) {
+	defer trace.AddModule("_FileSys", "filterAndReadMetas")()
+
+	storagePath := path.Join(m.DIR_STORAGES, storage)
+
+	if ok, _ := fsr.Exists(trace, path.Join(storagePath, "_deleted_")); ok {
+		if err := fsr.AtomicRemove(trace, storagePath); err != nil {
+			trace.FATAL(nil, "Remove storage '", storage, "' error: ", err.Error())
+		}
+		trace.DEBUG(nil, "Storage '", storage, "' removed")
+		return nil, false
+	}
+
+	// Find chunks of storage. Manifest has all chunks, so dir is scanned only without it
+
+	manifest := fsr.readManifest(trace, storagePath)
+	forRemove := []string{}
+	var names []string
+
+	if manifest != nil {
+		names = tools.KeysToSlice(manifest.Chunks)
+
+		for _, name := range manifest.ForRemove {
+			forRemove = append(forRemove, path.Join(storagePath, name))
+		}
+	} else {
+		names = fsr.listChunks(trace, storagePath)
+	}
+
+	metas := make([]*m.Meta, 0, len(names))
+
+	for _, name := range names {
 		meta, err := m.NewMetaEmpty(name)
 
 		if err == nil {
@@ -355,10 +638,6 @@ func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Me
 		}
 	}
 
-	if len(metas) == 0 {
-		return []*m.Meta{}, true
-	}
-
 	// Sort metas by ID and Version
 
 	sort.Slice(metas, func(i, j int) bool {
@@ -370,9 +649,8 @@ func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Me
 
 	// Read and filter metas
 
-	forRemove := []string{}
 	var currID uint64
-	j := 0
+	j, fromManifest := 0, 0
 
 	for _, meta := range metas {
 		chunkPath := path.Join(storagePath, meta.Name())
@@ -383,8 +661,34 @@ func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Me
 			continue
 		}
 
+		// Full chunks are not changed in place, except marking as deleted, which removes manifest.
+		// Raw chunks are changed in place, so their metas are readed from disk
+		if manifest != nil {
+			known := manifest.Chunks[meta.Name()]
+
+			if known.IsDeleted {
+				forRemove = append(forRemove, chunkPath)
+				continue
+			}
+
+			if known.Offsets == nil {
+				meta.TimeRange = known.TimeRange
+				meta.LogsLen = known.LogsLen
+
+				metas[j] = meta
+				currID = meta.ID
+				j++
+				fromManifest++
+				continue
+			}
+		}
+
 		metaPath := path.Join(chunkPath, "meta")
-		data := fsr.ReadFile(trace, metaPath)
+		data, err := fsr.ReadFile(trace, metaPath)
+
+		if err != nil {
+			trace.FATAL(sl.Fields{"name": metaPath}, "Read meta error: ", err.Error())
+		}
 
 		// Delete chunk if it is corrupted (meta-file not found/empty)
 		if len(data) == 0 {
@@ -392,7 +696,7 @@ func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Me
 			continue
 		}
 
-		err := msgpack.Unmarshal(data, meta)
+		err = msgpack.Unmarshal(data, meta)
 
 		if err != nil {
 			trace.FATAL(sl.Fields{"name": metaPath}, "Convert from bytes error: ", err.Error())
@@ -412,17 +716,19 @@ func (fsr *FileSys) filterAndReadMetas(trace *sl.Trace, storage string) ([]*m.Me
 	// remove chunks
 
 	if len(forRemove) > 0 {
-		fsr.AtomicRemove(trace, forRemove...)
+		if err := fsr.AtomicRemove(trace, forRemove...); err != nil {
+			trace.FATAL(nil, "Remove chunks of storage '", storage, "' error: ", err.Error())
+		}
 	}
 
-	trace.DEBUG(nil, "Readed ", len(metas), " chunks from storage ", storage)
+	trace.DEBUG(nil, "Readed ", len(metas), " chunks from storage ", storage, " (", fromManifest, " from manifest)")
 	return metas[:j], true
 }
 
 func (fsr *FileSys) ReadAndClearStorages(trace *sl.Trace) (metasMap map[string][]*m.Meta, firstRawChunks map[string]uint64) {
 	defer trace.AddModule("_FileSys", "ReadAndClearStorages")()
 
-	err := os.MkdirAll(m.DIR_STORAGES, 0755)
+	err := makeDirAll(m.DIR_STORAGES)
 
 	if err != nil {
 		trace.FATAL(nil, "Make dir '", m.DIR_STORAGES, "' error: ", err.Error())
@@ -438,7 +744,7 @@ func (fsr *FileSys) ReadAndClearStorages(trace *sl.Trace) (metasMap map[string][
 	firstRawChunks = map[string]uint64{}
 
 	for i := range entries {
-		if !entries[i].IsDir() {
+		if !fsr.isStorageDir(trace, entries[i]) {
 			continue
 		}
 		storage := entries[i].Name()
@@ -469,3 +775,47 @@ func (fsr *FileSys) ReadAndClearStorages(trace *sl.Trace) (metasMap map[string][
 	trace.DEBUG(nil, "Storages readed and cleared")
 	return metasMap, firstRawChunks
 }
+
+// ReadPipelines reads saved pipelines of storages
+func (fsr *FileSys) ReadPipelines(trace *sl.Trace) []*m.Pipeline {
+	defer trace.AddModule("_FileSys", "ReadPipelines")()
+
+	dir := m.DIR_PIPELINES
+	err := makeDirAll(dir)
+
+	if err != nil {
+		trace.FATAL(nil, "Creating dir '", dir, "' error: ", err.Error())
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		trace.FATAL(nil, "Reading dir '", dir, "' error: ", err.Error())
+	}
+
+	pipelines := []*m.Pipeline{}
+
+	for i := range entries {
+		name := path.Join(dir, entries[i].Name())
+
+		if strings.HasSuffix(name, ".new") {
+			err = os.Remove(name)
+
+			if err != nil {
+				trace.FATAL(nil, "Remove file '", name, "' error: ", err.Error())
+			}
+			continue
+		}
+
+		pipeline := &m.Pipeline{}
+		_, err = fsr.ReadFileTo(trace, name, pipeline)
+
+		if err != nil {
+			trace.FATAL(sl.Fields{"name": name}, "Read pipeline error: ", err.Error())
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+
+	trace.DEBUG(nil, len(pipelines), " pipelines readed")
+	return pipelines
+}
@@ -0,0 +1,318 @@
+package file_sys
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/stretchr/testify/assert"
+
+	aerr "main/app_errors"
+	m "main/models"
+	tt "main/test_tools"
+)
+
+func TestReadStoragesWithManifest(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+	fileSys := &FileSys{}
+
+	wd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	storagePath := path.Join(m.DIR_STORAGES, "storage")
+
+	// Manifest has all chunks: full chunk 1 is taken from manifest (its meta is not readed),
+	// metas of raw chunk 2 are readed from meta file, deleted chunk 3 and old version 4_1 are removed.
+	// Chunk 5 is not in manifest, so it is not found (dir is not scanned)
+
+	os.MkdirAll(path.Join(storagePath, "1_1"), 0755)
+
+	raw := &m.Meta{TimeRange: m.TimeRange{Start: 5, End: 6}, LogsLen: 1, Offsets: &m.Offsets{Timestamp: 10}}
+	fileSys.WriteFile(trace, path.Join(storagePath, "2_1", "meta"), false, raw)
+
+	os.MkdirAll(path.Join(storagePath, "3_1"), 0755)
+	os.MkdirAll(path.Join(storagePath, "4_1"), 0755)
+
+	full := &m.Meta{TimeRange: m.TimeRange{Start: 7, End: 9}, LogsLen: 3}
+	fileSys.WriteFile(trace, path.Join(storagePath, "5_1", "meta"), false, full)
+
+	manifest := m.NewManifest()
+	manifest.Chunks["1_1"] = &m.Meta{TimeRange: m.TimeRange{Start: 1, End: 4}, LogsLen: 3}
+	manifest.Chunks["2_1"] = &m.Meta{TimeRange: m.TimeRange{Start: 5, End: 5}, Offsets: &m.Offsets{Timestamp: 5}}
+	manifest.Chunks["3_1"] = &m.Meta{TimeRange: m.TimeRange{Start: 7, End: 8}, LogsLen: 3, IsDeleted: true}
+	manifest.ForRemove = []string{"4_1"}
+	fileSys.WriteFile(trace, path.Join(storagePath, m.FILE_MANIFEST), true, manifest)
+
+	metasMap, firstRawChunks := fileSys.ReadAndClearStorages(trace)
+	metas := metasMap["storage"]
+
+	if !assert.Len(t, metas, 2, "chunks") {
+		return
+	}
+
+	assert.Equal(t, "1_1", metas[0].Name())
+	assert.Equal(t, m.TimeRange{Start: 1, End: 4}, metas[0].TimeRange, "from manifest")
+
+	assert.Equal(t, "2_1", metas[1].Name())
+	assert.Equal(t, 1, metas[1].LogsLen, "raw chunk from meta file")
+
+	assert.Equal(t, uint64(2), firstRawChunks["storage"])
+	assert.NoDirExists(t, path.Join(storagePath, "3_1"), "deleted chunk removed")
+	assert.NoDirExists(t, path.Join(storagePath, "4_1"), "old version removed")
+
+	// Inconsistent manifest, so dir is scanned: chunk 1 is removed as corrupted, chunk 5 is found
+
+	fileSys.WriteFile(trace, path.Join(storagePath, m.FILE_MANIFEST), true, []byte("bad"))
+
+	metasMap, _ = fileSys.ReadAndClearStorages(trace)
+	metas = metasMap["storage"]
+
+	if assert.Len(t, metas, 2, "chunks after scan") {
+		assert.Equal(t, "5_1", metas[1].Name())
+	}
+}
+
+func TestStorageInDataDir(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+	fileSys := &FileSys{}
+
+	wd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	dataDir := t.TempDir()
+
+	fileSys.MakeStorageDir(trace, "storage", dataDir)
+	target := path.Join(dataDir, m.DIR_STORAGES, "storage")
+
+	assert.DirExists(t, target, "storage made in data dir")
+
+	metasMap, _ := fileSys.ReadAndClearStorages(trace)
+	_, ok := metasMap["storage"]
+	assert.True(t, ok, "linked storage readed")
+
+	// Removing of deleted storage removes also its dir in data dir
+
+	fileSys.WriteFile(trace, path.Join(m.DIR_STORAGES, "storage", "_deleted_"), false, "")
+
+	metasMap, _ = fileSys.ReadAndClearStorages(trace)
+	_, ok = metasMap["storage"]
+	assert.False(t, ok, "deleted storage")
+	assert.NoDirExists(t, target, "storage removed from data dir")
+	assert.NoFileExists(t, path.Join(m.DIR_STORAGES, "storage"), "symlink removed")
+}
+
+func TestLock(t *testing.T) {
+	name := path.Join(t.TempDir(), m.FILE_LOCK)
+
+	file, err := tryLock(name)
+
+	if !assert.NoError(t, err, "first lock") {
+		return
+	}
+
+	_, err = tryLock(name)
+	assert.Equal(t, errLocked, err, "second lock")
+
+	unlock(file)
+
+	file, err = tryLock(name)
+	assert.NoError(t, err, "lock after unlock")
+	unlock(file)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+	fileSys := &FileSys{}
+
+	// Parent of the file is a file, so writing fails, but only for this file
+	parent := path.Join(t.TempDir(), "file")
+	os.WriteFile(parent, []byte{}, 0644)
+
+	_, err := fileSys.WriteFile(trace, path.Join(parent, "name"), false, []byte("abc"))
+
+	if !assert.Error(t, err, "write error") {
+		return
+	}
+	assert.IsType(t, &fs.PathError{}, err, "error of file")
+	assert.NoError(t, ReadOnlyErr(), "read-only mode is off")
+
+	// Error of disk
+
+	err = fileSys.writeErr(trace, nil, &fs.PathError{Op: "write", Path: "name", Err: syscall.ENOSPC}, "Write error: ")
+
+	if assert.IsType(t, &aerr.AppErr{}, err, "error of disk") {
+		assert.Equal(t, aerr.InsufficientStorage, err.(*aerr.AppErr).Type())
+	}
+	assert.Error(t, ReadOnlyErr(), "read-only mode is on")
+
+	reason, _ := ReadOnlyStatus()
+	assert.NotEmpty(t, reason, "reason")
+
+	assert.True(t, fileSys.ProbeWrite(trace), "probe")
+	assert.NoError(t, ReadOnlyErr(), "read-only mode is off")
+	assert.NoFileExists(t, m.FILE_PROBE, "probe file removed")
+}
+
+func TestSync(t *testing.T) {
+	tt.SherlogInit()
+	fileSys := &FileSys{}
+
+	dir := t.TempDir()
+	defer SetDurability(m.DURABILITY_NONE, 0)
+
+	for _, mode := range []string{m.DURABILITY_FSYNC, m.DURABILITY_GROUP} {
+		SetDurability(mode, time.Millisecond*5)
+
+		wg := sync.WaitGroup{}
+		errs := make([]error, 5)
+
+		for i := range errs {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				// Trace is not shared between goroutines
+				trace := sl.NewTrace(fmt.Sprint("Main_", i))
+				defer trace.Close()
+
+				name := path.Join(dir, mode, fmt.Sprint(i))
+				_, errs[i] = fileSys.AppendFile(trace, name, []byte("abc"))
+
+				if errs[i] == nil {
+					errs[i] = fileSys.Sync(trace)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range errs {
+			assert.NoError(t, errs[i], mode)
+		}
+		assert.Empty(t, _syncer.files, mode, ": all files synced")
+		assert.Empty(t, _syncer.waiters, mode, ": no waiters")
+	}
+}
+
+func TestSyncOfWrite(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+	fileSys := &FileSys{}
+
+	wd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+	defer SetDurability(m.DURABILITY_NONE, 0)
+
+	// Made dirs and parent of the first one are dirty
+
+	SetDurability(m.DURABILITY_FSYNC, 0)
+	assert.NoError(t, fileSys.MakeDirAll(trace, "storage"))
+	assert.NoError(t, fileSys.Sync(trace))
+
+	_, err := fileSys.AppendFile(trace, path.Join("storage", "chunk", "column"), []byte("abc"))
+	assert.NoError(t, err)
+
+	for _, dir := range []string{"storage", path.Join("storage", "chunk")} {
+		assert.True(t, _syncer.dirs[dir], dir, " is dirty")
+	}
+	assert.NoError(t, fileSys.Sync(trace))
+
+	// Group commit is waited once per write
+
+	period := time.Millisecond * 100
+	SetDurability(m.DURABILITY_GROUP, period)
+
+	start := time.Now()
+	name := path.Join("storage", "chunk", "meta")
+	backuper := NewBackuper(trace, "storage_1")
+	backuper.AddForCut(path.Join("storage", "chunk", "column"))
+	backuper.AddForReplace(name + ".new")
+
+	if !assert.NoError(t, backuper.Commit()) {
+		return
+	}
+	_, err = fileSys.WriteFile(trace, name+".new", false, []byte("meta"))
+
+	assert.NoError(t, backuper.BackupIfErr(err))
+	assert.Less(t, time.Since(start), period*2, "one group commit")
+	assert.FileExists(t, name, "changes accepted")
+}
+
+func TestWAL(t *testing.T) {
+	tt.SherlogInit()
+	trace := sl.NewTrace("Main")
+
+	wd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	wal, entries := OpenWAL(trace)
+	assert.Empty(t, entries, "new WAL")
+
+	batchIDs := []string{}
+
+	for i := 1; i <= 3; i++ {
+		logs := []*m.Log{{Timestamp: int64(i), Message: fmt.Sprint("log ", i)}}
+		entry, err := wal.Append(trace, &m.Logs{Storage: "storage", Logs: logs})
+
+		if assert.NoError(t, err) {
+			assert.True(t, strings.HasPrefix(entry.BatchID, "wal:"), "implicit batch ID")
+			batchIDs = append(batchIDs, entry.BatchID)
+		}
+	}
+	wal.Done(trace, 1)
+	assert.Equal(t, 2, wal.Pending())
+	wal.Close(trace)
+
+	// Torn record at the end (crash while writing) is ignored
+
+	dirEntries, _ := os.ReadDir(m.DIR_WAL)
+	last := path.Join(m.DIR_WAL, dirEntries[len(dirEntries)-1].Name())
+	file, _ := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write([]byte{100, 0, 0, 0, 1, 2})
+	file.Close()
+
+	// Not applied entries are replayed
+
+	wal, entries = OpenWAL(trace)
+
+	if assert.Len(t, entries, 2, "replayed entries") {
+		assert.Equal(t, uint64(2), entries[0].Seq)
+		assert.Equal(t, "storage", entries[0].Storage)
+		assert.Equal(t, "log 2", entries[0].Logs[0].Message)
+		assert.Equal(t, batchIDs[1], entries[0].BatchID, "replayed with the same batch ID")
+		assert.Equal(t, uint64(3), entries[1].Seq)
+	}
+
+	entry, err := wal.Append(trace, &m.Logs{Storage: "storage", BatchID: "b4", Logs: []*m.Log{{Timestamp: 4}}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), entry.Seq, "numbering continues")
+	assert.Equal(t, "b4", entry.BatchID)
+
+	// Fully applied segments are removed
+
+	wal.Done(trace, 2)
+	wal.Done(trace, 3)
+	wal.Done(trace, 4)
+	wal.Close(trace)
+
+	dirEntries, _ = os.ReadDir(m.DIR_WAL)
+	assert.Len(t, dirEntries, 1, "only current segment")
+
+	wal, entries = OpenWAL(trace)
+	assert.Empty(t, entries, "all applied")
+	wal.Close(trace)
+}
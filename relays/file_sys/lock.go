@@ -0,0 +1,63 @@
+package file_sys
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	m "main/models"
+)
+
+var errLocked = errors.New("file is locked")
+
+// DirLock is an exclusive lock of data root, so only one process works with data
+type DirLock struct {
+	file  *os.File
+	trace *sl.Trace
+}
+
+// LockDataDir takes lock of data root or stops the process, if lock is held by other process
+func LockDataDir(trace *sl.Trace) *DirLock {
+	defer trace.AddModule("", "LockDataDir")()
+
+	file, err := tryLock(m.FILE_LOCK)
+
+	if err == errLocked {
+		data, _ := os.ReadFile(m.FILE_LOCK)
+		pid := strings.TrimSpace(string(data))
+		trace.FATAL(nil, "Data dir is locked by other process. PID: ", pid)
+	}
+
+	if err != nil {
+		trace.FATAL(nil, "Lock file '", m.FILE_LOCK, "' error: ", err.Error())
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	err = file.Truncate(0)
+
+	if err == nil {
+		_, err = file.WriteAt([]byte(pid), 0)
+	}
+
+	if err != nil {
+		trace.FATAL(nil, "Write PID to lock file error: ", err.Error())
+	}
+
+	trace.DEBUG(nil, "Data dir locked. PID: ", pid)
+	return &DirLock{file: file, trace: trace}
+}
+
+func (l *DirLock) Unlock() {
+	defer l.trace.AddModule("_DirLock", "Unlock")()
+
+	err := unlock(l.file)
+
+	if err != nil {
+		l.trace.ERROR(nil, "Unlock data dir error: ", err.Error())
+		return
+	}
+	l.trace.DEBUG(nil, "Data dir unlocked")
+}
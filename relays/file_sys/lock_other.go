@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || freebsd)
+
+package file_sys
+
+import "os"
+
+// tryLock creates lock file exclusively. Lock file stays after crash, so it must be removed manually
+func tryLock(name string) (*os.File, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+
+	if os.IsExist(err) {
+		return nil, errLocked
+	}
+	return file, err
+}
+
+func unlock(file *os.File) error {
+	file.Close()
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,35 @@
+//go:build linux || darwin || freebsd
+
+package file_sys
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock opens file and takes exclusive lock on it, which is released by OS when process exits
+func tryLock(name string) (*os.File, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+
+	if err != nil {
+		file.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// unlock keeps lock file, because other process may already wait for lock on it
+func unlock(file *os.File) error {
+	return file.Close()
+}
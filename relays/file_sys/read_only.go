@@ -0,0 +1,114 @@
+package file_sys
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+const _PROBE_SIZE = 1 << 20
+
+// Read-only mode is switched on by write errors of disk (it is full, failed or read-only).
+// Writes are rejected until a probe write is succeeded, reads keep working
+var _readOnly struct {
+	reason string
+	since  time.Time
+	mx     sync.RWMutex
+}
+
+// Low space mode is switched on by disk watcher, when free space is below hard limit.
+// Writing of logs is rejected, deleting is allowed, because it frees space
+var _lowSpace atomic.Bool
+
+// setReadOnly switches on read-only mode and returns error for client
+func setReadOnly(trace *sl.Trace, err error) error {
+	_readOnly.mx.Lock()
+
+	if _readOnly.reason == "" {
+		_readOnly.reason = err.Error()
+		_readOnly.since = time.Now()
+		trace.ERROR(nil, "Read-only mode is on: ", err.Error())
+	}
+	_readOnly.mx.Unlock()
+
+	return aerr.NewAppErr(aerr.InsufficientStorage, "Writing to disk failed, server is read-only")
+}
+
+// ReadOnlyErr returns error if server is in read-only mode
+func ReadOnlyErr() error {
+	_readOnly.mx.RLock()
+	defer _readOnly.mx.RUnlock()
+
+	if _readOnly.reason == "" {
+		return nil
+	}
+	return aerr.NewAppErr(aerr.InsufficientStorage, "Server is read-only: ", _readOnly.reason)
+}
+
+// IngestErr returns error if writing of logs must be rejected
+func IngestErr() error {
+	if err := ReadOnlyErr(); err != nil {
+		return err
+	}
+
+	if _lowSpace.Load() {
+		return aerr.NewAppErr(aerr.InsufficientStorage, "Not enough free space on disk, writing of logs is rejected")
+	}
+	return nil
+}
+
+func SetLowSpace(trace *sl.Trace, low bool) {
+	if _lowSpace.Swap(low) == low {
+		return
+	}
+
+	if low {
+		trace.WARN(nil, "Low space mode is on, writing of logs is rejected")
+	} else {
+		trace.INFO(nil, "Low space mode is off")
+	}
+}
+
+func IsLowSpace() bool {
+	return _lowSpace.Load()
+}
+
+// ReadOnlyStatus returns reason and start of read-only mode. Empty reason means read-write mode
+func ReadOnlyStatus() (reason string, since time.Time) {
+	_readOnly.mx.RLock()
+	defer _readOnly.mx.RUnlock()
+
+	return _readOnly.reason, _readOnly.since
+}
+
+// ProbeWrite writes and removes probe file to check that disk is writable again.
+// Read-only mode is switched off if probe is succeeded
+func (fsr *FileSys) ProbeWrite(trace *sl.Trace) bool {
+	defer trace.AddModule("_FileSys", "ProbeWrite")()
+
+	if reason, _ := ReadOnlyStatus(); reason == "" {
+		return true
+	}
+
+	err := os.WriteFile(m.FILE_PROBE, make([]byte, _PROBE_SIZE), 0644)
+	os.Remove(m.FILE_PROBE)
+
+	if err != nil {
+		trace.DEBUG(nil, "Disk is still not writable: ", err.Error())
+		return false
+	}
+
+	_readOnly.mx.Lock()
+	_readOnly.reason = ""
+	_readOnly.since = time.Time{}
+	_readOnly.mx.Unlock()
+
+	trace.INFO(nil, "Read-only mode is off")
+	return true
+}
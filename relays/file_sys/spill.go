@@ -0,0 +1,178 @@
+package file_sys
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/vmihailenco/msgpack/v5"
+
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+// Spill is a temporary dir of one query, where values are streamed when they are not fitted in memory
+type Spill struct {
+	dir     string
+	created bool
+	size    int64
+	limit   int64
+	trace   *sl.Trace
+}
+
+func NewSpill(trace *sl.Trace, limit int64) *Spill {
+	return &Spill{
+		dir:   path.Join(m.DIR_TMP, uuid.New().String()),
+		limit: limit,
+		trace: trace,
+	}
+}
+
+func (s *Spill) Create(name string) (*SpillWriter, error) {
+	defer s.trace.AddModule("_Spill", "Create")()
+
+	err := os.MkdirAll(s.dir, 0755)
+
+	if err != nil {
+		s.trace.ERROR(nil, "Make dir '", s.dir, "' error: ", err.Error())
+		return nil, err
+	}
+	s.created = true
+
+	name = path.Join(s.dir, name)
+	file, err := os.Create(name)
+
+	if err != nil {
+		s.trace.ERROR(sl.Fields{"name": name}, "Create file error: ", err.Error())
+		return nil, err
+	}
+
+	sw := &SpillWriter{file: file, spill: s}
+	sw.buff = bufio.NewWriter(sw)
+	sw.enc = msgpack.NewEncoder(sw.buff)
+
+	s.trace.DEBUG(sl.Fields{"name": name}, "Spill file created")
+	return sw, nil
+}
+
+func (s *Spill) Open(name string) (*SpillReader, error) {
+	defer s.trace.AddModule("_Spill", "Open")()
+
+	name = path.Join(s.dir, name)
+	file, err := os.Open(name)
+
+	if err != nil {
+		s.trace.ERROR(sl.Fields{"name": name}, "Open file error: ", err.Error())
+		return nil, err
+	}
+
+	return &SpillReader{
+		file: file,
+		dec:  msgpack.NewDecoder(bufio.NewReader(file)),
+	}, nil
+}
+
+func (s *Spill) Size() int64 {
+	return s.size
+}
+
+func (s *Spill) limitErr() error {
+	return aerr.NewAppErr(aerr.LimitExceeded,
+		"Query needs more than ", s.limit, " bytes of temporary disk space",
+	)
+}
+
+func (s *Spill) Remove() {
+	defer s.trace.AddModule("_Spill", "Remove")()
+
+	if !s.created {
+		return
+	}
+
+	err := os.RemoveAll(s.dir)
+
+	if err != nil {
+		s.trace.ERROR(nil, "Remove dir '", s.dir, "' error: ", err.Error())
+		return
+	}
+	s.trace.DEBUG(nil, "Spill removed: ", s.size, " bytes")
+}
+
+// Writer
+
+type SpillWriter struct {
+	file  *os.File
+	buff  *bufio.Writer
+	enc   *msgpack.Encoder
+	spill *Spill
+}
+
+// Write implements io.Writer for buffer and checks spill limit
+func (sw *SpillWriter) Write(data []byte) (int, error) {
+	sw.spill.size += int64(len(data))
+
+	if sw.spill.size > sw.spill.limit {
+		return 0, sw.spill.limitErr()
+	}
+	return sw.file.Write(data)
+}
+
+func (sw *SpillWriter) Put(v any) error {
+	err := sw.enc.Encode(v)
+
+	if err != nil && sw.spill.size > sw.spill.limit {
+		return sw.spill.limitErr()
+	}
+	return err
+}
+
+func (sw *SpillWriter) Close() error {
+	err := sw.buff.Flush()
+	err2 := sw.file.Close()
+
+	if err != nil && sw.spill.size > sw.spill.limit {
+		return sw.spill.limitErr()
+	}
+	if err != nil {
+		return err
+	}
+	return err2
+}
+
+// Reader
+
+type SpillReader struct {
+	file *os.File
+	dec  *msgpack.Decoder
+}
+
+// Get returns io.EOF if all values are readed
+func (sr *SpillReader) Get(v any) error {
+	err := sr.dec.Decode(v)
+
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (sr *SpillReader) Close() {
+	sr.file.Close()
+}
+
+// Functions
+
+func RemoveSpills(trace *sl.Trace) {
+	defer trace.AddModule("", "RemoveSpills")()
+
+	err := os.RemoveAll(m.DIR_TMP)
+
+	if err != nil {
+		trace.FATAL(nil, "Remove dir '", m.DIR_TMP, "' error: ", err.Error())
+	}
+	trace.DEBUG(nil, "Spills removed")
+}
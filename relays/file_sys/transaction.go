@@ -3,12 +3,14 @@ package file_sys
 import (
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	sl "github.com/j-hitgate/sherlog"
 	"github.com/vmihailenco/msgpack/v5"
 
 	m "main/models"
+	"main/tools"
 )
 
 type actionType byte
@@ -55,10 +57,14 @@ func (tx *Transaction) ReadTransaction(name string) {
 	defer tx.trace.AddModule("_Transaction", "ReadTransaction")()
 
 	name = path.Join(m.DIR_TRANSACTIONS, name)
-	data := tx.fileSys.ReadFile(tx.trace, name)
+	data, err := tx.fileSys.ReadFile(tx.trace, name)
+
+	if err != nil {
+		tx.trace.FATAL(sl.Fields{"name": name}, "Read transaction error: ", err.Error())
+	}
 
 	actions := []*action{}
-	err := msgpack.Unmarshal(data, &actions)
+	err = msgpack.Unmarshal(data, &actions)
 
 	if err != nil {
 		tx.trace.FATAL(sl.Fields{"name": name}, "Convert from bytes error: ", err.Error())
@@ -72,11 +78,11 @@ func (tx *Transaction) Add(act *action) {
 	tx.actions = append(tx.actions, act)
 }
 
-func (tx *Transaction) Commit() {
+func (tx *Transaction) Commit() error {
 	defer tx.trace.AddModule("_Transaction", "Commit")()
 
 	if len(tx.actions) == 0 {
-		return
+		return nil
 	}
 
 	data, err := msgpack.Marshal(tx.actions)
@@ -85,27 +91,47 @@ func (tx *Transaction) Commit() {
 		tx.trace.FATAL(sl.Fields{"transaction": tx.name}, "Convert to bytes error: ", err.Error())
 	}
 
-	tx.fileSys.WriteFile(tx.trace, tx.name, true, data)
+	_, err = tx.fileSys.WriteFile(tx.trace, tx.name, true, data)
+
+	if err != nil {
+		return err
+	}
+
+	// Transaction is durable before changes, which it backs up or makes. Its content is synced by writing
+	return tx.fileSys.syncPaths(tx.trace, nil, []string{filepath.Dir(tx.name)})
 }
 
-func (tx *Transaction) Cancel() {
+func (tx *Transaction) Cancel() error {
 	defer tx.trace.AddModule("_Transaction", "Cancel")()
 
 	if len(tx.actions) == 0 {
-		return
+		return nil
+	}
+
+	// Changes must be durable before their backup is removed
+	if err := tx.fileSys.Sync(tx.trace); err != nil {
+		return err
 	}
 
 	err := os.Remove(tx.name)
 
-	if err != nil {
-		tx.trace.FATAL(nil, "Remove transaction '", tx.name, "' error: ", err.Error())
+	if err != nil && !os.IsNotExist(err) {
+		tx.trace.ERROR(nil, "Remove transaction '", tx.name, "' error: ", err.Error())
+		return err
 	}
 	tx.actions = []*action{}
+
+	// Removing is durable, otherwise accepted changes are rolled back after crash
+	return tx.fileSys.syncPaths(tx.trace, nil, []string{filepath.Dir(tx.name)})
 }
 
-func (tx *Transaction) Apply() {
+// Apply is not interrupted by errors, because half-applied transaction leaves files inconsistent.
+// On error the server is stopped and the transaction is applied again after restart.
+// Sync error of applied actions is returned, the transaction is kept to be applied again after restart
+func (tx *Transaction) Apply() error {
 	defer tx.trace.AddModule("_Transaction", "Apply")()
 	var err error
+	files, dirs := []string{}, map[string]bool{}
 
 	for _, act := range tx.actions {
 		switch act.Type {
@@ -118,13 +144,15 @@ func (tx *Transaction) Apply() {
 					"Truncate file error: ", err.Error(),
 				)
 			}
+			files = append(files, act.Name)
 
 		case remove:
-			err = os.RemoveAll(act.Name)
+			err = tx.removeAll(act.Name)
 
 			if err != nil && !os.IsNotExist(err) {
 				tx.trace.FATAL(sl.Fields{"name": act.Name}, "Remove file/dir error: ", err.Error())
 			}
+			dirs[filepath.Dir(act.Name)] = true
 
 		case rename:
 			err = os.Rename(act.Name, act.NewName)
@@ -132,18 +160,51 @@ func (tx *Transaction) Apply() {
 			if err != nil && !os.IsNotExist(err) {
 				tx.trace.FATAL(sl.Fields{"name": act.Name}, "Rename file error: ", err.Error())
 			}
+			dirs[filepath.Dir(act.Name)] = true
+			dirs[filepath.Dir(act.NewName)] = true
 
 		default:
 			tx.trace.FATAL(sl.Fields{"name": act.Name}, "Incorrect action:", act.Type)
 		}
 	}
 
+	// Applied actions are durable before removing of transaction. Removing is synced by next sync,
+	// which is before any next change, and applying again is harmless until then
+	if err = tx.fileSys.syncPaths(tx.trace, files, tools.KeysToSlice(dirs)); err != nil {
+		return err
+	}
+
+	// Transaction may be not committed, if committing is failed
 	err = os.Remove(tx.name)
 
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		tx.trace.FATAL(nil, "Remove transaction '", tx.name, "' error: ", err.Error())
 	}
+	markDirtyDirs(filepath.Dir(tx.name))
 	tx.actions = []*action{}
+	return nil
+}
+
+// removeAll removes also target of symlink (storage in other data dir)
+func (*Transaction) removeAll(name string) error {
+	info, err := os.Lstat(name)
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(name)
+
+		if err != nil {
+			return err
+		}
+
+		if err = os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(name)
 }
 
 // Actions
@@ -165,7 +226,7 @@ func RenameAction(name string, newName string) *action {
 func RunTransactions(trace *sl.Trace) {
 	defer trace.AddModule("", "RunTransactions")()
 
-	err := os.MkdirAll(m.DIR_TRANSACTIONS, 0755)
+	err := makeDirAll(m.DIR_TRANSACTIONS)
 
 	if err != nil {
 		trace.FATAL(nil, "Make dir '", m.DIR_TRANSACTIONS, "' error: ", err.Error())
@@ -189,7 +250,10 @@ func RunTransactions(trace *sl.Trace) {
 
 		} else {
 			tx := NewTransactionFromFile(trace, name)
-			tx.Apply()
+
+			if err = tx.Apply(); err != nil {
+				trace.FATAL(nil, "Apply transaction '", name, "' error: ", err.Error())
+			}
 		}
 	}
 	trace.DEBUG(nil, len(entries), " transactions runned")
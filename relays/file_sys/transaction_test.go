@@ -45,7 +45,7 @@ func TestTransaction(t *testing.T) {
 	}
 
 	tx.ReadTransaction("tx") // Check readability of transaction
-	tx.Apply()
+	assert.NoError(t, tx.Apply())
 
 	_, err = os.Stat(path.Join("transactions", "tx"))
 
@@ -0,0 +1,308 @@
+package file_sys
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/vmihailenco/msgpack/v5"
+
+	m "main/models"
+)
+
+const _WAL_SEGMENT_SIZE = 64 << 20
+
+// walRecord is an accepted batch of logs or a mark, that batch is applied to chunks
+type walRecord struct {
+	Seq     uint64
+	Applied bool     `msgpack:",omitempty"`
+	Storage string   `msgpack:",omitempty"`
+	BatchID string   `msgpack:",omitempty"`
+	Logs    []*m.Log `msgpack:",omitempty"`
+}
+
+// WalEntry is a batch of logs, which is accepted and not applied to chunks yet
+type WalEntry struct {
+	Seq     uint64
+	Storage string
+	BatchID string
+	Logs    []*m.Log
+}
+
+type walSegment struct {
+	name    string
+	start   uint64
+	pending int // not applied entries
+}
+
+// WAL is an append-only log of accepted batches of logs. Batch is acknowledged, when it is durable in WAL,
+// and it is applied to chunks by writers in background. Not applied batches are replayed at startup.
+// WAL is written in segments, which are removed, when all their batches are applied
+type WAL struct {
+	file     *os.File
+	size     int64
+	seq      uint64
+	segments []*walSegment // ordered by start, last is current
+	pending  int
+	fileSys  *FileSys
+	trace    *sl.Trace
+	mx       sync.Mutex
+}
+
+// OpenWAL reads segments of WAL and returns not applied entries for replaying.
+// Torn record at the end of segment (crash while writing) is ignored
+func OpenWAL(trace *sl.Trace) (*WAL, []*WalEntry) {
+	defer trace.AddModule("", "OpenWAL")()
+
+	err := makeDirAll(m.DIR_WAL)
+
+	if err != nil {
+		trace.FATAL(nil, "Make dir '", m.DIR_WAL, "' error: ", err.Error())
+	}
+
+	entries, err := os.ReadDir(m.DIR_WAL)
+
+	if err != nil {
+		trace.FATAL(nil, "Read dir '", m.DIR_WAL, "' error: ", err.Error())
+	}
+
+	w := &WAL{fileSys: &FileSys{}, trace: trace}
+	batches := map[uint64]*WalEntry{}
+	applied := map[uint64]bool{}
+
+	for i := range entries {
+		var start uint64
+		_, err := fmt.Sscanf(entries[i].Name(), "%d", &start)
+
+		if err != nil || entries[i].IsDir() {
+			continue
+		}
+
+		name := path.Join(m.DIR_WAL, entries[i].Name())
+		w.segments = append(w.segments, &walSegment{name: name, start: start})
+
+		for _, rec := range w.readSegment(trace, name) {
+			if rec.Applied {
+				applied[rec.Seq] = true
+			} else {
+				batches[rec.Seq] = &WalEntry{Seq: rec.Seq, Storage: rec.Storage, BatchID: rec.BatchID, Logs: rec.Logs}
+			}
+
+			if rec.Seq > w.seq {
+				w.seq = rec.Seq
+			}
+		}
+	}
+
+	sort.Slice(w.segments, func(i, j int) bool {
+		return w.segments[i].start < w.segments[j].start
+	})
+
+	// Collect not applied entries
+
+	replay := []*WalEntry{}
+
+	for seq, entry := range batches {
+		if !applied[seq] {
+			replay = append(replay, entry)
+			w.segmentOf(seq).pending++
+			w.pending++
+		}
+	}
+
+	sort.Slice(replay, func(i, j int) bool {
+		return replay[i].Seq < replay[j].Seq
+	})
+
+	// New entries are written to new segment
+
+	if err = w.rotate(); err != nil {
+		trace.FATAL(nil, "Create WAL segment error: ", err.Error())
+	}
+
+	trace.DEBUG(nil, len(replay), " WAL entries will be replayed")
+	return w, replay
+}
+
+func (w *WAL) readSegment(trace *sl.Trace, name string) []*walRecord {
+	data, err := w.fileSys.ReadFile(trace, name)
+
+	if err != nil {
+		trace.FATAL(sl.Fields{"name": name}, "Read WAL segment error: ", err.Error())
+	}
+
+	records := []*walRecord{}
+	i := 0
+
+	for i+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[i:]))
+		sum := binary.LittleEndian.Uint32(data[i+4:])
+		i += 8
+
+		if i+length > len(data) || crc32.ChecksumIEEE(data[i:i+length]) != sum {
+			trace.WARN(sl.Fields{"name": name}, "Torn record at the end of WAL segment is ignored")
+			break
+		}
+
+		rec := &walRecord{}
+
+		if err = msgpack.Unmarshal(data[i:i+length], rec); err != nil {
+			trace.WARN(sl.Fields{"name": name}, "Incorrect WAL record is ignored: ", err.Error())
+			break
+		}
+
+		records = append(records, rec)
+		i += length
+	}
+	return records
+}
+
+func (w *WAL) segmentOf(seq uint64) *walSegment {
+	i := sort.Search(len(w.segments), func(i int) bool {
+		return w.segments[i].start > seq
+	})
+	return w.segments[i-1]
+}
+
+// rotate closes current segment and creates new one. Fully applied segments are removed
+func (w *WAL) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	name := path.Join(m.DIR_WAL, fmt.Sprintf("%020d", w.seq+1))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+	markDirtyDirs(m.DIR_WAL)
+
+	w.file = file
+	w.size = 0
+	w.segments = append(w.segments, &walSegment{name: name, start: w.seq + 1})
+	w.removeApplied()
+	return nil
+}
+
+// removeApplied removes fully applied segments from the oldest one.
+// Segment is not removed before older ones, because it may keep marks of their applied entries
+func (w *WAL) removeApplied() {
+	i := 0
+
+	for ; i < len(w.segments)-1 && w.segments[i].pending == 0; i++ {
+		if _, err := w.fileSys.Remove(w.trace, w.segments[i].name); err != nil {
+			break
+		}
+		markDirtyDirs(m.DIR_WAL)
+	}
+	w.segments = w.segments[i:]
+}
+
+func (w *WAL) write(trace *sl.Trace, rec *walRecord) error {
+	data, err := msgpack.Marshal(rec)
+
+	if err != nil {
+		trace.FATAL(nil, "Convert WAL record to bytes error: ", err.Error())
+	}
+
+	if w.size > 0 && w.size+int64(len(data)) > _WAL_SEGMENT_SIZE {
+		if err = w.rotate(); err != nil {
+			return w.fileSys.writeErr(trace, nil, err, "Create WAL segment error: ")
+		}
+	}
+
+	buff := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(buff, uint32(len(data)))
+	binary.LittleEndian.PutUint32(buff[4:], crc32.ChecksumIEEE(data))
+	buff = append(buff, data...)
+
+	// Partial record is cut, so next records are readable
+	if _, err = w.file.Write(buff); err != nil {
+		w.file.Truncate(w.size)
+		return w.fileSys.writeErr(trace, sl.Fields{"name": w.file.Name()}, err, "Write to WAL error: ")
+	}
+	w.size += int64(len(buff))
+	markDirty(w.file.Name())
+
+	return nil
+}
+
+// Append writes batch of logs to WAL and returns, when it is durable (by durability mode).
+// Batch without ID gets implicit one, so batch replayed after crash is not written twice
+func (w *WAL) Append(trace *sl.Trace, logs *m.Logs) (*WalEntry, error) {
+	defer trace.AddModule("_WAL", "Append")()
+
+	batchID := logs.BatchID
+
+	if batchID == "" {
+		batchID = "wal:" + uuid.New().String()
+	}
+
+	w.mx.Lock()
+	entry := &WalEntry{Seq: w.seq + 1, Storage: logs.Storage, BatchID: batchID, Logs: logs.Logs}
+	err := w.write(trace, &walRecord{Seq: entry.Seq, Storage: entry.Storage, BatchID: entry.BatchID, Logs: entry.Logs})
+
+	if err != nil {
+		w.mx.Unlock()
+		return nil, err
+	}
+
+	w.seq++
+	w.segments[len(w.segments)-1].pending++
+	w.pending++
+	w.mx.Unlock()
+
+	// Sync is out of lock, so syncs of concurrent appends are grouped
+	if err = w.fileSys.Sync(trace); err != nil {
+		return nil, err
+	}
+
+	trace.DEBUG(nil, "WAL entry ", entry.Seq, " appended")
+	return entry, nil
+}
+
+// Done marks entry as applied to chunks or dropped. Not marked entry stays in WAL and is replayed
+// after restart. Mark is not synced at once, so after crash applied entry may be replayed again,
+// then its logs are skipped by batch ID
+func (w *WAL) Done(trace *sl.Trace, seq uint64) {
+	defer trace.AddModule("_WAL", "Done")()
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if err := w.write(trace, &walRecord{Seq: seq, Applied: true}); err != nil {
+		return
+	}
+
+	w.segmentOf(seq).pending--
+	w.pending--
+	w.removeApplied()
+}
+
+// Pending returns number of accepted and not applied entries
+func (w *WAL) Pending() int {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.pending
+}
+
+func (w *WAL) Close(trace *sl.Trace) {
+	defer trace.AddModule("_WAL", "Close")()
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if err := w.file.Sync(); err != nil {
+		trace.ERROR(nil, "Sync WAL error: ", err.Error())
+	}
+	w.file.Close()
+	markDirtyDirs(filepath.Dir(w.file.Name()))
+}
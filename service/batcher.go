@@ -0,0 +1,75 @@
+package service
+
+import (
+	"time"
+
+	m "main/models"
+)
+
+// batcher collects logs of listeners and passes them to writing by batches of storage.
+// A batch is written, when it's full or when flush period is passed
+type batcher struct {
+	storage string
+	size    int
+	period  time.Duration
+	write   func(logs *m.Logs)
+	logs    chan *m.Log
+	done    chan struct{}
+}
+
+func newBatcher(storage string, size int, period time.Duration, write func(logs *m.Logs)) *batcher {
+	b := &batcher{
+		storage: storage,
+		size:    size,
+		period:  period,
+		write:   write,
+		logs:    make(chan *m.Log, size),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add adds log to batch, it waits while previous full batch is written
+func (b *batcher) Add(l *m.Log) {
+	b.logs <- l
+}
+
+// Stop writes the rest of logs. Logs can't be added after it
+func (b *batcher) Stop() {
+	close(b.logs)
+	<-b.done
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.period)
+	defer ticker.Stop()
+
+	batch := make([]*m.Log, 0, b.size)
+
+	flush := func() {
+		if len(batch) > 0 {
+			b.write(&m.Logs{Storage: b.storage, Logs: batch})
+			batch = make([]*m.Log, 0, b.size)
+		}
+	}
+
+	for {
+		select {
+		case l, ok := <-b.logs:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, l)
+
+			if len(batch) == b.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
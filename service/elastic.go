@@ -0,0 +1,207 @@
+package service
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/labstack/echo/v4"
+
+	"main/agents/elastic"
+	lm "main/agents/log_mapping"
+	aerr "main/app_errors"
+	m "main/models"
+	"main/tools"
+)
+
+const _ES_VERSION = "8.0.0" // version of Elasticsearch, which is reported to clients
+
+// getEsInfo responds like root of Elasticsearch, clients check it before sending of bulks
+func (s *Service) getEsInfo(c echo.Context) error {
+	c.Response().Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	return c.JSON(200, map[string]any{
+		"name":         "sherlogdb",
+		"cluster_name": "sherlogdb",
+		"version": map[string]string{
+			"number":       _ES_VERSION,
+			"build_flavor": "default",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// postEsBulk receives bulk request of Elasticsearch with 'index' and 'create' actions.
+// Index is storage, document is mapped to log. Results of items are shaped like in Elasticsearch,
+// so clients retry only items with 429
+func (s *Service) postEsBulk(c echo.Context) error {
+	start := time.Now()
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostEsBulkAPI")
+	defer trace.AddModule("_Service", "postEsBulk")()
+
+	trace.INFO(nil, "Request processing...")
+	c.Response().Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	err := s.writable(trace, true)
+
+	if err != nil {
+		return s.sendEsError(c, err)
+	}
+
+	data, err := s.readBody(trace, c)
+
+	if err != nil {
+		return s.sendEsError(c, err)
+	}
+
+	actions, err := elastic.ParseBulk(data, c.Param("index"))
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, err.Error())
+		trace.NOTE(nil, err.Error())
+		return s.sendEsError(c, err)
+	}
+
+	// Map documents to logs of storages
+
+	mapping := lm.Mapping(s.config.Elastic.Mapping)
+
+	if mapping == nil {
+		mapping = elastic.DefaultMapping()
+	}
+
+	resp := &elastic.BulkResponse{Items: make([]map[string]*elastic.ItemResult, len(actions))}
+	logsMap := map[string][]*m.Log{}
+	itemsMap := map[string][]*elastic.ItemResult{}
+	now := time.Now()
+
+	for i, action := range actions {
+		item := &elastic.ItemResult{
+			Index: action.Index,
+			ID:    tools.FirstNotEmpty(action.ID, uuid.New().String()),
+		}
+		resp.Items[i] = map[string]*elastic.ItemResult{action.Type: item}
+
+		if action.Type != elastic.ACTION_INDEX && action.Type != elastic.ACTION_CREATE {
+			setEsError(item, 400, "illegal_argument_exception", "Action '"+action.Type+"' is not supported")
+			continue
+		}
+
+		if action.Index == "" {
+			setEsError(item, 400, "action_request_validation_exception", "Index is missing")
+			continue
+		}
+
+		if action.Err != nil {
+			setEsError(item, 400, "mapper_parsing_exception", action.Err.Error())
+			continue
+		}
+
+		l := mapping.ToLog(action.Doc, now)
+
+		if p := s.pipeline(action.Index); p != nil {
+			p.Apply(trace, l)
+		}
+
+		if errs := l.Errors(); len(errs) > 0 {
+			setEsError(item, 400, "mapper_parsing_exception", errs[0].Reason)
+			continue
+		}
+
+		if !s.metasMap.Exists(action.Index) {
+			setEsError(item, 404, "index_not_found_exception", "no such index ["+action.Index+"]")
+			continue
+		}
+		logsMap[action.Index] = append(logsMap[action.Index], l)
+		itemsMap[action.Index] = append(itemsMap[action.Index], item)
+	}
+
+	// Write batches of storages
+
+	storages := tools.KeysToSlice(logsMap)
+	slices.Sort(storages)
+
+	err = s.admit(trace, c, storages...)
+
+	if err != nil {
+		return s.sendEsError(c, err)
+	}
+
+	batches := make([]*m.Logs, len(storages))
+
+	for i, storage := range storages {
+		batches[i] = &m.Logs{Storage: storage, Logs: logsMap[storage]}
+	}
+
+	errs := s.writeParallel(c.Request().Context(), trace, batches)
+
+	for storage, err := range errs {
+		for _, item := range itemsMap[storage] {
+			if err != nil {
+				status, e := esError(err)
+				setEsError(item, status, e.Type, e.Reason)
+			} else {
+				item.Status, item.Result, item.Version = 201, "created", 1
+			}
+		}
+	}
+
+	for _, item := range resp.Items {
+		for _, result := range item {
+			resp.Errors = resp.Errors || result.Error != nil
+		}
+	}
+
+	if resp.Errors {
+		trace.NOTE(nil, "Some items are not saved")
+	}
+
+	resp.Took = time.Since(start).Milliseconds()
+	trace.INFO(nil, "Request processed")
+	return c.JSON(200, resp)
+}
+
+// sendEsError sends error of whole request, which is shaped like in Elasticsearch
+func (s *Service) sendEsError(c echo.Context, err error) error {
+	if appErr, ok := err.(*aerr.AppErr); ok && appErr.RetryAfter() > 0 {
+		secs := int(math.Ceil(appErr.RetryAfter().Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+
+	status, e := esError(err)
+	return c.JSON(status, map[string]any{
+		"error":  e,
+		"status": status,
+	})
+}
+
+// esError converts error to status and error of Elasticsearch. Overload errors are 429,
+// which clients of Elasticsearch retry
+func esError(err error) (int, *elastic.Error) {
+	appErr, ok := err.(*aerr.AppErr)
+
+	if !ok {
+		return 500, &elastic.Error{Type: "exception", Reason: "Server error"}
+	}
+
+	switch appErr.Type() {
+	case aerr.BadReq:
+		return 400, &elastic.Error{Type: "illegal_argument_exception", Reason: appErr.Error()}
+	case aerr.NotFound:
+		return 404, &elastic.Error{Type: "index_not_found_exception", Reason: appErr.Error()}
+	case aerr.TooManyReqs, aerr.Unavailable, aerr.InsufficientStorage:
+		return 429, &elastic.Error{Type: "es_rejected_execution_exception", Reason: appErr.Error()}
+	default:
+		return aerr.GetStatus(appErr.Type()), &elastic.Error{Type: "exception", Reason: appErr.Error()}
+	}
+}
+
+func setEsError(item *elastic.ItemResult, status int, errType, reason string) {
+	item.Status = status
+	item.Error = &elastic.Error{Type: errType, Reason: reason}
+}
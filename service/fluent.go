@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	"main/agents/fluent"
+	lm "main/agents/log_mapping"
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+// runFluent runs listener of forward protocol, if it's configured
+func (s *Service) runFluent(trace *sl.Trace) {
+	defer trace.AddModule("_Service", "runFluent")()
+
+	if s.config.Fluent.Addr == "" {
+		return
+	}
+
+	s.fluent = fluent.NewListener(s.writeForwarded)
+	err := s.fluent.Run(trace, s.config.Fluent.Addr)
+
+	if err != nil {
+		trace.FATAL(nil, "Listen fluent forward error: ", err.Error())
+	}
+}
+
+// stopFluent stops listener of forward protocol and waits for writing of received messages
+func (s *Service) stopFluent(trace *sl.Trace) {
+	if s.fluent == nil {
+		return
+	}
+
+	s.fluent.Stop()
+	trace.INFO(nil, "Fluent forward stopped")
+}
+
+// writeForwarded writes records of message to storage of its tag. Chunk ID is batch ID,
+// so chunk, which is resent after lost ack, isn't saved twice. Error is returned only
+// if writing can succeed later, then message isn't acknowledged and sender retries it.
+// Records of not existing storage and invalid records are dropped
+func (s *Service) writeForwarded(trace *sl.Trace, msg *fluent.Message) error {
+	defer trace.AddModule("_Service", "writeForwarded")()
+
+	if len(msg.Entries) == 0 {
+		return nil
+	}
+
+	if !s.metasMap.Exists(msg.Tag) {
+		trace.WARN(nil, len(msg.Entries), " records are dropped: storage '", msg.Tag, "' not exists")
+		return nil
+	}
+
+	mapping := lm.Mapping(s.config.Fluent.Mapping)
+
+	if mapping == nil {
+		mapping = fluent.DefaultMapping()
+	}
+
+	logs := &m.Logs{Storage: msg.Tag, BatchID: msg.Chunk, Partial: true, Logs: make([]*m.Log, len(msg.Entries))}
+
+	for i, entry := range msg.Entries {
+		logs.Logs[i] = mapping.ToLog(entry.Record, entry.Time)
+	}
+
+	s.transform(trace, logs)
+	_, err := logs.Validate(trace)
+
+	if err == nil {
+		err = s.writable(trace, true)
+	}
+
+	if err == nil {
+		err = s.writeLogs(context.Background(), trace, logs, nil)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	if appErr, ok := err.(*aerr.AppErr); ok {
+		switch appErr.Type() {
+		case aerr.TooManyReqs, aerr.Unavailable, aerr.Timeout, aerr.InsufficientStorage:
+		default:
+			trace.WARN(nil, len(logs.Logs), " records of storage '", msg.Tag, "' are dropped: ", err.Error())
+			return nil
+		}
+	}
+
+	trace.NOTE(nil, "Message isn't acknowledged: ", err.Error())
+	return err
+}
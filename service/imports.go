@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/labstack/echo/v4"
+
+	"main/agents/sl_dump"
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+// Imports of dump files of sherlog
+
+// runImports runs watchers of saved imports
+func (s *Service) runImports(trace *sl.Trace) {
+	defer trace.AddModule("_Service", "runImports")()
+
+	s.importsMx.Lock()
+	defer s.importsMx.Unlock()
+
+	for _, imp := range s.fileSys.ReadImports(trace) {
+		watcher := sl_dump.NewWatcher(imp, s.config.Import.PollPeriod, s.writeImported)
+		s.imports[imp.ID] = watcher
+		watcher.Run()
+	}
+}
+
+// stopImports stops watchers and waits for writing of read logs
+func (s *Service) stopImports(trace *sl.Trace) {
+	s.importsMx.Lock()
+	defer s.importsMx.Unlock()
+
+	for _, watcher := range s.imports {
+		watcher.Stop()
+	}
+
+	if len(s.imports) > 0 {
+		trace.INFO(nil, "Imports stopped")
+	}
+}
+
+// writeImported writes logs of dump file and then saves offsets of import. If saving of offsets fails,
+// the logs are read again, but their batch is not written twice
+func (s *Service) writeImported(trace *sl.Trace, logs *m.Logs, next *m.Import) error {
+	defer trace.AddModule("_Service", "writeImported")()
+
+	if len(logs.Logs) > 0 {
+		if !s.metasMap.Exists(logs.Storage) {
+			err := aerr.NewAppErr(aerr.NotFound, "Storage '", logs.Storage, "' not exists")
+			trace.NOTE(nil, err.Error())
+			return err
+		}
+
+		// Batch of only invalid logs is skipped
+		s.transform(trace, logs)
+		_, err := logs.Validate(trace)
+
+		if err == nil {
+			err = s.writable(trace, true)
+
+			if err == nil {
+				err = s.writeLogs(context.Background(), trace, logs, nil)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := s.fileSys.WriteFile(trace, path.Join(m.DIR_IMPORTS, next.ID), true, next)
+	return err
+}
+
+func (s *Service) getImports(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "GetImportsAPI")
+	defer trace.AddModule("_Service", "getImports")()
+
+	trace.INFO(nil, "Request processing...")
+
+	s.importsMx.Lock()
+	imports := make([]*m.Import, 0, len(s.imports))
+
+	for _, watcher := range s.imports {
+		imports = append(imports, watcher.Import())
+	}
+	s.importsMx.Unlock()
+
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].Dir < imports[j].Dir ||
+			imports[i].Dir == imports[j].Dir && imports[i].Storage < imports[j].Storage
+	})
+
+	trace.INFO(nil, "Request processed")
+	return c.JSON(200, imports)
+}
+
+// postImport starts watching of logs dir of sherlog, new logs of its dump files are written to storage
+func (s *Service) postImport(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostImportAPI")
+	defer trace.AddModule("_Service", "postImport")()
+
+	trace.INFO(nil, "Request processing...")
+
+	imp := &m.Import{}
+	err := c.Bind(imp)
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.(*echo.HTTPError).Message)
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err = imp.Validate(trace)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	if !s.metasMap.Exists(imp.Storage) {
+		err = aerr.NewAppErr(aerr.NotFound, "Storage '", imp.Storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	if info, err := os.Stat(imp.Dir); err != nil || !info.IsDir() {
+		err = aerr.NewAppErr(aerr.BadReq, "Dir '", imp.Dir, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	s.importsMx.Lock()
+	defer s.importsMx.Unlock()
+
+	for _, watcher := range s.imports {
+		if other := watcher.Import(); other.Dir == imp.Dir && other.Storage == imp.Storage {
+			err = aerr.NewAppErr(aerr.Conflict, "Dir '", imp.Dir, "' is already imported to storage '", imp.Storage, "'")
+			trace.NOTE(nil, err.Error())
+			return s.sendError(c, err)
+		}
+	}
+
+	imp.ID = uuid.New().String()
+	imp.Offsets = map[string]int64{}
+	imp.Starts = map[string]int64{}
+
+	_, err = s.fileSys.WriteFile(trace, path.Join(m.DIR_IMPORTS, imp.ID), true, imp)
+
+	if err == nil {
+		err = s.fileSys.Sync(trace)
+	}
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	watcher := sl_dump.NewWatcher(imp.Copy(), s.config.Import.PollPeriod, s.writeImported)
+	s.imports[imp.ID] = watcher
+	watcher.Run()
+
+	trace.INFO(nil, "Request processed")
+	return c.JSON(201, imp)
+}
+
+// deleteImport stops watching of logs dir, imported logs are kept
+func (s *Service) deleteImport(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "DeleteImportAPI")
+	defer trace.AddModule("_Service", "deleteImport")()
+
+	trace.INFO(nil, "Request processing...")
+
+	req := &m.Import{}
+	err := c.Bind(req)
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.(*echo.HTTPError).Message)
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	s.importsMx.Lock()
+	defer s.importsMx.Unlock()
+
+	watcher, ok := s.imports[req.ID]
+
+	if !ok {
+		err = aerr.NewAppErr(aerr.NotFound, "Import '", req.ID, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	watcher.Stop()
+	delete(s.imports, req.ID)
+	_, err = s.fileSys.Remove(trace, path.Join(m.DIR_IMPORTS, req.ID))
+
+	if err == nil {
+		err = s.fileSys.Sync(trace)
+	}
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	trace.INFO(nil, "Request processed")
+	return s.sendMessage(c, 200, "Import deleted")
+}
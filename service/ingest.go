@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/labstack/echo/v4"
+
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+const _MAX_BODY = 64 << 20 // max size of decompressed body of ingest API of other formats (OTLP, Loki)
+
+// Ingest of logs of other formats
+
+// readBody reads decompressed body, which is no larger than _MAX_BODY
+func (s *Service) readBody(trace *sl.Trace, c echo.Context) ([]byte, error) {
+	body, err := s.requestBody(trace, c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, _MAX_BODY+1))
+
+	if err == nil && len(data) > _MAX_BODY {
+		err = fmt.Errorf("body is larger than %d bytes", _MAX_BODY)
+	}
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Reading of body failed: ", err.Error())
+		trace.NOTE(nil, err.Error())
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeMapped writes logs, which are mapped from records of other format, to their storages.
+// Logs of not existing storages, invalid logs and logs of failed batches are rejected.
+// Error of writing is returned, if nothing is saved, so client can retry request
+func (s *Service) writeMapped(c echo.Context, trace *sl.Trace, logsMap map[string][]*m.Log) (rejected int, reason string, err error) {
+	defer trace.AddModule("_Service", "writeMapped")()
+
+	storages := make([]string, 0, len(logsMap))
+
+	for storage := range logsMap {
+		storages = append(storages, storage)
+	}
+	slices.Sort(storages)
+
+	err = s.admit(trace, c, storages...)
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	batches := make([]*m.Logs, 0, len(storages))
+
+	for _, storage := range storages {
+		logs := &m.Logs{Storage: storage, Partial: true, Logs: logsMap[storage]}
+
+		if !s.metasMap.Exists(storage) {
+			rejected += len(logs.Logs)
+			reason = "Storage '" + storage + "' not exists"
+			continue
+		}
+
+		s.transform(trace, logs)
+		report, err := logs.Validate(trace)
+
+		if report != nil && len(report.Rejected) > 0 {
+			rejected += len(report.Rejected)
+			reason = "Some log records are invalid"
+		}
+
+		if err != nil {
+			continue
+		}
+		batches = append(batches, logs)
+	}
+
+	errs := s.writeParallel(c.Request().Context(), trace, batches)
+	saved := 0
+
+	for _, logs := range batches {
+		if err = errs[logs.Storage]; err != nil {
+			rejected += len(logs.Logs)
+			reason = err.Error()
+		} else {
+			saved++
+		}
+	}
+
+	if saved == 0 && len(batches) > 0 {
+		return 0, "", err
+	}
+
+	if rejected > 0 {
+		trace.NOTE(nil, rejected, " log records are rejected: ", reason)
+	}
+	return rejected, reason, nil
+}
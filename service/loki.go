@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"mime"
+	"strconv"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/labstack/echo/v4"
+
+	"main/agents/loki"
+	aerr "main/app_errors"
+)
+
+// postLokiPush receives streams of Loki push API (snappy-compressed protobuf or JSON).
+// Entries are mapped to logs of storages, which are chosen by label of stream.
+// If some entries are rejected, saved ones stay saved and 400 is returned, as Loki does
+func (s *Service) postLokiPush(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostLokiPushAPI")
+	defer trace.AddModule("_Service", "postLokiPush")()
+
+	trace.INFO(nil, "Request processing...")
+
+	err := s.writable(trace, true)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	// Decode request
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	if mediaType != _MIME_PROTOBUF && mediaType != echo.MIMEApplicationJSON {
+		trace.NOTE(nil, "Unsupported content type '", mediaType, "'")
+		return s.sendMessage(c, 415, "Content type must be '"+_MIME_PROTOBUF+"' or 'application/json'")
+	}
+
+	data, err := s.readBody(trace, c)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	req := &loki.PushRequest{}
+
+	if mediaType == _MIME_PROTOBUF {
+		data, err = loki.DecodeSnappy(data, _MAX_BODY)
+
+		if err == nil {
+			req, err = loki.UnmarshalProto(data)
+		}
+	} else {
+		err = json.Unmarshal(data, req)
+	}
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.Error())
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	// Map entries to storages
+
+	logsMap, rejected := req.ToLogs(s.config.Loki.StorageLabel, s.config.Loki.DefaultStorage)
+	failed, reason, err := s.writeMapped(c, trace, logsMap)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+	rejected += failed
+
+	if rejected > 0 {
+		if reason == "" {
+			reason = "Some streams have no label '" + s.config.Loki.StorageLabel + "'"
+		}
+		return s.sendMessage(c, 400, strconv.Itoa(rejected)+" entries are rejected: "+reason)
+	}
+
+	trace.INFO(nil, "Request processed")
+	return c.NoContent(204)
+}
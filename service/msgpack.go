@@ -0,0 +1,103 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var _mimeMsgpack = []string{"application/msgpack", "application/x-msgpack"}
+
+// binder decodes msgpack bodies and JSON bodies with numbers as json.Number, so integers
+// are not rounded to float64. Other bodies are decoded by default binder.
+// Keys of msgpack maps are the same as in JSON
+type binder struct {
+	echo.DefaultBinder
+}
+
+func (b *binder) Bind(i any, c echo.Context) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	if mediaType == echo.MIMEApplicationJSON {
+		return b.bindJSON(i, c)
+	}
+
+	if !isMsgpack(mediaType) {
+		return b.DefaultBinder.Bind(i, c)
+	}
+
+	dec := msgpack.NewDecoder(c.Request().Body)
+	dec.SetCustomStructTag("json")
+
+	if err := dec.Decode(i); err != nil {
+		return echo.NewHTTPError(400, "Msgpack error: "+err.Error()).SetInternal(err)
+	}
+	return nil
+}
+
+// bindJSON binds params as default binder, then body
+func (b *binder) bindJSON(i any, c echo.Context) error {
+	req := c.Request()
+
+	if err := b.BindPathParams(c, i); err != nil {
+		return err
+	}
+
+	if req.Method == http.MethodGet || req.Method == http.MethodDelete || req.Method == http.MethodHead {
+		if err := b.BindQueryParams(c, i); err != nil {
+			return err
+		}
+	}
+
+	if req.ContentLength == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(req.Body)
+	dec.UseNumber()
+
+	if err := dec.Decode(i); err != nil {
+		return echo.NewHTTPError(400, "JSON error: "+err.Error()).SetInternal(err)
+	}
+	return nil
+}
+
+func isMsgpack(mediaType string) bool {
+	for _, t := range _mimeMsgpack {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// sendData sends data in msgpack, if client accepts it, otherwise in JSON
+func (s *Service) sendData(c echo.Context, status int, v any) error {
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	mediaType := ""
+
+	for _, t := range _mimeMsgpack {
+		if strings.Contains(accept, t) {
+			mediaType = t
+			break
+		}
+	}
+
+	if mediaType == "" {
+		return c.JSON(status, v)
+	}
+
+	buff := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buff)
+	enc.SetCustomStructTag("json")
+
+	if err := enc.Encode(v); err != nil {
+		return s.sendMessage(c, 500, "Server error")
+	}
+	return c.Blob(status, mediaType, buff.Bytes())
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"encoding/json"
+	"mime"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/labstack/echo/v4"
+
+	"main/agents/otlp"
+	aerr "main/app_errors"
+)
+
+const _MIME_PROTOBUF = "application/x-protobuf"
+
+// postOtlpLogs receives logs of OpenTelemetry (OTLP/HTTP, protobuf or JSON).
+// Records are mapped to logs of storages, which are chosen by resource attribute.
+// Records, which can't be saved, are reported as rejected in partial success
+func (s *Service) postOtlpLogs(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostOtlpLogsAPI")
+	defer trace.AddModule("_Service", "postOtlpLogs")()
+
+	trace.INFO(nil, "Request processing...")
+
+	err := s.writable(trace, true)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	// Decode request
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	if mediaType != _MIME_PROTOBUF && mediaType != echo.MIMEApplicationJSON {
+		trace.NOTE(nil, "Unsupported content type '", mediaType, "'")
+		return s.sendMessage(c, 415, "Content type must be '"+_MIME_PROTOBUF+"' or 'application/json'")
+	}
+
+	data, err := s.readBody(trace, c)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	req := &otlp.Request{}
+
+	if mediaType == _MIME_PROTOBUF {
+		req, err = otlp.UnmarshalProto(data)
+	} else {
+		err = json.Unmarshal(data, req)
+	}
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.Error())
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	// Map records to storages
+
+	logsMap, rejected := req.ToLogs(s.config.OTLP.StorageAttr, s.config.OTLP.DefaultStorage)
+	failed, reason, err := s.writeMapped(c, trace, logsMap)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+	rejected += failed
+	resp := &otlp.Response{}
+
+	if rejected > 0 {
+		if reason == "" {
+			reason = "Some log records have no storage"
+		}
+		resp.PartialSuccess = &otlp.PartialSuccess{
+			RejectedLogRecords: int64(rejected),
+			ErrorMessage:       reason,
+		}
+	}
+
+	trace.INFO(nil, "Request processed")
+
+	if mediaType == _MIME_PROTOBUF {
+		return c.Blob(200, _MIME_PROTOBUF, resp.MarshalProto())
+	}
+	return c.JSON(200, resp)
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"path"
+	"sort"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+	"github.com/labstack/echo/v4"
+
+	"main/agents/pipeline"
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+// Pipelines of storages
+
+// loadPipelines compiles saved pipelines
+func (s *Service) loadPipelines(trace *sl.Trace) {
+	defer trace.AddModule("_Service", "loadPipelines")()
+
+	s.pipelinesMx.Lock()
+	defer s.pipelinesMx.Unlock()
+
+	for _, def := range s.fileSys.ReadPipelines(trace) {
+		p, err := pipeline.Compile(trace, def)
+
+		if err != nil {
+			trace.FATAL(nil, "Compiling of pipeline of storage '", def.Storage, "' error: ", err.Error())
+		}
+		s.pipelines[def.Storage] = p
+	}
+}
+
+// pipeline returns pipeline of storage or nil
+func (s *Service) pipeline(storage string) *pipeline.Pipeline {
+	s.pipelinesMx.RLock()
+	defer s.pipelinesMx.RUnlock()
+	return s.pipelines[storage]
+}
+
+// transform applies pipeline of storage to logs of batch, it's done before validation
+func (s *Service) transform(trace *sl.Trace, logs *m.Logs) {
+	if p := s.pipeline(logs.Storage); p != nil {
+		p.Apply(trace, logs.Logs...)
+	}
+}
+
+func (s *Service) getPipelines(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "GetPipelinesAPI")
+	defer trace.AddModule("_Service", "getPipelines")()
+
+	trace.INFO(nil, "Request processing...")
+
+	s.pipelinesMx.RLock()
+	pipelines := make([]*m.Pipeline, 0, len(s.pipelines))
+
+	for _, p := range s.pipelines {
+		pipelines = append(pipelines, p.Definition())
+	}
+	s.pipelinesMx.RUnlock()
+
+	sort.Slice(pipelines, func(i, j int) bool {
+		return pipelines[i].Storage < pipelines[j].Storage
+	})
+
+	trace.INFO(nil, "Request processed")
+	return c.JSON(200, pipelines)
+}
+
+// postPipeline sets pipeline of storage, previous one is replaced
+func (s *Service) postPipeline(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostPipelineAPI")
+	defer trace.AddModule("_Service", "postPipeline")()
+
+	trace.INFO(nil, "Request processing...")
+
+	def := &m.Pipeline{}
+	err := c.Bind(def)
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.(*echo.HTTPError).Message)
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err = def.Validate(trace)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	p, err := pipeline.Compile(trace, def)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	if !s.metasMap.Exists(def.Storage) {
+		err = aerr.NewAppErr(aerr.NotFound, "Storage '", def.Storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	s.pipelinesMx.Lock()
+	defer s.pipelinesMx.Unlock()
+
+	_, err = s.fileSys.WriteFile(trace, path.Join(m.DIR_PIPELINES, def.Storage), true, def)
+
+	if err == nil {
+		err = s.fileSys.Sync(trace)
+	}
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+	s.pipelines[def.Storage] = p
+
+	trace.INFO(nil, "Request processed")
+	return s.sendMessage(c, 201, "Pipeline saved")
+}
+
+func (s *Service) deletePipeline(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "DeletePipelineAPI")
+	defer trace.AddModule("_Service", "deletePipeline")()
+
+	trace.INFO(nil, "Request processing...")
+
+	req := &m.Storage{}
+	err := c.Bind(req)
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.(*echo.HTTPError).Message)
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err = req.Validate(trace)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	s.pipelinesMx.Lock()
+	defer s.pipelinesMx.Unlock()
+
+	if _, ok := s.pipelines[req.Storage]; !ok {
+		err = aerr.NewAppErr(aerr.NotFound, "Pipeline of storage '", req.Storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err = s.removePipeline(trace, req.Storage)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	trace.INFO(nil, "Request processed")
+	return s.sendMessage(c, 200, "Pipeline deleted")
+}
+
+// removePipeline removes pipeline of storage, if it exists. Caller must hold lock of pipelines
+func (s *Service) removePipeline(trace *sl.Trace, storage string) error {
+	if _, ok := s.pipelines[storage]; !ok {
+		return nil
+	}
+
+	_, err := s.fileSys.Remove(trace, path.Join(m.DIR_PIPELINES, storage))
+
+	if err == nil {
+		err = s.fileSys.Sync(trace)
+	}
+
+	if err != nil {
+		return err
+	}
+	delete(s.pipelines, storage)
+	return nil
+}
@@ -1,44 +1,109 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	sl "github.com/j-hitgate/sherlog"
 	"github.com/labstack/echo/v4"
 
+	"main/agents/fluent"
+	"main/agents/limiter"
 	"main/agents/log_utils"
+	"main/agents/pipeline"
+	"main/agents/sl_dump"
 	sa "main/agents/storage"
+	"main/agents/syslog"
+	"main/agents/tail"
 	aerr "main/app_errors"
 	m "main/models"
 	"main/relays/file_sys"
 )
 
+const (
+	_BULK_IN_FLIGHT = 4       // batches of bulk request, which are written at once
+	_BULK_MAX_LINE  = 1 << 20 // max size of line of bulk request
+
+	_WAL_RETRY_MIN = time.Second // first delay of retry of not applied WAL entry
+	_WAL_RETRY_MAX = time.Minute
+)
+
 type Service struct {
-	app      *echo.Echo
-	config   *m.Config
-	metasMap *sa.MetasMap
+	app        *echo.Echo
+	config     *m.Config
+	metasMap   *sa.MetasMap
+	batchesMap *sa.BatchesMap
 
 	writeQueue  chan *m.WriteLogsTask
 	readQueue   chan *m.ReadLogsTask
 	deleteQueue chan *m.DeleteQuery
 	fileSys     *file_sys.FileSys
+
+	storageLimiter *limiter.Limiter
+	clientLimiter  *limiter.Limiter
+
+	writers   []*sa.Writer
+	readers   []*sa.Reader
+	deleters  []*sa.Deleter
+	scheduler *sa.Scheduler
+	wal       *file_sys.WAL
+	walWg     sync.WaitGroup // appliers of WAL entries
+	walStop   chan struct{}  // closed on shutdown, so appliers stop retrying
+
+	syslog        *syslog.Listener
+	syslogBatcher *batcher
+	fluent        *fluent.Listener
+	imports       map[string]*sl_dump.Watcher // by ID
+	importsMx     sync.Mutex
+	tailer        *tail.Tailer
+	pipelines     map[string]*pipeline.Pipeline // by storage
+	pipelinesMx   sync.RWMutex
+
+	queuesMx     sync.RWMutex
+	queuesClosed bool
+	shutdownOnce sync.Once
+	stopped      chan struct{}
 }
 
 func New(config *m.Config) *Service {
 	s := &Service{
-		app:      echo.New(),
-		config:   config,
-		metasMap: sa.NewMetasMap(m.BLOCK_MAX_SIZE),
-
-		writeQueue:  make(chan *m.WriteLogsTask),
-		readQueue:   make(chan *m.ReadLogsTask),
-		deleteQueue: make(chan *m.DeleteQuery),
+		app:        echo.New(),
+		config:     config,
+		metasMap:   sa.NewMetasMap(m.BLOCK_MAX_SIZE),
+		batchesMap: sa.NewBatchesMap(m.MAX_BATCH_IDS),
+
+		writeQueue:  make(chan *m.WriteLogsTask, config.QueueSize),
+		readQueue:   make(chan *m.ReadLogsTask, config.QueueSize),
+		deleteQueue: make(chan *m.DeleteQuery, config.QueueSize),
 		fileSys:     &file_sys.FileSys{},
+
+		storageLimiter: limiter.New(config.RateLimit.StorageRate, config.RateLimit.StorageBurst),
+		clientLimiter:  limiter.New(config.RateLimit.ClientRate, config.RateLimit.ClientBurst),
+		stopped:        make(chan struct{}),
+		walStop:        make(chan struct{}),
+		imports:        map[string]*sl_dump.Watcher{},
+		pipelines:      map[string]*pipeline.Pipeline{},
 	}
+	s.app.Binder = &binder{}
+	s.app.IPExtractor = echo.ExtractIPDirect() // headers of client can't change its IP for limiter
 	s.setRoutes()
 	return s
 }
@@ -47,21 +112,31 @@ func (s *Service) Run() {
 	trace := sl.NewTrace("Init")
 	defer trace.AddModule("_Service", "Run")()
 
+	// Lock data dir, so other process can't work with it
+
+	dirLock := file_sys.LockDataDir(trace)
+	defer dirLock.Unlock()
+
 	// Run transactions/backups and read and clear storages
 
+	file_sys.SetDurability(s.config.Durability.Mode, s.config.Durability.GroupPeriod)
 	file_sys.RunTransactions(trace)
+	file_sys.RemoveSpills(trace)
 
 	metasMap, firstRawChunks := s.fileSys.ReadAndClearStorages(trace)
 
 	for storage, metas := range metasMap {
 		s.metasMap.AddStorage(trace, storage, metas)
+		s.batchesMap.AddStorage(storage, s.fileSys.ReadBatches(trace, storage))
 	}
+	s.loadPipelines(trace)
 
 	// Run writers
 
 	for i := byte(0); i < s.config.Writers; i++ {
 		sw := sa.NewWriter(m.MAX_LOGS_IN_CHUNK)
-		sw.RunWriter(s.writeQueue, uint64(i), firstRawChunks, uint64(s.config.Writers), s.metasMap)
+		sw.RunWriter(s.writeQueue, uint64(i), firstRawChunks, uint64(s.config.Writers), s.metasMap, s.batchesMap)
+		s.writers = append(s.writers, sw)
 	}
 
 	// Run readers
@@ -69,6 +144,17 @@ func (s *Service) Run() {
 	for i := byte(0); i < s.config.Readers; i++ {
 		sr := sa.NewReader()
 		sr.RunReader(s.readQueue, s.metasMap)
+		s.readers = append(s.readers, sr)
+	}
+
+	// Replay WAL, entries are applied by writers
+
+	if s.config.WAL {
+		wal, entries := file_sys.OpenWAL(trace)
+		s.wal = wal
+
+		s.walWg.Add(1)
+		go s.replayWal(entries)
 	}
 
 	// Run deleters
@@ -79,35 +165,160 @@ func (s *Service) Run() {
 	for i := byte(0); i < s.config.Deleters; i++ {
 		sd := sa.NewDeleter(sr, sw)
 		sd.RunDeleter(s.deleteQueue, s.metasMap)
+		s.deleters = append(s.deleters, sd)
 	}
 	s.fileSys.ReadAndSendDeleteQueries(trace, s.deleteQueue)
 
+	// Run listeners
+
+	s.runSyslog(trace)
+	s.runFluent(trace)
+	s.runImports(trace)
+	s.runTails(trace)
+
 	// Run scheduler
 
 	sd := sa.NewDeleter(sr, sw)
-	scheduler := sa.NewScheduler(trace, sr, sw, sd, s.config.Scheduler)
+	s.scheduler = sa.NewScheduler(trace, sr, sw, sd, s.config.Scheduler)
 
-	scheduler.RunAligner(s.metasMap)
-	scheduler.RunExpiredDeleter(s.metasMap)
-	scheduler.RunRemover(s.metasMap)
+	s.scheduler.RunAligner(s.metasMap)
+	s.scheduler.RunExpiredDeleter(s.metasMap)
+	s.scheduler.RunRemover(s.metasMap)
+	s.scheduler.RunCheckpointer(s.metasMap)
+	s.scheduler.RunProber()
+	s.scheduler.RunDiskWatcher(s.metasMap, s.config.Disk, s.config.DataDirs)
 
-	err := s.app.Start("127.0.0.1:" + s.config.Port)
+	// Shutdown on signals
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		signal.Stop(signals) // next signal kills process without waiting
+
+		trace := sl.NewTrace("Signal")
+		trace.INFO(nil, "Signal received: ", sig.String())
+		s.Shutdown()
+		trace.Close()
+	}()
+
+	// Listen unix socket or host and port
+
+	if s.config.Socket != "" {
+		os.Remove(s.config.Socket)
+		listener, err := net.Listen("unix", s.config.Socket)
+
+		if err != nil {
+			trace.FATAL(nil, "Listen socket '", s.config.Socket, "' error: ", err.Error())
+		}
+		s.app.Listener = listener
+	}
+
+	err := s.app.Start(net.JoinHostPort(s.config.Host, s.config.Port))
 
 	if err != nil && err != http.ErrServerClosed {
 		trace.FATAL(nil, "Server error: ", err.Error())
 	}
+
+	<-s.stopped
 	trace.INFO(nil, "Server closed")
 }
 
+// Shutdown stops accepting requests, lets workers complete queued tasks and stops scheduler.
+// It may be called several times, but shutdown runs only once
+func (s *Service) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		go s.shutdown()
+	})
+}
+
+func (s *Service) shutdown() {
+	trace := sl.NewTrace("Shutdown")
+	defer trace.Close()
+	defer trace.AddModule("_Service", "shutdown")()
+
+	trace.INFO(nil, "Shutting down...")
+
+	// Stop accepting requests and wait for processed ones
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	err := s.app.Shutdown(ctx)
+	cancel()
+
+	if err != nil {
+		trace.ERROR(nil, "Server shutdown error: ", err.Error())
+		s.app.Close()
+	}
+	s.stopSyslog(trace)
+	s.stopFluent(trace)
+	s.stopImports(trace)
+	s.stopTails(trace)
+
+	// Close queues, so workers complete queued tasks and stop
+
+	s.queuesMx.Lock()
+	s.queuesClosed = true
+	close(s.walStop)
+	close(s.writeQueue)
+	close(s.readQueue)
+	close(s.deleteQueue)
+	s.queuesMx.Unlock()
+
+	for _, sw := range s.writers {
+		sw.Wait()
+	}
+	trace.INFO(nil, "Writers stopped")
+
+	if s.wal != nil {
+		s.walWg.Wait()
+		s.wal.Close(trace)
+		trace.INFO(nil, "WAL closed")
+	}
+
+	for _, sr := range s.readers {
+		sr.Wait()
+	}
+	trace.INFO(nil, "Readers stopped")
+
+	for _, sd := range s.deleters {
+		sd.Stop()
+	}
+	trace.INFO(nil, "Deleters stopped")
+
+	s.scheduler.Stop()
+	trace.INFO(nil, "Scheduler stopped")
+
+	close(s.stopped)
+}
+
 func (s *Service) setRoutes() {
 	s.app.POST("/logs", s.postLogs)
+	s.app.POST("/logs/multi", s.postLogsMulti)
+	s.app.POST("/logs/bulk", s.postLogsBulk)
 	s.app.POST("/logs/search", s.postLogsSearch)
+	s.app.POST("/v1/logs", s.postOtlpLogs)
+	s.app.POST("/loki/api/v1/push", s.postLokiPush)
+	s.app.POST("/_bulk", s.postEsBulk)
+	s.app.PUT("/_bulk", s.postEsBulk)
+	s.app.POST("/:index/_bulk", s.postEsBulk)
+	s.app.PUT("/:index/_bulk", s.postEsBulk)
 	s.app.DELETE("/logs", s.deleteLogs)
 
 	s.app.GET("/storages", s.getStorages)
 	s.app.POST("/storage", s.postStorage)
 	s.app.DELETE("/storage", s.deleteStorage)
 
+	s.app.GET("/imports", s.getImports)
+	s.app.POST("/import", s.postImport)
+	s.app.DELETE("/import", s.deleteImport)
+
+	s.app.GET("/pipelines", s.getPipelines)
+	s.app.POST("/pipeline", s.postPipeline)
+	s.app.DELETE("/pipeline", s.deletePipeline)
+
+	s.app.GET("/", s.getEsInfo)
+	s.app.GET("/status", s.getStatus)
 	s.app.POST("/shutdown", s.postShutdown)
 }
 
@@ -130,19 +341,51 @@ func (s *Service) postLogs(c echo.Context) error {
 		return s.sendError(c, err)
 	}
 
-	err = logs.Validate(trace)
+	// Batch ID may be sent in header
+	if logs.BatchID == "" {
+		logs.BatchID = c.Request().Header.Get("Idempotency-Key")
+	}
+
+	s.transform(trace, logs)
+	report, err := logs.Validate(trace)
+
+	if err != nil {
+		if report != nil {
+			return s.sendReport(c, 400, err.Error(), report)
+		}
+		return s.sendError(c, err)
+	}
+
+	err = s.writable(trace, true)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.admit(trace, c, logs.Storage)
 
 	if err != nil {
 		return s.sendError(c, err)
 	}
 
+	if s.wal != nil {
+		return s.acceptLogs(c, trace, logs, report)
+	}
+
 	task := &m.WriteLogsTask{
 		Storage: logs.Storage,
+		BatchID: logs.BatchID,
 		Logs:    logs.Logs,
 		ErrCh:   make(chan error, 1),
 		Trace:   trace,
+		Ctx:     c.Request().Context(),
+	}
+	err = enqueue(s, task.Ctx, s.writeQueue, task)
+
+	if err != nil {
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
 	}
-	s.writeQueue <- task
 	err = <-task.ErrCh
 
 	if err != nil {
@@ -150,7 +393,294 @@ func (s *Service) postLogs(c echo.Context) error {
 	}
 
 	trace.INFO(nil, "Request processed")
-	return s.sendMessage(c, 201, "Logs saved")
+	return s.sendReport(c, 201, "Logs saved", report)
+}
+
+func (s *Service) postLogsMulti(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostLogsMultiAPI")
+	defer trace.AddModule("_Service", "postLogsMulti")()
+
+	trace.INFO(nil, "Request processing...")
+
+	multi := &m.MultiLogs{}
+	err := c.Bind(multi)
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect format: ", err.(*echo.HTTPError).Message)
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err = multi.Validate(trace)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.writable(trace, true)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.admit(trace, c, multi.Storages()...)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	// Validate batches
+
+	results := make([]*m.StorageResult, len(multi.Batches))
+	valid := make([]*m.Logs, 0, len(multi.Batches))
+
+	for i, logs := range multi.Batches {
+		results[i] = &m.StorageResult{Storage: logs.Storage}
+		s.transform(trace, logs)
+		report, err := logs.Validate(trace)
+
+		if report != nil {
+			results[i].Accepted = report.Accepted
+			results[i].Rejected = report.Rejected
+		}
+
+		if err != nil {
+			s.setResult(results[i], err, 0, "")
+			continue
+		}
+		valid = append(valid, logs)
+	}
+
+	if multi.Atomic && len(valid) < len(multi.Batches) {
+		err = aerr.NewAppErr(aerr.BadReq, "Some batches are invalid, no logs saved")
+		trace.NOTE(nil, err.Error())
+		return s.sendResults(c, 400, err.Error(), results)
+	}
+
+	// Atomic batches are written by one writer under one backup,
+	// others are written in parallel
+
+	ctx := c.Request().Context()
+
+	if multi.Atomic {
+		err = s.writeLogs(ctx, trace, valid[0], valid[1:])
+
+		if err != nil {
+			return s.sendError(c, err)
+		}
+
+		for i := range results {
+			s.setResult(results[i], nil, 201, "Logs saved")
+		}
+
+		trace.INFO(nil, "Request processed")
+		return s.sendResults(c, 201, "Logs saved", results)
+	}
+
+	errs := s.writeParallel(ctx, trace, valid)
+	status, msg := 201, "Logs saved"
+
+	for i := range results {
+		err, ok := errs[results[i].Storage]
+
+		if ok {
+			s.setResult(results[i], err, 201, "Logs saved")
+		}
+
+		if results[i].Status != 201 {
+			status, msg = 207, "Logs of some storages are not saved"
+		}
+	}
+
+	trace.INFO(nil, "Request processed")
+	return s.sendResults(c, status, msg, results)
+}
+
+// postLogsBulk reads stream of logs (one JSON per line), which is cut into batches for writers.
+// Invalid lines are skipped and reported, written batches stay saved if stream is broken
+func (s *Service) postLogsBulk(c echo.Context) error {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostLogsBulkAPI")
+	defer trace.AddModule("_Service", "postLogsBulk")()
+
+	trace.INFO(nil, "Request processing...")
+
+	storage := c.QueryParam("storage")
+
+	if storage == "" || len(storage) > 200 {
+		err := aerr.NewAppErr(aerr.BadReq, "Number of characters in 'storage' must be from 1 to 200")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	err := s.writable(trace, true)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.admit(trace, c, storage)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	if !s.metasMap.Exists(storage) {
+		err = aerr.NewAppErr(aerr.NotFound, "Storage '", storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	body, err := s.requestBody(trace, c)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	report := &m.ValidationReport{Rejected: []*m.RejectedLog{}}
+	pipeline := s.pipeline(storage)
+
+	respond := func(status int, msg string) error {
+		return c.JSON(status, map[string]any{
+			"error":    msg,
+			"accepted": report.Accepted,
+			"rejected": report.Rejected,
+		})
+	}
+
+	// Batches are written while next ones are read, no more than _BULK_IN_FLIGHT at once.
+	// Each batch has fork of request trace, because writers use it while next lines are handled
+
+	ctx := c.Request().Context()
+	inFlight := make(chan *m.WriteLogsTask, _BULK_IN_FLIGHT)
+	batch := make([]*m.Log, 0, m.MAX_LOGS_IN_CHUNK)
+	batches := 0
+
+	wait := func() error {
+		task := <-inFlight
+		err := <-task.ErrCh
+		task.Trace.Close()
+
+		if err == nil {
+			report.Accepted += len(task.Logs)
+		}
+		return err
+	}
+
+	waitAll := func() (err error) {
+		for len(inFlight) > 0 {
+			if taskErr := wait(); err == nil {
+				err = taskErr
+			}
+		}
+		return err
+	}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if len(inFlight) == cap(inFlight) {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+
+		batches++
+		task := &m.WriteLogsTask{
+			Storage: storage,
+			Logs:    batch,
+			ErrCh:   make(chan error, 1),
+			Trace:   trace.Fork(fmt.Sprint("batch_", batches)),
+			Ctx:     ctx,
+		}
+		err := enqueue(s, ctx, s.writeQueue, task)
+
+		if err != nil {
+			task.Trace.Close()
+			trace.NOTE(nil, err.Error())
+			return err
+		}
+		inFlight <- task
+		batch = make([]*m.Log, 0, m.MAX_LOGS_IN_CHUNK)
+		return nil
+	}
+
+	fail := func(err error) error {
+		waitAll()
+		status, msg := 500, "Server error"
+
+		if appErr, ok := err.(*aerr.AppErr); ok {
+			status, msg = aerr.GetStatus(appErr.Type()), appErr.Error()
+		}
+		return respond(status, msg)
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), _BULK_MAX_LINE)
+
+	for i := 0; scanner.Scan(); i++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		l := &m.Log{}
+
+		if err := json.Unmarshal(line, l); err != nil {
+			report.Rejected = append(report.Rejected, &m.RejectedLog{
+				Index:  i,
+				Errors: []*m.FieldError{{Reason: "Incorrect format: " + err.Error()}},
+			})
+			continue
+		}
+
+		if pipeline != nil {
+			pipeline.Apply(trace, l)
+		}
+
+		if errs := l.Errors(); len(errs) > 0 {
+			report.Rejected = append(report.Rejected, &m.RejectedLog{Index: i, Errors: errs})
+			continue
+		}
+		batch = append(batch, l)
+
+		if len(batch) == m.MAX_LOGS_IN_CHUNK {
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Reading of stream failed: ", err.Error())
+		trace.NOTE(nil, err.Error())
+		return fail(err)
+	}
+
+	if err = flush(); err != nil {
+		return fail(err)
+	}
+
+	if err = waitAll(); err != nil {
+		return fail(err)
+	}
+
+	if len(report.Rejected) > 0 {
+		trace.NOTE(nil, len(report.Rejected), " invalid lines are skipped")
+	}
+
+	if report.Accepted == 0 {
+		return respond(400, "No valid logs")
+	}
+
+	trace.INFO(nil, "Request processed")
+	return respond(201, "Logs saved")
 }
 
 func (s *Service) postLogsSearch(c echo.Context) error {
@@ -170,26 +700,43 @@ func (s *Service) postLogsSearch(c echo.Context) error {
 		return s.sendError(c, err)
 	}
 
-	proc, lld, err := log_utils.NewProcessor(trace, query)
+	err = s.admit(trace, c, query.Storage)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	proc, lld, err := log_utils.NewProcessor(trace, query, &s.config.Query)
 
 	if err != nil {
 		return s.sendError(c, err)
 	}
+	defer proc.Close()
 
 	trace.INFO(nil, "Reading and searching logs...")
 
+	ctx, cancel := context.WithTimeout(c.Request().Context(), s.config.Query.Timeout)
+	defer cancel()
+
 	task := &m.ReadLogsTask{
 		Lld:    lld,
 		LogsCh: make(chan []*m.Log, 1),
 		ErrCh:  make(chan error, 1),
 		Trace:  trace,
+		Ctx:    ctx,
+	}
+	err = enqueue(s, ctx, s.readQueue, task)
+
+	if err != nil {
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
 	}
-	s.readQueue <- task
 	err = proc.PutLogsFromChanel(task.LogsCh, task.ErrCh)
 
 	if err != nil {
 		return s.sendError(c, err)
 	}
+	proc.PutMetas(task.Metas)
 
 	result, err := proc.GetResult()
 
@@ -198,7 +745,7 @@ func (s *Service) postLogsSearch(c echo.Context) error {
 	}
 
 	trace.INFO(nil, "Request processed")
-	return c.JSON(200, result)
+	return s.sendData(c, 200, result)
 }
 
 func (s *Service) deleteLogs(c echo.Context) error {
@@ -224,10 +771,28 @@ func (s *Service) deleteLogs(c echo.Context) error {
 		return s.sendError(c, err)
 	}
 
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	err = s.admit(trace, c, query.Storage)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
 	query.ErrCh = make(chan error, 1)
 	query.Trace = trace
+	query.Ctx = c.Request().Context()
 
-	s.deleteQueue <- query
+	err = enqueue(s, query.Ctx, s.deleteQueue, query)
+
+	if err != nil {
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
 	err = <-query.ErrCh
 
 	if err != nil {
@@ -275,6 +840,18 @@ func (s *Service) postStorage(c echo.Context) error {
 		return s.sendError(c, err)
 	}
 
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	dataDir, err := s.dataDirFor(trace, req.DataDir)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
 	ok := s.metasMap.AddStorage(trace, req.Storage, []*m.Meta{})
 
 	if !ok {
@@ -282,7 +859,17 @@ func (s *Service) postStorage(c echo.Context) error {
 		trace.NOTE(nil, err.Error())
 		return s.sendError(c, err)
 	}
-	s.fileSys.MakeDirAll(trace, "storages", req.Storage)
+	err = s.fileSys.MakeStorageDir(trace, req.Storage, dataDir)
+
+	if err == nil {
+		err = s.fileSys.Sync(trace)
+	}
+
+	// Partially made dirs are removed with deleted storage
+	if err != nil {
+		s.metasMap.DeleteStorage(trace, req.Storage)
+		return s.sendError(c, err)
+	}
 
 	trace.INFO(nil, "Request processed")
 	return s.sendMessage(c, 201, "Storage created")
@@ -311,6 +898,29 @@ func (s *Service) deleteStorage(c echo.Context) error {
 		return s.sendError(c, err)
 	}
 
+	err = s.writable(trace, false)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	if !s.metasMap.Exists(req.Storage) {
+		err = aerr.NewAppErr(aerr.NotFound, "Storage '", req.Storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	// Mark is written first, so storage is not deleted only in state on error
+	_, err = s.fileSys.WriteFile(trace, path.Join("storages", req.Storage, "_deleted_"), false, "")
+
+	if err == nil {
+		err = s.fileSys.Sync(trace)
+	}
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
 	ok := s.metasMap.DeleteStorage(trace, req.Storage)
 
 	if !ok {
@@ -318,33 +928,47 @@ func (s *Service) deleteStorage(c echo.Context) error {
 		trace.NOTE(nil, err.Error())
 		return s.sendError(c, err)
 	}
-	s.fileSys.WriteFile(trace, path.Join("storages", req.Storage, "_deleted_"), false, "")
+	s.batchesMap.DeleteStorage(req.Storage)
+
+	// Pipeline isn't kept for new storage with same name
+	s.pipelinesMx.Lock()
+	err = s.removePipeline(trace, req.Storage)
+	s.pipelinesMx.Unlock()
+
+	if err != nil {
+		trace.ERROR(nil, "Removing of pipeline of storage '", req.Storage, "' error: ", err.Error())
+	}
 
 	trace.INFO(nil, "Request processed")
 	return s.sendMessage(c, 200, "Storage deleted")
 }
 
-func (s *Service) postShutdown(c echo.Context) (err error) {
+func (s *Service) getStatus(c echo.Context) error {
 	trace := sl.NewTrace(uuid.New().String())
-	trace.SetEntity("Request", "PostShutdownAPI")
-	popModule := trace.AddModule("_Service", "postShutdown")
+	defer trace.Close()
+	trace.SetEntity("Request", "GetStatusAPI")
+	defer trace.AddModule("_Service", "getStatus")()
 
-	isShutdown := false
+	trace.INFO(nil, "Request processing...")
 
-	defer func() {
-		if isShutdown {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	status := &m.Status{Mode: m.MODE_READ_WRITE, LowSpace: file_sys.IsLowSpace()}
+	reason, since := file_sys.ReadOnlyStatus()
 
-			err := s.app.Shutdown(ctx)
-			cancel()
+	if reason != "" {
+		status.Mode = m.MODE_READ_ONLY
+		status.Reason = reason
+		status.Since = since.UnixMilli()
+	}
 
-			if err != nil {
-				trace.FATAL(nil, "Shutdown error: ", err.Error())
-			}
-		}
-		popModule()
-		trace.Close()
-	}()
+	trace.INFO(nil, "Request processed")
+	return c.JSON(200, status)
+}
+
+func (s *Service) postShutdown(c echo.Context) (err error) {
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("Request", "PostShutdownAPI")
+	defer trace.AddModule("_Service", "postShutdown")()
 
 	trace.INFO(nil, "Request processing...")
 
@@ -363,17 +987,309 @@ func (s *Service) postShutdown(c echo.Context) (err error) {
 		return s.sendError(c, err)
 	}
 
-	isShutdown = true
+	s.Shutdown()
 
 	trace.INFO(nil, "Request processed")
 	return s.sendMessage(c, 200, "Server shutdown")
 }
 
+// Data dirs
+
+// dataDirFor returns requested data dir of new storage or data dir with the most free space.
+// Empty dir is data root
+func (s *Service) dataDirFor(trace *sl.Trace, requested string) (string, error) {
+	defer trace.AddModule("_Service", "dataDirFor")()
+
+	if requested == "" {
+		if len(s.config.DataDirs) == 0 {
+			return "", nil
+		}
+		return s.fileSys.PickDataDir(trace, append([]string{""}, s.config.DataDirs...)), nil
+	}
+
+	requested = filepath.Clean(requested)
+
+	if requested == s.config.DataDir {
+		return "", nil
+	}
+
+	if !slices.Contains(s.config.DataDirs, requested) {
+		err := aerr.NewAppErr(aerr.BadReq, "Data dir '", requested, "' is not configured")
+		trace.NOTE(nil, err.Error())
+		return "", err
+	}
+	return requested, nil
+}
+
+// Admission
+
+// admit takes tokens of client and storages, so requests over rate limits are rejected with 429
+func (s *Service) admit(trace *sl.Trace, c echo.Context, storages ...string) error {
+	defer trace.AddModule("_Service", "admit")()
+
+	// Client is checked first, so client over its limit doesn't spend tokens of storages.
+	// Tokens taken before rejection are returned, so rejected requests spend no tokens
+
+	client := c.RealIP()
+
+	if ok, wait := s.clientLimiter.Take(client); !ok {
+		err := aerr.NewRetryAppErr(aerr.TooManyReqs, wait, "Too many requests from client '", client, "'")
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+
+	for i, storage := range storages {
+		if ok, wait := s.storageLimiter.Take(storage); !ok {
+			for _, taken := range storages[:i] {
+				s.storageLimiter.Return(taken)
+			}
+			s.clientLimiter.Return(client)
+
+			err := aerr.NewRetryAppErr(aerr.TooManyReqs, wait, "Too many requests to storage '", storage, "'")
+			trace.NOTE(nil, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// writable rejects changing requests with 507 in read-only mode.
+// Writing of logs (ingest) is rejected also when free space is below hard limit
+func (s *Service) writable(trace *sl.Trace, ingest bool) error {
+	err := file_sys.ReadOnlyErr()
+
+	if ingest {
+		err = file_sys.IngestErr()
+	}
+
+	if err != nil {
+		trace.NOTE(nil, err.Error())
+	}
+	return err
+}
+
+// WAL
+
+// acceptLogs writes logs to WAL and responds 202, logs are applied to chunks in background
+func (s *Service) acceptLogs(c echo.Context, trace *sl.Trace, logs *m.Logs, report *m.ValidationReport) error {
+	defer trace.AddModule("_Service", "acceptLogs")()
+
+	if !s.metasMap.Exists(logs.Storage) {
+		err := aerr.NewAppErr(aerr.NotFound, "Storage '", logs.Storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	// Backlog of not applied entries is limited like queue of writers
+
+	if s.wal.Pending() >= s.config.QueueSize {
+		err := aerr.NewRetryAppErr(aerr.Unavailable, time.Second, "Too many not applied logs, try again later")
+		trace.NOTE(nil, err.Error())
+		return s.sendError(c, err)
+	}
+
+	entry, err := s.wal.Append(trace, logs)
+
+	if err != nil {
+		return s.sendError(c, err)
+	}
+
+	s.walWg.Add(1)
+	go s.applyWal(entry)
+
+	trace.INFO(nil, "Request processed")
+	return s.sendReport(c, 202, "Logs accepted", report)
+}
+
+// replayWal applies not applied entries of WAL one by one in order of their appending
+func (s *Service) replayWal(entries []*file_sys.WalEntry) {
+	defer s.walWg.Done()
+
+	for _, entry := range entries {
+		s.walWg.Add(1)
+		s.applyWal(entry)
+	}
+}
+
+// applyWal sends WAL entry to writers and marks it as applied. Failed entry is retried with backoff,
+// because it is acknowledged already. If server is shutting down, entry stays in WAL and is replayed after restart
+func (s *Service) applyWal(entry *file_sys.WalEntry) {
+	defer s.walWg.Done()
+
+	trace := sl.NewTrace(uuid.New().String())
+	defer trace.Close()
+	trace.SetEntity("WAL", strconv.FormatUint(entry.Seq, 10))
+	defer trace.AddModule("_Service", "applyWal")()
+
+	retry := _WAL_RETRY_MIN
+
+	for {
+		err := s.writeWalEntry(trace, entry)
+
+		// Logs of deleted storage can't be applied, so entry is dropped
+		if appErr, ok := err.(*aerr.AppErr); ok && appErr.Type() == aerr.NotFound {
+			trace.WARN(nil, "WAL entry is dropped: ", err.Error())
+			err = nil
+		}
+
+		if err == nil {
+			s.wal.Done(trace, entry.Seq)
+			return
+		}
+
+		select {
+		case <-s.walStop:
+			trace.INFO(nil, "WAL entry will be replayed after restart")
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, _WAL_RETRY_MAX)
+	}
+}
+
+// writeWalEntry sends WAL entry to writers and waits for result
+func (s *Service) writeWalEntry(trace *sl.Trace, entry *file_sys.WalEntry) error {
+	task := &m.WriteLogsTask{
+		Storage: entry.Storage,
+		BatchID: entry.BatchID,
+		Logs:    entry.Logs,
+		ErrCh:   make(chan error, 1),
+		Trace:   trace,
+		Ctx:     context.Background(),
+	}
+
+	for {
+		err := enqueue(s, task.Ctx, s.writeQueue, task)
+
+		if err == nil {
+			break
+		}
+
+		if s.isQueuesClosed() {
+			return err
+		}
+	}
+
+	err := <-task.ErrCh
+
+	if err != nil {
+		trace.WARN(nil, "WAL entry is not applied, it will be retried: ", err.Error())
+	}
+	return err
+}
+
+func (s *Service) isQueuesClosed() bool {
+	s.queuesMx.RLock()
+	defer s.queuesMx.RUnlock()
+	return s.queuesClosed
+}
+
+// Writing
+
+// writeLogs sends logs to writers and waits for result. Batches of others are saved together with logs
+func (s *Service) writeLogs(ctx context.Context, trace *sl.Trace, logs *m.Logs, others []*m.Logs) error {
+	task := &m.WriteLogsTask{
+		Storage: logs.Storage,
+		BatchID: logs.BatchID,
+		Logs:    logs.Logs,
+		Others:  others,
+		ErrCh:   make(chan error, 1),
+		Trace:   trace,
+		Ctx:     ctx,
+	}
+	err := enqueue(s, ctx, s.writeQueue, task)
+
+	if err != nil {
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+	return <-task.ErrCh
+}
+
+// writeParallel writes batches of storages in parallel and returns errors by storages.
+// Trace isn't goroutine-safe, so each batch is written with fork of request trace
+func (s *Service) writeParallel(ctx context.Context, trace *sl.Trace, batches []*m.Logs) map[string]error {
+	defer trace.AddModule("_Service", "writeParallel")()
+
+	errs := make(map[string]error, len(batches))
+	errsMx := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for _, logs := range batches {
+		wg.Add(1)
+		batchTrace := trace.Fork(logs.Storage)
+
+		go func() {
+			defer wg.Done()
+			defer batchTrace.Close()
+			err := s.writeLogs(ctx, batchTrace, logs, nil)
+
+			errsMx.Lock()
+			errs[logs.Storage] = err
+			errsMx.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, logs := range batches {
+		if err := errs[logs.Storage]; err != nil {
+			trace.NOTE(nil, "Logs of storage '", logs.Storage, "' not saved: ", err.Error())
+		} else {
+			trace.DEBUG(nil, len(logs.Logs), " logs of storage '", logs.Storage, "' saved")
+		}
+	}
+	return errs
+}
+
+// requestBody returns body of request, which is decompressed if it is gzip-encoded
+func (s *Service) requestBody(trace *sl.Trace, c echo.Context) (io.Reader, error) {
+	body := c.Request().Body
+
+	if c.Request().Header.Get("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+
+	gz, err := gzip.NewReader(body)
+
+	if err != nil {
+		err = aerr.NewAppErr(aerr.BadReq, "Incorrect gzip: ", err.Error())
+		trace.NOTE(nil, err.Error())
+		return nil, err
+	}
+	return gz, nil
+}
+
+// enqueue sends task to workers queue, waiting no longer than QueueWait for free place and while context is not done
+func enqueue[T any](s *Service, ctx context.Context, queue chan<- T, task T) error {
+	s.queuesMx.RLock()
+	defer s.queuesMx.RUnlock()
+
+	if s.queuesClosed {
+		return aerr.NewAppErr(aerr.Unavailable, "Server is shutting down")
+	}
+
+	timer := time.NewTimer(s.config.QueueWait)
+	defer timer.Stop()
+
+	select {
+	case queue <- task:
+		return nil
+	case <-timer.C:
+		return aerr.NewRetryAppErr(aerr.Unavailable, time.Second, "Queue is full, try again later")
+	case <-ctx.Done():
+		return aerr.FromContext(ctx.Err())
+	}
+}
+
 // Messages
 
 func (s *Service) sendError(c echo.Context, err error) error {
 	switch err := err.(type) {
 	case *aerr.AppErr:
+		if retryAfter := err.RetryAfter(); retryAfter > 0 {
+			secs := int(math.Ceil(retryAfter.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(secs))
+		}
 		return s.sendMessage(c, aerr.GetStatus(err.Type()), err.Error())
 	default:
 		return s.sendMessage(c, 500, "Server error")
@@ -383,3 +1299,37 @@ func (s *Service) sendError(c echo.Context, err error) error {
 func (*Service) sendMessage(c echo.Context, status int, msg string) error {
 	return c.JSON(status, map[string]string{"error": msg})
 }
+
+// sendResults sends message with results of storages
+func (*Service) sendResults(c echo.Context, status int, msg string, results []*m.StorageResult) error {
+	return c.JSON(status, map[string]any{
+		"error":    msg,
+		"storages": results,
+	})
+}
+
+// setResult sets status and message of error or success to result of storage
+func (*Service) setResult(result *m.StorageResult, err error, status int, msg string) {
+	switch err := err.(type) {
+	case nil:
+		result.Status, result.Error = status, msg
+	case *aerr.AppErr:
+		result.Status, result.Error = aerr.GetStatus(err.Type()), err.Error()
+		result.Accepted = 0
+	default:
+		result.Status, result.Error = 500, "Server error"
+		result.Accepted = 0
+	}
+}
+
+// sendReport sends message with rejected logs, if there are any
+func (s *Service) sendReport(c echo.Context, status int, msg string, report *m.ValidationReport) error {
+	if len(report.Rejected) == 0 {
+		return s.sendMessage(c, status, msg)
+	}
+	return c.JSON(status, map[string]any{
+		"error":    msg,
+		"accepted": report.Accepted,
+		"rejected": report.Rejected,
+	})
+}
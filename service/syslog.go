@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	sl "github.com/j-hitgate/sherlog"
+
+	"main/agents/syslog"
+	m "main/models"
+)
+
+// runSyslog runs listeners of syslog, if they are configured.
+// Messages are written to the storage of syslog by batches
+func (s *Service) runSyslog(trace *sl.Trace) {
+	defer trace.AddModule("_Service", "runSyslog")()
+	config := s.config.Syslog
+
+	if config.UDPAddr == "" && config.TCPAddr == "" {
+		return
+	}
+
+	writeTrace := sl.NewTrace("syslog_writer")
+	writeTrace.SetEntity("syslogWriter", uuid.New().String())
+
+	s.syslogBatcher = newBatcher(config.Storage, config.BatchSize, config.FlushPeriod, func(logs *m.Logs) {
+		s.writeListened(writeTrace, logs)
+	})
+	s.syslog = syslog.NewListener(s.syslogBatcher.Add)
+	err := s.syslog.Run(trace, config.UDPAddr, config.TCPAddr)
+
+	if err != nil {
+		trace.FATAL(nil, "Listen syslog error: ", err.Error())
+	}
+}
+
+// stopSyslog stops listeners of syslog and writes the rest of received logs
+func (s *Service) stopSyslog(trace *sl.Trace) {
+	if s.syslog == nil {
+		return
+	}
+
+	s.syslog.Stop()
+	s.syslogBatcher.Stop()
+	trace.INFO(nil, "Syslog stopped")
+}
+
+// writeListened writes batch of listener. Senders don't wait for result, so logs of failed batch are lost
+func (s *Service) writeListened(trace *sl.Trace, logs *m.Logs) {
+	defer trace.AddModule("_Service", "writeListened")()
+
+	// Logs of listener are valid, but pipeline may spoil some of them
+	var err error
+
+	if p := s.pipeline(logs.Storage); p != nil {
+		p.Apply(trace, logs.Logs...)
+		logs.Partial = true
+		_, err = logs.Validate(trace)
+	}
+
+	if err == nil {
+		err = s.writable(trace, true)
+	}
+
+	if err == nil {
+		err = s.writeLogs(context.Background(), trace, logs, nil)
+	}
+
+	if err != nil {
+		trace.WARN(nil, len(logs.Logs), " logs of storage '", logs.Storage, "' are lost: ", err.Error())
+	}
+}
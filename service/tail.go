@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+
+	sl "github.com/j-hitgate/sherlog"
+
+	"main/agents/tail"
+	aerr "main/app_errors"
+	m "main/models"
+)
+
+// runTails runs tailer of local files, if tails are configured. Logs are written in-process
+func (s *Service) runTails(trace *sl.Trace) {
+	defer trace.AddModule("_Service", "runTails")()
+
+	if len(s.config.Tail.Tails) == 0 {
+		return
+	}
+
+	tailer, err := tail.NewTailer(trace, s.config.Tail.Tails, s.config.Tail.PollPeriod, s.writeTailed)
+
+	if err != nil {
+		trace.FATAL(nil, "Create tailer error: ", err.Error())
+	}
+	s.tailer = tailer
+	s.tailer.Run()
+}
+
+// stopTails stops tailer and waits for writing of read lines
+func (s *Service) stopTails(trace *sl.Trace) {
+	if s.tailer == nil {
+		return
+	}
+
+	s.tailer.Stop()
+	trace.INFO(nil, "Tails stopped")
+}
+
+// writeTailed writes batch of tailed file. Error is returned, if writing can succeed later,
+// then lines are read again. Batch of only invalid logs is dropped
+func (s *Service) writeTailed(trace *sl.Trace, logs *m.Logs) error {
+	defer trace.AddModule("_Service", "writeTailed")()
+
+	if !s.metasMap.Exists(logs.Storage) {
+		err := aerr.NewAppErr(aerr.NotFound, "Storage '", logs.Storage, "' not exists")
+		trace.NOTE(nil, err.Error())
+		return err
+	}
+
+	s.transform(trace, logs)
+	_, err := logs.Validate(trace)
+
+	if err != nil {
+		trace.WARN(nil, len(logs.Logs), " logs of storage '", logs.Storage, "' are dropped: ", err.Error())
+		return nil
+	}
+
+	err = s.writable(trace, true)
+
+	if err == nil {
+		err = s.writeLogs(context.Background(), trace, logs, nil)
+	}
+	return err
+}
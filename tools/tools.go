@@ -1,9 +1,13 @@
 package tools
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type Ordered interface {
@@ -67,6 +71,25 @@ func JoinSlicesRevers[T any](arrs ...[]T) []T {
 	return arr
 }
 
+// JoinSlicesBackward joins slices in reverse order of slices and their items
+func JoinSlicesBackward[T any](arrs ...[]T) []T {
+	length := 0
+
+	for i := range arrs {
+		length += len(arrs[i])
+	}
+
+	arr := make([]T, 0, length)
+
+	for i := len(arrs) - 1; i >= 0; i-- {
+		for j := len(arrs[i]) - 1; j >= 0; j-- {
+			arr = append(arr, arrs[i][j])
+		}
+	}
+
+	return arr
+}
+
 type SortBlock[Tval any, Tkey Ordered] struct {
 	SortKey Tkey
 	Value   Tval
@@ -248,9 +271,114 @@ func ToOrderedValue(v any) any {
 	}
 }
 
+// ToInt converts number of JSON (json.Number or float64) or msgpack (any integer) to int64
+func ToInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		if num, err := v.Int64(); err == nil {
+			return num, true
+		}
+		num, err := v.Float64()
+		return int64(num), err == nil
+	case float64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// ToNumbers converts numbers of JSON (json.Number) in values and nested arrays to int64
+// or float64, so they are saved in msgpack as numbers
+func ToNumbers(values []any) {
+	for i, val := range values {
+		switch val := val.(type) {
+		case json.Number:
+			if num, err := val.Int64(); err == nil {
+				values[i] = num
+			} else if num, err := val.Float64(); err == nil {
+				values[i] = num
+			}
+		case []any:
+			ToNumbers(val)
+		}
+	}
+}
+
 func Min[T Ordered](a, b T) T {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+// String
+
+// Cut cuts string to max bytes without breaking of last rune
+func Cut(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	s = s[:max]
+
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func FirstNotEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var sizeSuff = map[string]int64{
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+
+	if i <= 0 {
+		return 0, errors.New("incorrect size: " + s)
+	}
+
+	mult, ok := sizeSuff[s[i:]]
+
+	if !ok {
+		return 0, errors.New("incorrect size suffix: " + s[i:])
+	}
+
+	num, err := strconv.ParseInt(s[:i], 10, 64)
+
+	if err != nil {
+		return 0, errors.New("incorrect size: " + s)
+	}
+	return num * mult, nil
+}
@@ -28,3 +28,39 @@ func TestSortWithKey(t *testing.T) {
 
 	assert.True(t, EqualSlices(expected, values), "standart")
 }
+
+func TestJoinSlicesBackward(t *testing.T) {
+	assert.Equal(t, []int{5, 4, 3, 2, 1}, JoinSlicesBackward([]int{1, 2}, []int{}, []int{3, 4, 5}))
+	assert.Equal(t, []int{}, JoinSlicesBackward[int]())
+}
+
+func TestParseSize(t *testing.T) {
+	size, err := ParseSize("64MB")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(64<<20), size)
+	}
+
+	_, err = ParseSize("64XB")
+	assert.Error(t, err)
+
+	_, err = ParseSize("MB")
+	assert.Error(t, err)
+}
+
+func TestToInt(t *testing.T) {
+	num, ok := ToInt(json.Number("1700000000000000001"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000000000001), num, "not rounded")
+
+	num, ok = ToInt(json.Number("2.5"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), num, "as float64")
+
+	_, ok = ToInt("1")
+	assert.False(t, ok)
+
+	values := []any{json.Number("1700000000000000001"), json.Number("2.5"), []any{json.Number("3")}, "4"}
+	ToNumbers(values)
+	assert.Equal(t, []any{int64(1700000000000000001), 2.5, []any{int64(3)}, "4"}, values)
+}